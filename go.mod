@@ -1,12 +1,40 @@
 module github.com/nats-io/nats-mq
 
+go 1.20
+
 require (
 	github.com/ibm-messaging/mq-golang v0.0.0-20190327085124-99a6892c4514
-	github.com/nats-io/nats-server/v2 v2.0.0
-	github.com/nats-io/nats-streaming-server v0.15.1
-	github.com/nats-io/nats.go v1.8.1
+	github.com/nats-io/nats-server/v2 v2.9.24
+	github.com/nats-io/nats-streaming-server v0.25.6
+	github.com/nats-io/nats.go v1.31.0
 	github.com/nats-io/nuid v1.0.1
-	github.com/nats-io/stan.go v0.5.0
-	github.com/stretchr/testify v1.3.0
+	github.com/nats-io/stan.go v0.10.4
+	github.com/stretchr/testify v1.8.4
 	github.com/ugorji/go/codec v0.0.0-20190204201341-e444a5086c43
+	golang.org/x/text v0.14.0
+)
+
+require (
+	github.com/armon/go-metrics v0.4.1 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/fatih/color v1.16.0 // indirect
+	github.com/gogo/protobuf v1.3.2 // indirect
+	github.com/hashicorp/go-hclog v1.5.0 // indirect
+	github.com/hashicorp/go-immutable-radix v1.3.1 // indirect
+	github.com/hashicorp/go-msgpack/v2 v2.1.1 // indirect
+	github.com/hashicorp/golang-lru v1.0.2 // indirect
+	github.com/hashicorp/raft v1.6.0 // indirect
+	github.com/klauspost/compress v1.17.3 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/minio/highwayhash v1.0.2 // indirect
+	github.com/nats-io/jwt/v2 v2.5.3 // indirect
+	github.com/nats-io/nkeys v0.4.6 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
+	go.etcd.io/bbolt v1.3.8 // indirect
+	golang.org/x/crypto v0.15.0 // indirect
+	golang.org/x/sys v0.14.0 // indirect
+	golang.org/x/time v0.4.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
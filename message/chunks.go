@@ -0,0 +1,309 @@
+// Copyright 2012-2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// The chunking protocol used when a payload is larger than the NATS max payload
+//
+// The payload, an encoded bridge message or a plain body, is split into numbered chunks
+// that share a transfer id. Each chunk is sent as its own NATS message with the layout
+//
+//	magic       8 bytes, "NMQCHUNK"
+//	version     1 byte, ChunkVersion
+//	id length   1 byte
+//	transfer id id length bytes
+//	index       4 bytes, big endian, starting at 0
+//	count       4 bytes, big endian
+//	size        8 bytes, big endian, the size of the complete payload
+//	data        the rest of the message
+//
+// Chunks are published in order, but the assembler accepts them in any order.
+const (
+	// ChunkMagic starts every chunk
+	ChunkMagic = "NMQCHUNK"
+
+	// ChunkVersion is the version of the chunk layout
+	ChunkVersion = 1
+
+	// ChunkOverhead is the largest number of bytes a chunk adds to the data it carries
+	ChunkOverhead = len(ChunkMagic) + 1 + 1 + 255 + 4 + 4 + 8
+)
+
+// Chunk is one piece of a payload
+type Chunk struct {
+	TransferID string
+	Index      uint32
+	Count      uint32
+	Size       uint64
+	Data       []byte
+}
+
+// IsChunk returns true if the data starts with the chunk magic
+func IsChunk(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ChunkMagic))
+}
+
+// SplitIntoChunks splits the payload into encoded chunks, each of which is at most maxSize bytes
+// A payload that fits in a single chunk still returns one chunk.
+func SplitIntoChunks(payload []byte, maxSize int) ([][]byte, error) {
+	transferID := nuid.Next()
+	dataSize := maxSize - (len(ChunkMagic) + 1 + 1 + len(transferID) + 4 + 4 + 8)
+
+	if dataSize <= 0 {
+		return nil, fmt.Errorf("chunk size %d is too small", maxSize)
+	}
+
+	count := (len(payload) + dataSize - 1) / dataSize
+	if count == 0 {
+		count = 1
+	}
+
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * dataSize
+		if end > len(payload) {
+			end = len(payload)
+		}
+
+		chunk := Chunk{
+			TransferID: transferID,
+			Index:      uint32(i),
+			Count:      uint32(count),
+			Size:       uint64(len(payload)),
+			Data:       payload[i*dataSize : end],
+		}
+
+		encoded, err := chunk.Encode()
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, encoded)
+	}
+
+	return chunks, nil
+}
+
+// Encode writes the chunk in the chunk layout
+func (c *Chunk) Encode() ([]byte, error) {
+	if len(c.TransferID) == 0 || len(c.TransferID) > 255 {
+		return nil, fmt.Errorf("invalid chunk transfer id %q", c.TransferID)
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(ChunkMagic)+2+len(c.TransferID)+16+len(c.Data)))
+	buf.WriteString(ChunkMagic)
+	buf.WriteByte(ChunkVersion)
+	buf.WriteByte(byte(len(c.TransferID)))
+	buf.WriteString(c.TransferID)
+	binary.Write(buf, binary.BigEndian, c.Index)
+	binary.Write(buf, binary.BigEndian, c.Count)
+	binary.Write(buf, binary.BigEndian, c.Size)
+	buf.Write(c.Data)
+	return buf.Bytes(), nil
+}
+
+// DecodeChunk reads a chunk written by Encode
+func DecodeChunk(data []byte) (*Chunk, error) {
+	if !IsChunk(data) {
+		return nil, fmt.Errorf("data is not a chunk")
+	}
+
+	offset := len(ChunkMagic)
+	if len(data) < offset+2 {
+		return nil, fmt.Errorf("chunk is truncated")
+	}
+
+	if data[offset] != ChunkVersion {
+		return nil, fmt.Errorf("unsupported chunk version %d", data[offset])
+	}
+
+	idLength := int(data[offset+1])
+	offset += 2
+
+	if idLength == 0 || len(data) < offset+idLength+16 {
+		return nil, fmt.Errorf("chunk is truncated")
+	}
+
+	chunk := &Chunk{
+		TransferID: string(data[offset : offset+idLength]),
+	}
+	offset += idLength
+
+	chunk.Index = binary.BigEndian.Uint32(data[offset:])
+	chunk.Count = binary.BigEndian.Uint32(data[offset+4:])
+	chunk.Size = binary.BigEndian.Uint64(data[offset+8:])
+	chunk.Data = data[offset+16:]
+
+	if chunk.Count == 0 || chunk.Index >= chunk.Count {
+		return nil, fmt.Errorf("invalid chunk index %d of %d", chunk.Index, chunk.Count)
+	}
+
+	// every chunk but an empty payload's carries at least one byte
+	if uint64(chunk.Count) > chunk.Size+1 {
+		return nil, fmt.Errorf("invalid chunk count %d for %d bytes", chunk.Count, chunk.Size)
+	}
+
+	return chunk, nil
+}
+
+// transfer is a partially received payload, chunks are stored by index as they arrive
+// since the count comes from the sender
+type transfer struct {
+	chunks  map[uint32][]byte
+	count   uint32
+	bytes   int64
+	size    uint64
+	started time.Time
+}
+
+// ChunkAssembler rebuilds payloads from chunks, it is safe to use from multiple go routines
+// Incomplete transfers are dropped once they are older than the timeout, and chunks that
+// would take the memory used by incomplete transfers over the limit are rejected.
+type ChunkAssembler struct {
+	sync.Mutex
+
+	maxBytes  int64
+	timeout   time.Duration
+	bytes     int64
+	transfers map[string]*transfer
+}
+
+// NewChunkAssembler creates an assembler, a maxBytes or timeout of 0 disables that limit
+func NewChunkAssembler(maxBytes int64, timeout time.Duration) *ChunkAssembler {
+	return &ChunkAssembler{
+		maxBytes:  maxBytes,
+		timeout:   timeout,
+		transfers: map[string]*transfer{},
+	}
+}
+
+// Add stores a chunk, when the last chunk of a transfer arrives the complete payload
+// is returned along with true. Duplicate chunks are ignored. If the chunk doesn't match
+// its transfer or breaks the memory limit, the transfer is dropped and an error is returned.
+func (a *ChunkAssembler) Add(chunk *Chunk) ([]byte, bool, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	a.expire(time.Now())
+
+	t, ok := a.transfers[chunk.TransferID]
+
+	if !ok {
+		if a.maxBytes > 0 && chunk.Size > uint64(a.maxBytes) {
+			return nil, false, fmt.Errorf("transfer %s of %d bytes is larger than the chunk memory limit", chunk.TransferID, chunk.Size)
+		}
+
+		t = &transfer{
+			chunks:  map[uint32][]byte{},
+			count:   chunk.Count,
+			size:    chunk.Size,
+			started: time.Now(),
+		}
+		a.transfers[chunk.TransferID] = t
+	}
+
+	if chunk.Count != t.count || chunk.Size != t.size {
+		a.drop(chunk.TransferID)
+		return nil, false, fmt.Errorf("chunk %d doesn't match transfer %s", chunk.Index, chunk.TransferID)
+	}
+
+	if _, ok := t.chunks[chunk.Index]; ok {
+		return nil, false, nil
+	}
+
+	if uint64(t.bytes)+uint64(len(chunk.Data)) > t.size {
+		a.drop(chunk.TransferID)
+		return nil, false, fmt.Errorf("chunk %d takes transfer %s past its size", chunk.Index, chunk.TransferID)
+	}
+
+	if a.maxBytes > 0 && a.bytes+int64(len(chunk.Data)) > a.maxBytes {
+		a.drop(chunk.TransferID)
+		return nil, false, fmt.Errorf("chunk memory limit reached, dropped transfer %s", chunk.TransferID)
+	}
+
+	data := make([]byte, len(chunk.Data))
+	copy(data, chunk.Data)
+	t.chunks[chunk.Index] = data
+	t.bytes += int64(len(data))
+	a.bytes += int64(len(data))
+
+	if uint32(len(t.chunks)) < t.count {
+		return nil, false, nil
+	}
+
+	a.drop(chunk.TransferID)
+
+	payload := make([]byte, 0, t.bytes)
+	for i := uint32(0); i < t.count; i++ {
+		payload = append(payload, t.chunks[i]...)
+	}
+	if uint64(len(payload)) != t.size {
+		return nil, false, fmt.Errorf("transfer %s has %d bytes, expected %d", chunk.TransferID, len(payload), t.size)
+	}
+
+	return payload, true, nil
+}
+
+// Expire drops the incomplete transfers that are older than the timeout and returns their ids
+func (a *ChunkAssembler) Expire() []string {
+	a.Lock()
+	defer a.Unlock()
+	return a.expire(time.Now())
+}
+
+// Active returns true if the transfer has chunks waiting for the rest of the payload
+func (a *ChunkAssembler) Active(transferID string) bool {
+	a.Lock()
+	defer a.Unlock()
+	_, ok := a.transfers[transferID]
+	return ok
+}
+
+// Pending returns the number of incomplete transfers and the bytes they hold
+func (a *ChunkAssembler) Pending() (int, int64) {
+	a.Lock()
+	defer a.Unlock()
+	return len(a.transfers), a.bytes
+}
+
+func (a *ChunkAssembler) expire(now time.Time) []string {
+	if a.timeout <= 0 {
+		return nil
+	}
+
+	expired := []string{}
+	for id, t := range a.transfers {
+		if now.Sub(t.started) > a.timeout {
+			a.drop(id)
+			expired = append(expired, id)
+		}
+	}
+	return expired
+}
+
+func (a *ChunkAssembler) drop(id string) {
+	t, ok := a.transfers[id]
+	if !ok {
+		return
+	}
+	a.bytes -= t.bytes
+	delete(a.transfers, id)
+}
@@ -0,0 +1,187 @@
+// Copyright 2012-2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package message
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitAndAssembleChunks(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 1000)
+
+	chunks, err := SplitIntoChunks(payload, 1048)
+	require.NoError(t, err)
+	require.Len(t, chunks, 10)
+
+	assembler := NewChunkAssembler(0, 0)
+
+	// out of order, with a duplicate
+	order := []int{3, 0, 9, 1, 2, 4, 5, 6, 7, 0}
+	for _, i := range order {
+		require.True(t, len(chunks[i]) <= 1048)
+		require.True(t, IsChunk(chunks[i]))
+
+		chunk, err := DecodeChunk(chunks[i])
+		require.NoError(t, err)
+
+		_, complete, err := assembler.Add(chunk)
+		require.NoError(t, err)
+		require.False(t, complete)
+	}
+
+	count, size := assembler.Pending()
+	require.Equal(t, 1, count)
+	require.True(t, size > 0)
+
+	chunk, err := DecodeChunk(chunks[8])
+	require.NoError(t, err)
+	require.True(t, assembler.Active(chunk.TransferID))
+
+	result, complete, err := assembler.Add(chunk)
+	require.NoError(t, err)
+	require.True(t, complete)
+	require.Equal(t, payload, result)
+	require.False(t, assembler.Active(chunk.TransferID))
+
+	count, size = assembler.Pending()
+	require.Equal(t, 0, count)
+	require.Equal(t, int64(0), size)
+}
+
+func TestSmallAndEmptyChunks(t *testing.T) {
+	for _, payload := range [][]byte{[]byte("hello world"), {}} {
+		chunks, err := SplitIntoChunks(payload, 1048)
+		require.NoError(t, err)
+		require.Len(t, chunks, 1)
+
+		chunk, err := DecodeChunk(chunks[0])
+		require.NoError(t, err)
+
+		result, complete, err := NewChunkAssembler(0, 0).Add(chunk)
+		require.NoError(t, err)
+		require.True(t, complete)
+		require.Equal(t, payload, result)
+	}
+
+	_, err := SplitIntoChunks([]byte("hello world"), 10)
+	require.Error(t, err)
+}
+
+func TestBadChunks(t *testing.T) {
+	_, err := DecodeChunk([]byte("hello world"))
+	require.Error(t, err)
+
+	_, err = DecodeChunk([]byte(ChunkMagic))
+	require.Error(t, err)
+
+	chunks, err := SplitIntoChunks([]byte("hello world"), 1024)
+	require.NoError(t, err)
+
+	_, err = DecodeChunk(chunks[0][:len(ChunkMagic)+10])
+	require.Error(t, err)
+
+	bad := append([]byte{}, chunks[0]...)
+	bad[len(ChunkMagic)] = 2
+	_, err = DecodeChunk(bad)
+	require.Error(t, err)
+
+	c := Chunk{TransferID: "abc", Index: 2, Count: 2, Size: 10}
+	encoded, err := c.Encode()
+	require.NoError(t, err)
+	_, err = DecodeChunk(encoded)
+	require.Error(t, err)
+
+	c = Chunk{TransferID: "abc", Index: 0, Count: 1000, Size: 10}
+	encoded, err = c.Encode()
+	require.NoError(t, err)
+	_, err = DecodeChunk(encoded)
+	require.Error(t, err)
+
+	c = Chunk{TransferID: ""}
+	_, err = c.Encode()
+	require.Error(t, err)
+}
+
+func TestChunkMemoryLimit(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 1000)
+	chunks, err := SplitIntoChunks(payload, 1048)
+	require.NoError(t, err)
+
+	// the whole transfer is too big
+	assembler := NewChunkAssembler(5000, 0)
+	chunk, err := DecodeChunk(chunks[0])
+	require.NoError(t, err)
+	_, _, err = assembler.Add(chunk)
+	require.Error(t, err)
+
+	// two transfers that fit on their own, but not together
+	assembler = NewChunkAssembler(int64(len(payload)+100), 0)
+	other, err := SplitIntoChunks(payload, 1048)
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		chunk, err := DecodeChunk(chunks[i])
+		require.NoError(t, err)
+		_, _, err = assembler.Add(chunk)
+		require.NoError(t, err)
+	}
+
+	var failed bool
+	for i := 0; i < 9 && !failed; i++ {
+		chunk, err := DecodeChunk(other[i])
+		require.NoError(t, err)
+		_, _, err = assembler.Add(chunk)
+		failed = err != nil
+	}
+	require.True(t, failed)
+
+	count, _ := assembler.Pending()
+	require.Equal(t, 1, count)
+}
+
+func TestUntrustedChunkCount(t *testing.T) {
+	// a count this large is only stored as the chunks arrive
+	assembler := NewChunkAssembler(0, 0)
+	chunk := &Chunk{TransferID: "abc", Index: 0, Count: 1 << 31, Size: 1 << 40, Data: []byte("hello")}
+	_, complete, err := assembler.Add(chunk)
+	require.NoError(t, err)
+	require.False(t, complete)
+
+	// the data can't go past the size
+	chunk = &Chunk{TransferID: "def", Index: 0, Count: 2, Size: 4, Data: []byte("hello")}
+	_, _, err = assembler.Add(chunk)
+	require.Error(t, err)
+	require.False(t, assembler.Active("def"))
+}
+
+func TestChunkTimeout(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 1000)
+	chunks, err := SplitIntoChunks(payload, 1048)
+	require.NoError(t, err)
+
+	assembler := NewChunkAssembler(0, 50*time.Millisecond)
+	chunk, err := DecodeChunk(chunks[0])
+	require.NoError(t, err)
+	_, _, err = assembler.Add(chunk)
+	require.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+
+	expired := assembler.Expire()
+	require.Equal(t, []string{chunk.TransferID}, expired)
+	require.False(t, assembler.Active(chunk.TransferID))
+}
@@ -0,0 +1,61 @@
+// Copyright 2012-2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package message
+
+import (
+	"time"
+)
+
+// UnlimitedExpiry matches MQEI_UNLIMITED, the expiry of a message that doesn't expire
+const UnlimitedExpiry int32 = -1
+
+// expiryUnit is the unit of the MQMD expiry, tenths of a second
+const expiryUnit = 100 * time.Millisecond
+
+// SetExpiry sets the MQ expiry, in tenths of a second, and the matching absolute expiration
+// time in ExpiresAt, so that the remaining life can be worked out after the message has waited
+// in NATS or streaming
+func (h *BridgeHeader) SetExpiry(expiry int32, now time.Time) {
+	h.Expiry = expiry
+	h.ExpiresAt = 0
+
+	if expiry > 0 {
+		h.ExpiresAt = now.Add(time.Duration(expiry)*expiryUnit).UnixNano() / int64(time.Millisecond)
+	}
+}
+
+// Expired returns true if the message has an expiration time that has passed
+func (h *BridgeHeader) Expired(now time.Time) bool {
+	return h.ExpiresAt != 0 && h.RemainingExpiry(now) <= 0
+}
+
+// RemainingExpiry returns the MQ expiry, in tenths of a second, the message has left, using
+// ExpiresAt if it is set and the Expiry otherwise, UnlimitedExpiry is returned for messages
+// that don't expire and 0 for messages that have expired
+func (h *BridgeHeader) RemainingExpiry(now time.Time) int32 {
+	if h.ExpiresAt == 0 {
+		if h.Expiry > 0 {
+			return h.Expiry
+		}
+		return UnlimitedExpiry
+	}
+
+	remaining := time.Duration(h.ExpiresAt-now.UnixNano()/int64(time.Millisecond)) * time.Millisecond
+
+	if remaining <= 0 {
+		return 0
+	}
+
+	// round up so that a message with a few milliseconds left isn't expired by the conversion
+	return int32((remaining + expiryUnit - 1) / expiryUnit)
+}
@@ -0,0 +1,64 @@
+// Copyright 2012-2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package message
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiryIsCarriedAsAnExpirationTime(t *testing.T) {
+	now := time.Now()
+	header := BridgeHeader{}
+	header.SetExpiry(100, now)
+
+	require.Equal(t, int32(100), header.Expiry)
+	require.NotZero(t, header.ExpiresAt)
+	require.False(t, header.Expired(now))
+	require.Equal(t, int32(100), header.RemainingExpiry(now))
+	require.Equal(t, int32(40), header.RemainingExpiry(now.Add(6*time.Second)))
+	require.Equal(t, int32(1), header.RemainingExpiry(now.Add(9990*time.Millisecond)))
+	require.Equal(t, int32(0), header.RemainingExpiry(now.Add(11*time.Second)))
+	require.True(t, header.Expired(now.Add(11*time.Second)))
+}
+
+func TestUnlimitedExpiry(t *testing.T) {
+	now := time.Now()
+	header := BridgeHeader{}
+	header.SetExpiry(UnlimitedExpiry, now)
+
+	require.Zero(t, header.ExpiresAt)
+	require.False(t, header.Expired(now.Add(time.Hour)))
+	require.Equal(t, UnlimitedExpiry, header.RemainingExpiry(now))
+
+	// an expiry without an expiration time is used as is
+	header = BridgeHeader{Expiry: 50}
+	require.Equal(t, int32(50), header.RemainingExpiry(now.Add(time.Hour)))
+	require.False(t, header.Expired(now.Add(time.Hour)))
+}
+
+func TestExpiresAtHeaderRoundTrip(t *testing.T) {
+	msg := NewBridgeMessage([]byte("hello"))
+	msg.Header.SetExpiry(100, time.Now())
+
+	headers, err := msg.EncodeHeaders()
+	require.NoError(t, err)
+	require.Len(t, headers[HeaderPrefix+"ExpiresAt"], 1)
+
+	decoded, err := DecodeHeaders(msg.Body, headers)
+	require.NoError(t, err)
+	require.Equal(t, msg.Header.ExpiresAt, decoded.Header.ExpiresAt)
+	require.Equal(t, msg.Header.Expiry, decoded.Header.Expiry)
+}
@@ -0,0 +1,37 @@
+// Copyright 2012-2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package message
+
+// GroupCompleteProperty is set to true on the marker the bridge publishes after the last
+// message in an MQ message group when groups are sent as a batch
+const GroupCompleteProperty = "MQGroupComplete"
+
+// groupLastMsgFlag matches MQMF_LAST_MSG_IN_GROUP
+const groupLastMsgFlag = 16
+
+// NewGroupCompleteMessage creates the marker for the end of a group, the marker has no body,
+// the group id from the group and the number of messages in the group as the MsgSeqNumber
+func NewGroupCompleteMessage(groupID []byte, count int32) *BridgeMessage {
+	msg := NewBridgeMessage(nil)
+	msg.Header.GroupID = groupID
+	msg.Header.MsgSeqNumber = count
+	msg.Header.MsgFlags = groupLastMsgFlag
+	msg.SetProperty(GroupCompleteProperty, true)
+	return msg
+}
+
+// IsGroupComplete returns true if the message is the marker for the end of a group
+func (msg *BridgeMessage) IsGroupComplete() bool {
+	complete, ok := msg.GetBoolProperty(GroupCompleteProperty)
+	return ok && complete
+}
@@ -0,0 +1,36 @@
+// Copyright 2012-2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupCompleteMessage(t *testing.T) {
+	msg := NewGroupCompleteMessage([]byte("group"), 3)
+	require.True(t, msg.IsGroupComplete())
+	require.Empty(t, msg.Body)
+
+	encoded, err := msg.Encode()
+	require.NoError(t, err)
+
+	copy, err := DecodeBridgeMessage(encoded)
+	require.NoError(t, err)
+	require.True(t, copy.IsGroupComplete())
+	require.Equal(t, []byte("group"), copy.Header.GroupID)
+	require.Equal(t, int32(3), copy.Header.MsgSeqNumber)
+
+	require.False(t, NewBridgeMessage([]byte("hello world")).IsGroupComplete())
+}
@@ -0,0 +1,251 @@
+// Copyright 2012-2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package message
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The naming scheme used when a bridge message is carried in NATS message headers
+//
+// Each non-empty MQMD field is written as MQ-<MQMD field name>, for example MQ-MsgId
+// or MQ-CodedCharSetId. Numeric fields are written in decimal, byte array fields
+// (MsgId, CorrelId, AccountingToken and GroupId) are hex encoded and strings are
+// copied as is.
+//
+// Each property is written as MQ-Prop-<name>. String properties have no type header,
+// all other properties add MQ-PropType-<name> with one of string, int8, int16, int32,
+// int64, float32, float64, bool, bytes or null. Numbers are written in decimal, bools as
+// true/false, bytes are base64 encoded and null values are empty.
+const (
+	// HeaderPrefix is the prefix for all of the MQMD headers
+	HeaderPrefix = "MQ-"
+
+	// PropertyHeaderPrefix is the prefix for property value headers
+	PropertyHeaderPrefix = "MQ-Prop-"
+
+	// PropertyTypeHeaderPrefix is the prefix for property type headers
+	PropertyTypeHeaderPrefix = "MQ-PropType-"
+)
+
+type headerField struct {
+	name  string
+	value interface{} // *int32, *int64, *string or *[]byte
+}
+
+// headerFields returns the header names along with pointers to the matching fields
+func headerFields(h *BridgeHeader) []headerField {
+	return []headerField{
+		{"Version", &h.Version},
+		{"Report", &h.Report},
+		{"MsgType", &h.MsgType},
+		{"Expiry", &h.Expiry},
+		{"Feedback", &h.Feedback},
+		{"Encoding", &h.Encoding},
+		{"CodedCharSetId", &h.CodedCharSetID},
+		{"Format", &h.Format},
+		{"Priority", &h.Priority},
+		{"Persistence", &h.Persistence},
+		{"MsgId", &h.MsgID},
+		{"CorrelId", &h.CorrelID},
+		{"BackoutCount", &h.BackoutCount},
+		{"ReplyToQ", &h.ReplyToQ},
+		{"ReplyToQMgr", &h.ReplyToQMgr},
+		{"UserIdentifier", &h.UserIdentifier},
+		{"AccountingToken", &h.AccountingToken},
+		{"ApplIdentityData", &h.ApplIdentityData},
+		{"PutApplType", &h.PutApplType},
+		{"PutApplName", &h.PutApplName},
+		{"PutDate", &h.PutDate},
+		{"PutTime", &h.PutTime},
+		{"ApplOriginData", &h.ApplOriginData},
+		{"GroupId", &h.GroupID},
+		{"MsgSeqNumber", &h.MsgSeqNumber},
+		{"Offset", &h.Offset},
+		{"MsgFlags", &h.MsgFlags},
+		{"OriginalLength", &h.OriginalLength},
+		{"ReplyToChannel", &h.ReplyToChannel},
+		{"ExpiresAt", &h.ExpiresAt},
+	}
+}
+
+// EncodeHeaders returns the message header and properties as a set of NATS
+// message headers, the body is not included. The result can be converted to a nats.Header.
+func (msg *BridgeMessage) EncodeHeaders() (map[string][]string, error) {
+	headers := map[string][]string{}
+
+	for _, field := range headerFields(&msg.Header) {
+		value := ""
+		switch v := field.value.(type) {
+		case *int32:
+			if *v != 0 {
+				value = strconv.FormatInt(int64(*v), 10)
+			}
+		case *int64:
+			if *v != 0 {
+				value = strconv.FormatInt(*v, 10)
+			}
+		case *string:
+			value = *v
+		case *[]byte:
+			value = hex.EncodeToString(*v)
+		}
+
+		if value != "" {
+			headers[HeaderPrefix+field.name] = []string{value}
+		}
+	}
+
+	for name, prop := range msg.Properties {
+		typeName, ok := propertyTypeNames[prop.Type]
+		if !ok {
+			return nil, fmt.Errorf("can't encode property %s with unknown type %d", name, prop.Type)
+		}
+
+		value, ok := msg.GetTypedProperty(name)
+		if !ok {
+			return nil, fmt.Errorf("broken message property %s", name)
+		}
+
+		headers[PropertyHeaderPrefix+name] = []string{formatPropertyString(value)}
+
+		if prop.Type != PropertyTypeString {
+			headers[PropertyTypeHeaderPrefix+name] = []string{typeName}
+		}
+	}
+
+	return headers, nil
+}
+
+// DecodeHeaders creates a bridge message from a body and a set of NATS headers written
+// by EncodeHeaders. Headers without the MQ- prefix are ignored.
+func DecodeHeaders(body []byte, headers map[string][]string) (*BridgeMessage, error) {
+	msg := NewBridgeMessage(body)
+
+	get := func(key string) (string, bool) {
+		v, ok := headers[key]
+		if !ok || len(v) == 0 {
+			return "", false
+		}
+		return v[0], true
+	}
+
+	for _, field := range headerFields(&msg.Header) {
+		value, ok := get(HeaderPrefix + field.name)
+		if !ok {
+			continue
+		}
+
+		switch v := field.value.(type) {
+		case *int32:
+			i, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding header %s%s, %s", HeaderPrefix, field.name, err.Error())
+			}
+			*v = int32(i)
+		case *int64:
+			i, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding header %s%s, %s", HeaderPrefix, field.name, err.Error())
+			}
+			*v = i
+		case *string:
+			*v = value
+		case *[]byte:
+			b, err := hex.DecodeString(value)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding header %s%s, %s", HeaderPrefix, field.name, err.Error())
+			}
+			*v = b
+		}
+	}
+
+	for key := range headers {
+		if !strings.HasPrefix(key, PropertyHeaderPrefix) {
+			continue
+		}
+
+		name := strings.TrimPrefix(key, PropertyHeaderPrefix)
+		value, _ := get(key)
+		typeName, ok := get(PropertyTypeHeaderPrefix + name)
+		if !ok {
+			typeName = propertyTypeNames[PropertyTypeString]
+		}
+
+		typed, err := parsePropertyString(typeName, value)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding property %s, %s", name, err.Error())
+		}
+
+		err = msg.SetProperty(name, typed)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return msg, nil
+}
+
+// formatPropertyString writes a typed property value as a header string
+func formatPropertyString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// parsePropertyString returns the value with the go type that matches the type name
+func parsePropertyString(typeName string, value string) (interface{}, error) {
+	switch typeName {
+	case "string":
+		return value, nil
+	case "int8":
+		v, err := strconv.ParseInt(value, 10, 8)
+		return int8(v), err
+	case "int16":
+		v, err := strconv.ParseInt(value, 10, 16)
+		return int16(v), err
+	case "int32":
+		v, err := strconv.ParseInt(value, 10, 32)
+		return int32(v), err
+	case "int64":
+		return strconv.ParseInt(value, 10, 64)
+	case "float32":
+		v, err := strconv.ParseFloat(value, 32)
+		return float32(v), err
+	case "float64":
+		return strconv.ParseFloat(value, 64)
+	case "bool":
+		return strconv.ParseBool(value)
+	case "bytes":
+		return base64.StdEncoding.DecodeString(value)
+	case "null":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown property type %q", typeName)
+	}
+}
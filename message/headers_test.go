@@ -0,0 +1,105 @@
+// Copyright 2012-2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeadersRoundTrip(t *testing.T) {
+	msg := NewBridgeMessage([]byte("hello world"))
+	msg.Header = BridgeHeader{
+		Version:        2,
+		Report:         3,
+		Format:         "MQSTR",
+		MsgID:          []byte("cafebabe"),
+		ReplyToQ:       "DEV.QUEUE.2",
+		ReplyToChannel: "replies",
+	}
+
+	expected := map[string]interface{}{
+		"string":  "hello world",
+		"int8":    int8(9),
+		"int16":   int16(259),
+		"int32":   int32(222222222),
+		"int64":   int64(222222222222222222),
+		"float32": float32(3.14),
+		"float64": float64(6.4999),
+		"bool":    true,
+		"bytes":   []byte("one two three four"),
+		"null":    nil,
+	}
+
+	for k, v := range expected {
+		err := msg.SetProperty(k, v)
+		require.NoError(t, err)
+	}
+
+	headers, err := msg.EncodeHeaders()
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"2"}, headers["MQ-Version"])
+	require.Equal(t, []string{"MQSTR"}, headers["MQ-Format"])
+	require.Equal(t, []string{"6361666562616265"}, headers["MQ-MsgId"])
+	require.Equal(t, []string{"hello world"}, headers["MQ-Prop-string"])
+	require.Equal(t, []string{"int32"}, headers["MQ-PropType-int32"])
+	require.NotContains(t, headers, "MQ-PropType-string")
+	require.NotContains(t, headers, "MQ-CorrelId")
+	require.NotContains(t, headers, "MQ-Priority")
+
+	// other headers are ignored
+	headers["Nats-Msg-Id"] = []string{"abc"}
+
+	copy, err := DecodeHeaders(msg.Body, headers)
+	require.NoError(t, err)
+	require.Equal(t, msg.Body, copy.Body)
+	require.Equal(t, msg.Header, copy.Header)
+
+	for k, v := range expected {
+		actual, ok := copy.GetTypedProperty(k)
+		require.True(t, ok)
+		require.Equal(t, v, actual)
+	}
+	require.Len(t, copy.Properties, len(expected))
+}
+
+func TestDecodeHeadersWithoutTypes(t *testing.T) {
+	headers := map[string][]string{
+		"MQ-Prop-name": {"value"},
+		"MQ-Priority":  {"4"},
+	}
+
+	msg, err := DecodeHeaders(nil, headers)
+	require.NoError(t, err)
+	require.Equal(t, int32(4), msg.Header.Priority)
+
+	value, ok := msg.GetStringProperty("name")
+	require.True(t, ok)
+	require.Equal(t, "value", value)
+}
+
+func TestDecodeBadHeaders(t *testing.T) {
+	_, err := DecodeHeaders(nil, map[string][]string{"MQ-Priority": {"high"}})
+	require.Error(t, err)
+
+	_, err = DecodeHeaders(nil, map[string][]string{"MQ-MsgId": {"xyz"}})
+	require.Error(t, err)
+
+	_, err = DecodeHeaders(nil, map[string][]string{"MQ-Prop-a": {"x"}, "MQ-PropType-a": {"int8"}})
+	require.Error(t, err)
+
+	_, err = DecodeHeaders(nil, map[string][]string{"MQ-Prop-a": {"x"}, "MQ-PropType-a": {"uint8"}})
+	require.Error(t, err)
+}
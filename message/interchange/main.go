@@ -20,9 +20,11 @@ import (
 )
 
 var outputFile string
+var encoding string
 
 func main() {
 	flag.StringVar(&outputFile, "o", "", "output filepath")
+	flag.StringVar(&encoding, "e", message.EncodingMsgpack, "encoding, msgpack or json")
 	flag.Parse()
 
 	msg := message.NewBridgeMessage([]byte("hello world"))
@@ -51,7 +53,7 @@ func main() {
 		}
 	}
 
-	bytes, err := msg.Encode()
+	bytes, err := msg.EncodeWith(encoding)
 	if err != nil {
 		log.Fatalf("error - %s", err.Error())
 	}
@@ -61,5 +63,5 @@ func main() {
 		log.Fatalf("error - %s", err.Error())
 	}
 
-	log.Printf("wrote interchange file to %s", outputFile)
+	log.Printf("wrote %s interchange file to %s", encoding, outputFile)
 }
@@ -0,0 +1,201 @@
+// Copyright 2012-2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+const (
+	// EncodingMsgpack selects the msgpack wire format, this is the default
+	EncodingMsgpack = "msgpack"
+
+	// EncodingJSON selects the JSON wire format
+	EncodingJSON = "json"
+)
+
+// JSONFormatVersion is written into every JSON encoded message, decoding
+// fails for any other version
+const JSONFormatVersion = 1
+
+// jsonProperty is the JSON form of a property, the value is kept raw
+// so it can be decoded based on the type
+type jsonProperty struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// jsonBridgeMessage is the JSON form of a bridge message
+// []byte fields, including the body, are base64 encoded by encoding/json
+type jsonBridgeMessage struct {
+	Version    int                     `json:"version"`
+	Body       []byte                  `json:"body,omitempty"`
+	Header     BridgeHeader            `json:"header"`
+	Properties map[string]jsonProperty `json:"props,omitempty"`
+}
+
+// EncodeWith encodes the message using the named encoding, an empty encoding
+// is treated as msgpack
+func (msg *BridgeMessage) EncodeWith(encoding string) ([]byte, error) {
+	switch encoding {
+	case "", EncodingMsgpack:
+		return msg.Encode()
+	case EncodingJSON:
+		return msg.EncodeJSON()
+	default:
+		return nil, fmt.Errorf("unknown message encoding %q", encoding)
+	}
+}
+
+// DecodeBridgeMessageWith decodes the bytes using the named encoding, an empty encoding
+// is treated as msgpack
+func DecodeBridgeMessageWith(data []byte, encoding string) (*BridgeMessage, error) {
+	switch encoding {
+	case "", EncodingMsgpack:
+		return DecodeBridgeMessage(data)
+	case EncodingJSON:
+		return DecodeJSONBridgeMessage(data)
+	default:
+		return nil, fmt.Errorf("unknown message encoding %q", encoding)
+	}
+}
+
+// EncodeJSON encodes a bridge message as JSON
+// Properties are written as {"type": <name>, "value": <value>} so the type survives
+// the round trip. int64 values are written as strings to avoid precision loss in
+// clients that only have 64 bit floats, bytes values are base64 encoded.
+func (msg *BridgeMessage) EncodeJSON() ([]byte, error) {
+	jmsg := jsonBridgeMessage{
+		Version: JSONFormatVersion,
+		Body:    msg.Body,
+		Header:  msg.Header,
+	}
+
+	if len(msg.Properties) > 0 {
+		jmsg.Properties = make(map[string]jsonProperty, len(msg.Properties))
+	}
+
+	for name, prop := range msg.Properties {
+		typeName, ok := propertyTypeNames[prop.Type]
+		if !ok {
+			return nil, fmt.Errorf("can't encode property %s with unknown type %d", name, prop.Type)
+		}
+
+		value, ok := msg.GetTypedProperty(name)
+		if !ok {
+			return nil, fmt.Errorf("broken message property %s", name)
+		}
+
+		if prop.Type == PropertyTypeInt64 {
+			value = strconv.FormatInt(value.(int64), 10)
+		}
+
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		jmsg.Properties[name] = jsonProperty{
+			Type:  typeName,
+			Value: raw,
+		}
+	}
+
+	return json.Marshal(jmsg)
+}
+
+// DecodeJSONBridgeMessage decodes a JSON encoded bridge message, the version
+// in the message must match JSONFormatVersion
+func DecodeJSONBridgeMessage(data []byte) (*BridgeMessage, error) {
+	if data == nil {
+		return nil, fmt.Errorf("attempt to decode bridge message of zero length")
+	}
+
+	jmsg := jsonBridgeMessage{}
+	err := json.Unmarshal(data, &jmsg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if jmsg.Version != JSONFormatVersion {
+		return nil, fmt.Errorf("unsupported JSON bridge message version %d", jmsg.Version)
+	}
+
+	msg := NewBridgeMessage(jmsg.Body)
+	msg.Header = jmsg.Header
+
+	for name, prop := range jmsg.Properties {
+		value, err := decodeJSONProperty(prop)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding property %s, %s", name, err.Error())
+		}
+
+		err = msg.SetProperty(name, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return msg, nil
+}
+
+// decodeJSONProperty returns the value with the go type that matches the property type
+func decodeJSONProperty(prop jsonProperty) (interface{}, error) {
+	switch prop.Type {
+	case "string":
+		var v string
+		err := json.Unmarshal(prop.Value, &v)
+		return v, err
+	case "int8":
+		var v int8
+		err := json.Unmarshal(prop.Value, &v)
+		return v, err
+	case "int16":
+		var v int16
+		err := json.Unmarshal(prop.Value, &v)
+		return v, err
+	case "int32":
+		var v int32
+		err := json.Unmarshal(prop.Value, &v)
+		return v, err
+	case "int64":
+		var v string
+		if err := json.Unmarshal(prop.Value, &v); err != nil {
+			return nil, err
+		}
+		return strconv.ParseInt(v, 10, 64)
+	case "float32":
+		var v float32
+		err := json.Unmarshal(prop.Value, &v)
+		return v, err
+	case "float64":
+		var v float64
+		err := json.Unmarshal(prop.Value, &v)
+		return v, err
+	case "bool":
+		var v bool
+		err := json.Unmarshal(prop.Value, &v)
+		return v, err
+	case "bytes":
+		var v []byte
+		err := json.Unmarshal(prop.Value, &v)
+		return v, err
+	case "null":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown property type %q", prop.Type)
+	}
+}
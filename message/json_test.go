@@ -0,0 +1,165 @@
+// Copyright 2012-2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package message
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONEncodeDecode(t *testing.T) {
+	msg := NewBridgeMessage([]byte("hello world"))
+	msg.Header = BridgeHeader{
+		Version: 1,
+		Report:  2,
+		MsgID:   []byte("cafebabe"),
+	}
+
+	encoded, err := msg.EncodeJSON()
+	require.NoError(t, err)
+
+	copy, err := DecodeJSONBridgeMessage(encoded)
+	require.NoError(t, err)
+	require.Equal(t, msg.Body, copy.Body)
+	require.Equal(t, msg.Header.Version, copy.Header.Version)
+	require.Equal(t, msg.Header.Report, copy.Header.Report)
+	require.Equal(t, msg.Header.MsgID, copy.Header.MsgID)
+
+	// bytes are base64 and the version is explicit
+	raw := map[string]interface{}{}
+	err = json.Unmarshal(encoded, &raw)
+	require.NoError(t, err)
+	require.Equal(t, float64(JSONFormatVersion), raw["version"])
+	require.Equal(t, "aGVsbG8gd29ybGQ=", raw["body"])
+}
+
+func TestJSONPropertyTypes(t *testing.T) {
+	msg := NewBridgeMessage([]byte("hello world"))
+
+	expected := map[string]interface{}{
+		"string":  "hello world",
+		"int8":    int8(9),
+		"int16":   int16(259),
+		"int32":   int32(222222222),
+		"int64":   int64(222222222222222222),
+		"float32": float32(3.14),
+		"float64": float64(6.4999),
+		"bool":    true,
+		"bytes":   []byte("one two three four"),
+		"null":    nil,
+	}
+
+	for k, v := range expected {
+		err := msg.SetProperty(k, v)
+		require.NoError(t, err)
+	}
+
+	encoded, err := msg.EncodeJSON()
+	require.NoError(t, err)
+
+	copy, err := DecodeJSONBridgeMessage(encoded)
+	require.NoError(t, err)
+
+	for k, v := range expected {
+		actual, ok := copy.GetTypedProperty(k)
+		require.True(t, ok)
+		require.Equal(t, v, actual)
+		require.Equal(t, msg.Properties[k].Type, copy.Properties[k].Type)
+	}
+}
+
+func TestJSONBadDecode(t *testing.T) {
+	_, err := DecodeJSONBridgeMessage(nil)
+	require.Error(t, err)
+
+	_, err = DecodeJSONBridgeMessage([]byte("hello world"))
+	require.Error(t, err)
+
+	_, err = DecodeJSONBridgeMessage([]byte(`{"body":"aGVsbG8gd29ybGQ="}`))
+	require.Error(t, err)
+
+	_, err = DecodeJSONBridgeMessage([]byte(`{"version":2}`))
+	require.Error(t, err)
+
+	_, err = DecodeJSONBridgeMessage([]byte(`{"version":1,"props":{"a":{"type":"int8","value":"hello"}}}`))
+	require.Error(t, err)
+
+	_, err = DecodeJSONBridgeMessage([]byte(`{"version":1,"props":{"a":{"type":"int64","value":12}}}`))
+	require.Error(t, err)
+
+	_, err = DecodeJSONBridgeMessage([]byte(`{"version":1,"props":{"a":{"type":"uint8","value":12}}}`))
+	require.Error(t, err)
+}
+
+func TestJSONUnknownTypeOnEncode(t *testing.T) {
+	msg := NewBridgeMessage(nil)
+	msg.Properties["test"] = Property{
+		Type:  -1,
+		Value: []int{1, 2, 3},
+	}
+	_, err := msg.EncodeJSON()
+	require.Error(t, err)
+}
+
+func TestEncodeWith(t *testing.T) {
+	msg := NewBridgeMessage([]byte("hello world"))
+
+	for _, encoding := range []string{"", EncodingMsgpack, EncodingJSON} {
+		encoded, err := msg.EncodeWith(encoding)
+		require.NoError(t, err)
+
+		copy, err := DecodeBridgeMessageWith(encoded, encoding)
+		require.NoError(t, err)
+		require.Equal(t, msg.Body, copy.Body)
+	}
+
+	_, err := msg.EncodeWith("xml")
+	require.Error(t, err)
+
+	_, err = DecodeBridgeMessageWith([]byte("hello world"), "xml")
+	require.Error(t, err)
+}
+
+func TestJSONMessageInterchange(t *testing.T) {
+	encoded, err := ioutil.ReadFile("../resources/interchange.json")
+	require.NoError(t, err)
+
+	msg, err := DecodeJSONBridgeMessage(encoded)
+	require.NoError(t, err)
+
+	expected := map[string]interface{}{
+		"string":  "hello world",
+		"int8":    int8(9),
+		"int16":   int16(259),
+		"int32":   int32(222222222),
+		"int64":   int64(222222222222222222),
+		"float32": float32(3.14),
+		"float64": float64(6.4999),
+		"bool":    true,
+		"bytes":   []byte("one two three four"),
+	}
+
+	for k, v := range expected {
+		actual, ok := msg.GetTypedProperty(k)
+		require.True(t, ok)
+		require.Equal(t, v, actual)
+	}
+
+	require.Equal(t, "hello world", string(msg.Body))
+	require.Equal(t, int32(1), msg.Header.Version)
+	require.Equal(t, int32(2), msg.Header.Report)
+	require.Equal(t, "cafebabe", string(msg.Header.MsgID))
+}
@@ -59,37 +59,52 @@ const (
 	PropertyTypeNull = 9
 )
 
+// propertyTypeNames maps the property type values to the names used in JSON and NATS headers
+var propertyTypeNames = map[int]string{
+	PropertyTypeString:  "string",
+	PropertyTypeInt8:    "int8",
+	PropertyTypeInt16:   "int16",
+	PropertyTypeInt32:   "int32",
+	PropertyTypeInt64:   "int64",
+	PropertyTypeFloat32: "float32",
+	PropertyTypeFloat64: "float64",
+	PropertyTypeBool:    "bool",
+	PropertyTypeBytes:   "bytes",
+	PropertyTypeNull:    "null",
+}
+
 // BridgeHeader maps to an MQMD struct in the MQ messages
 type BridgeHeader struct {
-	Version          int32  `codec:"version,omitempty"`
-	Report           int32  `codec:"report,omitempty"`
-	MsgType          int32  `codec:"type,omitempty"`
-	Expiry           int32  `codec:"exp,omitempty"`
-	Feedback         int32  `codec:"feed,omitempty"`
-	Encoding         int32  `codec:"enc,omitempty"`
-	CodedCharSetID   int32  `codec:"charset,omitempty"`
-	Format           string `codec:"format,omitempty"`
-	Priority         int32  `codec:"priority,omitempty"`
-	Persistence      int32  `codec:"persist,omitempty"`
-	MsgID            []byte `codec:"msg_id,omitempty"`
-	CorrelID         []byte `codec:"corr_id,omitempty"`
-	BackoutCount     int32  `codec:"backout,omitempty"`
-	ReplyToQ         string `codec:"rep_q,omitempty"`
-	ReplyToQMgr      string `codec:"rep_qmgr,omitempty"`
-	UserIdentifier   string `codec:"user_id,omitempty"`
-	AccountingToken  []byte `codec:"acct_token,omitempty"`
-	ApplIdentityData string `codec:"appl_id,omitempty"`
-	PutApplType      int32  `codec:"appl_type,omitempty"`
-	PutApplName      string `codec:"appl_name,omitempty"`
-	PutDate          string `codec:"date,omitempty"`
-	PutTime          string `codec:"time,omitempty"`
-	ApplOriginData   string `codec:"appl_orig_data,omitempty"`
-	GroupID          []byte `codec:"grp_id,omitempty"`
-	MsgSeqNumber     int32  `codec:"seq,omitempty"`
-	Offset           int32  `codec:"offset,omitempty"`
-	MsgFlags         int32  `codec:"flags,omitempty"`
-	OriginalLength   int32  `codec:"orig_length,omitempty"`
-	ReplyToChannel   string `codec:"reply_to_channel,omitempty"`
+	Version          int32  `codec:"version,omitempty" json:"version,omitempty"`
+	Report           int32  `codec:"report,omitempty" json:"report,omitempty"`
+	MsgType          int32  `codec:"type,omitempty" json:"type,omitempty"`
+	Expiry           int32  `codec:"exp,omitempty" json:"exp,omitempty"`
+	Feedback         int32  `codec:"feed,omitempty" json:"feed,omitempty"`
+	Encoding         int32  `codec:"enc,omitempty" json:"enc,omitempty"`
+	CodedCharSetID   int32  `codec:"charset,omitempty" json:"charset,omitempty"`
+	Format           string `codec:"format,omitempty" json:"format,omitempty"`
+	Priority         int32  `codec:"priority,omitempty" json:"priority,omitempty"`
+	Persistence      int32  `codec:"persist,omitempty" json:"persist,omitempty"`
+	MsgID            []byte `codec:"msg_id,omitempty" json:"msg_id,omitempty"`
+	CorrelID         []byte `codec:"corr_id,omitempty" json:"corr_id,omitempty"`
+	BackoutCount     int32  `codec:"backout,omitempty" json:"backout,omitempty"`
+	ReplyToQ         string `codec:"rep_q,omitempty" json:"rep_q,omitempty"`
+	ReplyToQMgr      string `codec:"rep_qmgr,omitempty" json:"rep_qmgr,omitempty"`
+	UserIdentifier   string `codec:"user_id,omitempty" json:"user_id,omitempty"`
+	AccountingToken  []byte `codec:"acct_token,omitempty" json:"acct_token,omitempty"`
+	ApplIdentityData string `codec:"appl_id,omitempty" json:"appl_id,omitempty"`
+	PutApplType      int32  `codec:"appl_type,omitempty" json:"appl_type,omitempty"`
+	PutApplName      string `codec:"appl_name,omitempty" json:"appl_name,omitempty"`
+	PutDate          string `codec:"date,omitempty" json:"date,omitempty"`
+	PutTime          string `codec:"time,omitempty" json:"time,omitempty"`
+	ApplOriginData   string `codec:"appl_orig_data,omitempty" json:"appl_orig_data,omitempty"`
+	GroupID          []byte `codec:"grp_id,omitempty" json:"grp_id,omitempty"`
+	MsgSeqNumber     int32  `codec:"seq,omitempty" json:"seq,omitempty"`
+	Offset           int32  `codec:"offset,omitempty" json:"offset,omitempty"`
+	MsgFlags         int32  `codec:"flags,omitempty" json:"flags,omitempty"`
+	OriginalLength   int32  `codec:"orig_length,omitempty" json:"orig_length,omitempty"`
+	ReplyToChannel   string `codec:"reply_to_channel,omitempty" json:"reply_to_channel,omitempty"`
+	ExpiresAt        int64  `codec:"expires_at,omitempty" json:"expires_at,omitempty"` // unix milliseconds, set from the Expiry
 }
 
 // Property wraps a typed property to allow proper round/trip support
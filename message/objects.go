@@ -0,0 +1,107 @@
+// Copyright 2012-2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package message
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// ObjectReferenceMagic starts the payload of a message that refers to a body in a JetStream object store
+// the magic is followed by the JSON encoded ObjectReference
+const ObjectReferenceMagic = "NMQOBJREF"
+
+// ObjectReference is published in place of a large payload, the payload, an encoded bridge message
+// or a plain body, is stored in the named object store bucket
+type ObjectReference struct {
+	Bucket string `json:"bucket"`
+	Name   string `json:"name"`
+	Size   uint64 `json:"size"`
+	Digest string `json:"digest,omitempty"`
+}
+
+// IsObjectReference returns true if the data starts with the object reference magic
+func IsObjectReference(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ObjectReferenceMagic))
+}
+
+// Encode writes the magic followed by the reference as JSON
+func (ref *ObjectReference) Encode() ([]byte, error) {
+	if ref.Bucket == "" || ref.Name == "" {
+		return nil, fmt.Errorf("object references require a bucket and name")
+	}
+
+	encoded, err := json.Marshal(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(ObjectReferenceMagic), encoded...), nil
+}
+
+// DecodeObjectReference reads a reference written by Encode
+func DecodeObjectReference(data []byte) (*ObjectReference, error) {
+	if !IsObjectReference(data) {
+		return nil, fmt.Errorf("data is not an object reference")
+	}
+
+	ref := &ObjectReference{}
+	err := json.Unmarshal(data[len(ObjectReferenceMagic):], ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if ref.Bucket == "" || ref.Name == "" {
+		return nil, fmt.Errorf("object reference is missing the bucket or name")
+	}
+
+	return ref, nil
+}
+
+// ResolveObjectReference returns the payload a reference points to, data that isn't a reference
+// is returned unchanged. The result can be passed to DecodeBridgeMessage, or used as the body,
+// depending on how the bridge connector is configured.
+func ResolveObjectReference(js nats.JetStreamContext, data []byte) ([]byte, error) {
+	if !IsObjectReference(data) {
+		return data, nil
+	}
+
+	ref, err := DecodeObjectReference(data)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := js.ObjectStore(ref.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open object store %s, %s", ref.Bucket, err.Error())
+	}
+
+	return ref.Get(store)
+}
+
+// Get reads the referenced payload from the store and checks the size
+func (ref *ObjectReference) Get(store nats.ObjectStore) ([]byte, error) {
+	payload, err := store.GetBytes(ref.Name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read object %s from %s, %s", ref.Name, ref.Bucket, err.Error())
+	}
+
+	if uint64(len(payload)) != ref.Size {
+		return nil, fmt.Errorf("object %s in %s has %d bytes, expected %d", ref.Name, ref.Bucket, len(payload), ref.Size)
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2012-2019 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package message
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	nst "github.com/nats-io/nats-server/v2/test"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObjectReferenceEncoding(t *testing.T) {
+	ref := ObjectReference{
+		Bucket: "bucket",
+		Name:   "name",
+		Size:   10,
+	}
+
+	encoded, err := ref.Encode()
+	require.NoError(t, err)
+	require.True(t, IsObjectReference(encoded))
+
+	copy, err := DecodeObjectReference(encoded)
+	require.NoError(t, err)
+	require.Equal(t, ref, *copy)
+
+	_, err = DecodeObjectReference([]byte("hello world"))
+	require.Error(t, err)
+
+	_, err = DecodeObjectReference([]byte(ObjectReferenceMagic + "{}"))
+	require.Error(t, err)
+
+	_, err = DecodeObjectReference([]byte(ObjectReferenceMagic + "{"))
+	require.Error(t, err)
+
+	_, err = (&ObjectReference{Bucket: "bucket"}).Encode()
+	require.Error(t, err)
+}
+
+func TestResolveObjectReference(t *testing.T) {
+	dir, err := ioutil.TempDir("", "message-js")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	opts := nst.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = dir
+	server := nst.RunServer(&opts)
+	defer server.Shutdown()
+
+	nc, err := nats.Connect(server.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+
+	js, err := nc.JetStream()
+	require.NoError(t, err)
+
+	store, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: "test"})
+	require.NoError(t, err)
+
+	payload := bytes.Repeat([]byte("0123456789"), 1000)
+	info, err := store.PutBytes("big", payload)
+	require.NoError(t, err)
+
+	ref := ObjectReference{
+		Bucket: "test",
+		Name:   info.Name,
+		Size:   info.Size,
+		Digest: info.Digest,
+	}
+	encoded, err := ref.Encode()
+	require.NoError(t, err)
+
+	resolved, err := ResolveObjectReference(js, encoded)
+	require.NoError(t, err)
+	require.Equal(t, payload, resolved)
+
+	// other data is passed through
+	resolved, err = ResolveObjectReference(js, []byte("hello world"))
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(resolved))
+
+	ref.Size = 5
+	encoded, err = ref.Encode()
+	require.NoError(t, err)
+	_, err = ResolveObjectReference(js, encoded)
+	require.Error(t, err)
+
+	ref.Bucket = "missing"
+	encoded, err = ref.Encode()
+	require.NoError(t, err)
+	_, err = ResolveObjectReference(js, encoded)
+	require.Error(t, err)
+}
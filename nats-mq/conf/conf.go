@@ -15,6 +15,7 @@ package conf
 
 import (
 	"github.com/nats-io/nats-mq/nats-mq/logging"
+	"github.com/nats-io/nats-mq/nats-mq/tracing"
 	stan "github.com/nats-io/stan.go"
 )
 
@@ -42,6 +43,24 @@ const Stan2Topic = "Stan2Topic"
 // NATS2Topic type for a nats to mq topic connector
 const NATS2Topic = "NATS2Topic"
 
+// MessageGroupsMessage publishes each MQ message group as a single NATS message
+const MessageGroupsMessage = "message"
+
+// MessageGroupsBatch publishes the messages in an MQ message group in order, followed by a completion marker
+const MessageGroupsBatch = "batch"
+
+// PutContextIdentity puts messages to MQ with the identity context from the message header
+const PutContextIdentity = "identity"
+
+// PutContextAll puts messages to MQ with the identity and origin context from the message header
+const PutContextAll = "all"
+
+// PersistencePersistent matches or sets persistent MQ messages
+const PersistencePersistent = "persistent"
+
+// PersistenceNonPersistent matches or sets non-persistent MQ messages
+const PersistenceNonPersistent = "nonpersistent"
+
 // BridgeConfig holds the server configuration
 type BridgeConfig struct {
 	ReconnectInterval int // milliseconds
@@ -51,6 +70,7 @@ type BridgeConfig struct {
 
 	Logging    logging.Config
 	Monitoring MonitoringConfig
+	Tracing    tracing.Config
 
 	Connect []ConnectorConfig
 }
@@ -93,6 +113,14 @@ type MonitoringConfig struct {
 	HTTPPort  int
 	HTTPSPort int
 	TLS       TLSConf
+
+	// monitoring over NATS doesn't need the HTTP port, "" (the default) turns each subject off
+	StatsSubject   string // the stats are published to this subject every stats interval
+	StatsInterval  int    // ms between stats, defaults to 10000
+	EventsSubject  string // connector and connection events are published to this subject
+	VarzSubject    string // requests are answered with the stats
+	HealthzSubject string // requests are answered with a status, like the liveness check
+	ReadyzSubject  string // requests are answered with the readiness check
 }
 
 // MQConfig configuration for an MQ Connection
@@ -133,6 +161,16 @@ type NATSStreamingConfig struct {
 	ConnectWait        int // milliseconds
 }
 
+// RouteConfig picks the destination for MQ messages by their priority and persistence
+type RouteConfig struct {
+	Priority    string // "" matches any priority, otherwise a priority, like "9", or a range, like "5-9"
+	Persistence string // "" matches any persistence, otherwise "persistent" or "nonpersistent"
+
+	Subject   string // the NATS subject to publish matching messages to
+	JetStream bool   // publish to the subject with JetStream and wait for the ack
+	Channel   string // the streaming channel to publish matching messages to, exclusive with subject
+}
+
 // ConnectorConfig configuration for a bridge connection (of any type)
 type ConnectorConfig struct {
 	ID   string // user specified id for a connector, will be defaulted if none is provided
@@ -150,9 +188,69 @@ type ConnectorConfig struct {
 	Topic string   // Used for the mq side of things
 	Queue string
 
+	ExcludeHeaders bool   //exclude headers, and just send the body to/from nats messages
+	NATSHeaders    bool   // map the MQMD and properties to/from NATS message headers, not for streaming
+	Encoding       string // wire format for messages with headers, "msgpack" (the default) or "json"
+
+	CCSID int  // coded character set for message bodies, 0 (the default) disables conversion
+	RFH2  bool // put messages with an MQRFH2 header for JMS consumers, and remove RFH2 headers on get
+
 	UsePolling          bool // use polling vs callbacks when listening to MQ (the default is callbacks)
 	IncomingBufferSize  int  // buffer size for polling
 	IncomingMessageWait int  // wait time for polling in ms
 
-	ExcludeHeaders bool //exclude headers, and just send the body to/from nats messages
+	MaxBufferSize int    // largest buffer used to get a message from MQ, defaults to 100MB
+	PoisonQueue   string // Optional, messages larger than the max buffer size are moved here
+
+	MessageGroups string // "message" or "batch" to reassemble MQ message groups, "" (the default) gets messages one by one
+	MaxGroupSize  int    // bytes held for a group published as one message, defaults to 100MB
+
+	Chunking         bool  // split payloads larger than the NATS max payload into chunks, and reassemble them
+	MaxChunkSize     int   // bytes per chunk, 0 (the default) uses the max payload from the NATS server
+	ChunkTimeout     int   // ms to wait for the rest of a chunked message, defaults to 30000
+	ChunkMemoryLimit int64 // bytes held for incomplete chunked messages, defaults to 64MB
+
+	ObjectStore          bool   // offload large payloads to a JetStream object store
+	ObjectStoreThreshold int    // bytes, payloads larger than this are offloaded, defaults to 1MB
+	ObjectStoreBucket    string // the bucket, created if it doesn't exist, defaults to "nats-mq"
+	ObjectStoreTTL       int    // ms to keep offloaded payloads in a bucket created by the bridge, defaults to 24 hours
+
+	RequestReply    bool   // bridge NATS requests to MQ and publish the MQ replies to the request's inbox
+	ReplyQueue      string // a shared queue for replies, it should only be read by this connector
+	ReplyModelQueue string // the model queue for a dynamic reply queue, defaults to SYSTEM.DEFAULT.MODEL.QUEUE
+	RequestTimeout  int    // ms to wait for a reply, defaults to 30000
+
+	Service             bool   // call a NATS service for each MQ message and put the response to its ReplyToQ
+	ServiceTimeout      int    // ms to wait for the NATS response, defaults to 30000
+	ServiceTimeoutReply string // the body of the reply on timeout, "" (the default) backs out the message instead
+
+	Reports bool // honour the COA, COD and exception report options of messages from MQ
+
+	Expiry int // ms, default expiry for messages put to MQ without one, 0 (the default) is unlimited
+
+	NATSMsgID         bool   // set the Nats-Msg-Id header on messages from MQ
+	NATSMsgIDProperty string // Optional, a property to use for the Nats-Msg-Id instead of the MsgId
+
+	DedupeWindow int    // ms to remember the Nats-Msg-Id of messages put to MQ, 0 (the default) turns dedupe off
+	DedupeSize   int    // the most IDs to remember, the oldest are forgotten first, defaults to 10000
+	DedupeBucket string // Optional, a KV bucket to store the IDs in so they survive restarts
+
+	PutContext      string // "identity" or "all" to put messages with the context in the message header
+	CopyPersistence bool   // put messages with the persistence in the message header instead of the destination's default
+
+	Routes []RouteConfig // Optional, publish messages from MQ to a subject or channel chosen by priority and persistence
+
+	PriorityHeader    string // Optional, NATS header used to set the MQ priority
+	PersistenceHeader string // Optional, NATS header used to set the MQ persistence
+
+	Critical bool // fail the readiness check while this connector is waiting to reconnect
+
+	BacklogInterval int // ms between backlog checks, 0 (the default) turns them off, at least 2000 for streaming
+	DepthWarning    int // messages on the queue
+	AgeWarning      int // ms since the first message on the queue was put
+	LagWarning      int // messages on the channel after the last one acked
+
+	LatencyProperty string // Optional, a property to stamp with the source latency in ms
+
+	LogLevel string // Optional, overrides the logging level for the connector
 }
@@ -0,0 +1,306 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	stan "github.com/nats-io/stan.go"
+)
+
+// channelCheckWait is how long the first check waits for the last message on a channel, if none arrives
+// the channel is empty, it is also the shortest backlog interval for connectors that read from a channel
+const channelCheckWait = 2 * time.Second
+
+// backlog holds the result of one check of the connector's source
+type backlog struct {
+	queueDepth       int64
+	oldestMessageAge int64 // milliseconds
+	channelSequence  uint64
+}
+
+// backlogMonitor periodically checks how far behind the connector is, it uses its own MQ connection
+// because the connector's connection is busy with the listener
+type backlogMonitor struct {
+	lastSequence uint64 // the last sequence seen on the channel, first for atomic access
+
+	done       chan bool
+	qMgr       *ibmmq.MQQueueManager
+	queue      *ibmmq.MQObject
+	channelSub stan.Subscription // follows the channel from the last message, kept open between checks
+}
+
+// validateBacklog checks the backlog interval and warnings, and that the source can be checked
+func validateBacklog(config conf.ConnectorConfig) error {
+	if config.BacklogInterval < 0 || config.DepthWarning < 0 || config.AgeWarning < 0 || config.LagWarning < 0 {
+		return fmt.Errorf("backlog interval and warnings can't be negative")
+	}
+
+	if config.BacklogInterval > 0 {
+		switch config.Type {
+		case conf.Queue2NATS, conf.Queue2Stan, conf.Stan2Queue, conf.Stan2Topic:
+		default:
+			return fmt.Errorf("backlog monitoring is only supported by connectors that read from an MQ queue or a streaming channel")
+		}
+	} else if config.DepthWarning > 0 || config.AgeWarning > 0 || config.LagWarning > 0 {
+		return fmt.Errorf("backlog warnings require a backlog interval")
+	}
+
+	minInterval := int(channelCheckWait / time.Millisecond)
+	if (config.Type == conf.Stan2Queue || config.Type == conf.Stan2Topic) && config.BacklogInterval > 0 && config.BacklogInterval < minInterval {
+		return fmt.Errorf("backlog interval %d is shorter than the %dms a channel check can take", config.BacklogInterval, minInterval)
+	}
+
+	return nil
+}
+
+// monitorsBacklog returns true if the connector has a backlog interval and reads from a source that can be checked
+func monitorsBacklog(config conf.ConnectorConfig) bool {
+	if config.BacklogInterval <= 0 {
+		return false
+	}
+	switch config.Type {
+	case conf.Queue2NATS, conf.Queue2Stan, conf.Stan2Queue, conf.Stan2Topic:
+		return true
+	default:
+		return false
+	}
+}
+
+// startBacklogMonitor starts checking the source every backlog interval - expects the lock to be held
+func (mq *BridgeConnector) startBacklogMonitor() {
+	if !monitorsBacklog(mq.config) || mq.backlog != nil {
+		return
+	}
+
+	monitor := &backlogMonitor{
+		done: make(chan bool),
+	}
+	mq.backlog = monitor
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(mq.config.BacklogInterval) * time.Millisecond)
+		defer ticker.Stop()
+		defer monitor.close()
+
+		for {
+			select {
+			case <-monitor.done:
+				return
+			case <-ticker.C:
+			}
+
+			current, err := mq.checkBacklog(monitor)
+
+			select {
+			case <-monitor.done:
+				return
+			default:
+			}
+
+			if err != nil {
+				mq.Logger().Noticef("backlog check failed for %s, %s", mq.String(), err.Error())
+				monitor.close() // reconnect on the next check
+				continue
+			}
+
+			mq.Lock()
+			mq.stats.setBacklog(current)
+			warning := backlogWarning(mq.config, mq.stats)
+			if warning != "" && mq.stats.BacklogWarning == "" {
+				mq.Logger().Noticef("%s is falling behind, %s", mq.String(), warning)
+			}
+			mq.stats.BacklogWarning = warning
+			mq.Unlock()
+		}
+	}()
+}
+
+// stopBacklogMonitor stops the checks, the monitor closes its MQ connection when it exits - expects the lock to be held
+func (mq *BridgeConnector) stopBacklogMonitor() {
+	if mq.backlog == nil {
+		return
+	}
+	close(mq.backlog.done)
+	mq.backlog = nil
+}
+
+// checkBacklog checks the source queue or channel, the lock isn't held since the checks can block
+func (mq *BridgeConnector) checkBacklog(monitor *backlogMonitor) (backlog, error) {
+	switch mq.config.Type {
+	case conf.Stan2Queue, conf.Stan2Topic:
+		seq, err := monitor.channelLastSequence(mq.bridge.Stan(), mq.config.Channel)
+		return backlog{channelSequence: seq}, err
+	default:
+		return monitor.checkQueue(mq.config)
+	}
+}
+
+// checkQueue inquires the depth of the source queue and browses the first message for its age
+func (monitor *backlogMonitor) checkQueue(config conf.ConnectorConfig) (backlog, error) {
+	current := backlog{}
+
+	if monitor.queue == nil {
+		qMgr, err := ConnectToQueueManager(config.MQ)
+		if err != nil {
+			return current, err
+		}
+		monitor.qMgr = qMgr
+
+		mqod := ibmmq.NewMQOD()
+		mqod.ObjectType = ibmmq.MQOT_Q
+		mqod.ObjectName = config.Queue
+
+		queue, err := qMgr.Open(mqod, ibmmq.MQOO_INQUIRE|ibmmq.MQOO_BROWSE|ibmmq.MQOO_FAIL_IF_QUIESCING)
+		if err != nil {
+			return current, err
+		}
+		monitor.queue = &queue
+	}
+
+	attrs, err := monitor.queue.Inq([]int32{ibmmq.MQIA_CURRENT_Q_DEPTH})
+	if err != nil {
+		return current, err
+	}
+
+	if depth, ok := attrs[ibmmq.MQIA_CURRENT_Q_DEPTH].(int32); ok {
+		current.queueDepth = int64(depth)
+	}
+
+	if current.queueDepth == 0 {
+		return current, nil
+	}
+
+	mqmd := ibmmq.NewMQMD()
+	gmo := ibmmq.NewMQGMO()
+	gmo.Options = ibmmq.MQGMO_BROWSE_FIRST | ibmmq.MQGMO_NO_WAIT | ibmmq.MQGMO_ACCEPT_TRUNCATED_MSG | ibmmq.MQGMO_FAIL_IF_QUIESCING
+
+	_, err = monitor.queue.Get(mqmd, gmo, nil)
+	if err != nil {
+		mqret, ok := err.(*ibmmq.MQReturn)
+		if !ok {
+			return current, err
+		}
+		switch mqret.MQRC {
+		case ibmmq.MQRC_TRUNCATED_MSG_ACCEPTED:
+		case ibmmq.MQRC_NO_MSG_AVAILABLE:
+			return current, nil // the messages were read, or are in a unit of work
+		default:
+			return current, err
+		}
+	}
+
+	// the age is only available if the message has a put date and time
+	if putTime, err := parsePutTime(mqmd.PutDate, mqmd.PutTime); err == nil {
+		if age := time.Since(putTime); age > 0 {
+			current.oldestMessageAge = int64(age / time.Millisecond)
+		}
+	}
+
+	return current, nil
+}
+
+// close closes the monitor's queue and MQ connection, if they are open
+func (monitor *backlogMonitor) close() {
+	if monitor.queue != nil {
+		monitor.queue.Close(0) // ignore the error
+		monitor.queue = nil
+	}
+	if monitor.qMgr != nil {
+		monitor.qMgr.Disc() // ignore the error
+		monitor.qMgr = nil
+	}
+	if monitor.channelSub != nil {
+		monitor.channelSub.Unsubscribe() // ignore the error
+		monitor.channelSub = nil
+	}
+}
+
+// channelLastSequence returns the sequence of the last message on the channel, or 0 if it is empty
+// The first check subscribes from the last message, and waits for it, the subscription is kept open
+// so later checks read the last sequence it has seen without waiting
+func (monitor *backlogMonitor) channelLastSequence(sc stan.Conn, channel string) (uint64, error) {
+	if monitor.channelSub == nil {
+		if sc == nil {
+			return 0, fmt.Errorf("bridge not connected to NATS streaming")
+		}
+
+		first := make(chan bool, 1)
+		sub, err := sc.Subscribe(channel, func(msg *stan.Msg) {
+			if msg.Sequence > atomic.LoadUint64(&monitor.lastSequence) {
+				atomic.StoreUint64(&monitor.lastSequence, msg.Sequence)
+			}
+			select {
+			case first <- true:
+			default:
+			}
+		}, stan.StartWithLastReceived())
+
+		if err != nil {
+			return 0, err
+		}
+		monitor.channelSub = sub
+
+		select {
+		case <-first:
+		case <-time.After(channelCheckWait):
+		}
+	}
+
+	return atomic.LoadUint64(&monitor.lastSequence), nil
+}
+
+// ackMessages acks the messages from a channel and remembers the highest sequence acked - expects the lock to be held
+func (mq *BridgeConnector) ackMessages(acks []*stan.Msg) {
+	for _, ack := range acks {
+		ack.Ack()
+		if ack.Sequence > mq.stats.AckedSequence {
+			mq.stats.AckedSequence = ack.Sequence
+		}
+	}
+}
+
+// backlogWarning returns a description of the first threshold the stats are over, or "" if there isn't one
+func backlogWarning(config conf.ConnectorConfig, stats ConnectorStats) string {
+	if config.DepthWarning > 0 && stats.QueueDepth > int64(config.DepthWarning) {
+		return fmt.Sprintf("queue depth %d is over %d", stats.QueueDepth, config.DepthWarning)
+	}
+	if config.AgeWarning > 0 && stats.OldestMessageAge > int64(config.AgeWarning) {
+		return fmt.Sprintf("oldest message age %dms is over %dms", stats.OldestMessageAge, config.AgeWarning)
+	}
+	if config.LagWarning > 0 && stats.ChannelLag > int64(config.LagWarning) {
+		return fmt.Sprintf("channel lag %d is over %d", stats.ChannelLag, config.LagWarning)
+	}
+	return ""
+}
+
+// parsePutTime parses an MQ put date, YYYYMMDD, and put time, HHMMSSTH, which are in GMT
+func parsePutTime(putDate string, putTime string) (time.Time, error) {
+	putDate = strings.TrimSpace(putDate)
+	putTime = strings.TrimSpace(putTime)
+
+	if len(putDate) != 8 || len(putTime) != 8 {
+		return time.Time{}, fmt.Errorf("invalid put date %q and time %q", putDate, putTime)
+	}
+
+	// the last two digits of the time are tenths and hundredths of a second
+	return time.Parse("20060102150405.00", putDate+putTime[:6]+"."+putTime[6:])
+}
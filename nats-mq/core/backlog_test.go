@@ -0,0 +1,184 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePutTime(t *testing.T) {
+	putTime, err := parsePutTime("20190401", "13050742")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2019, 4, 1, 13, 5, 7, 420000000, time.UTC), putTime)
+
+	_, err = parsePutTime("", "")
+	require.Error(t, err)
+
+	_, err = parsePutTime("2019040", "13050742")
+	require.Error(t, err)
+}
+
+func TestChannelLag(t *testing.T) {
+	stats := NewConnectorStats()
+
+	stats.setBacklog(backlog{channelSequence: 10})
+	require.Equal(t, int64(10), stats.ChannelLag)
+
+	stats.AckedSequence = 7
+	stats.setBacklog(backlog{channelSequence: 10})
+	require.Equal(t, int64(3), stats.ChannelLag)
+
+	stats.AckedSequence = 12 // the check can run before a publish is acked
+	stats.setBacklog(backlog{channelSequence: 10})
+	require.Equal(t, int64(0), stats.ChannelLag)
+}
+
+func TestBacklogWarning(t *testing.T) {
+	config := conf.ConnectorConfig{
+		DepthWarning: 100,
+		AgeWarning:   5000,
+		LagWarning:   10,
+	}
+
+	stats := NewConnectorStats()
+	require.Empty(t, backlogWarning(config, stats))
+
+	stats.QueueDepth = 100
+	require.Empty(t, backlogWarning(config, stats))
+
+	stats.QueueDepth = 101
+	require.Contains(t, backlogWarning(config, stats), "queue depth")
+
+	stats.QueueDepth = 0
+	stats.OldestMessageAge = 6000
+	require.Contains(t, backlogWarning(config, stats), "oldest message age")
+
+	stats.OldestMessageAge = 0
+	stats.ChannelLag = 11
+	require.Contains(t, backlogWarning(config, stats), "channel lag")
+
+	require.Empty(t, backlogWarning(conf.ConnectorConfig{}, stats))
+}
+
+func TestBacklogWarningFailsReadiness(t *testing.T) {
+	bridge := NewBridgeServer()
+	bridge.critical = map[string]bool{}
+	bridge.reconnect = map[string]Connector{}
+
+	mq := &BridgeConnector{}
+	mq.init(bridge, conf.ConnectorConfig{ID: "alpha"}, "connector alpha")
+	bridge.connectors = []Connector{mq}
+
+	ready := bridge.readiness()
+	require.Len(t, ready.Failing, 1) // nats isn't connected
+
+	mq.stats.BacklogWarning = "queue depth 101 is over 100"
+
+	ready = bridge.readiness()
+	require.Len(t, ready.Failing, 2)
+	require.Equal(t, "alpha", ready.Failing[1].ID)
+	require.Equal(t, "queue depth 101 is over 100", ready.Failing[1].Error)
+	require.True(t, ready.Failing[1].Critical)
+}
+
+func TestBacklogConfigErrors(t *testing.T) {
+	configs := []conf.ConnectorConfig{
+		{Type: "Queue2NATS", Subject: "test", Queue: "DEV.QUEUE.1", BacklogInterval: -1},
+		{Type: "Queue2NATS", Subject: "test", Queue: "DEV.QUEUE.1", DepthWarning: 100},
+		{Type: "NATS2Queue", Subject: "test", Queue: "DEV.QUEUE.1", BacklogInterval: 1000},
+		{Type: "Topic2NATS", Subject: "test", Topic: "dev/", BacklogInterval: 1000},
+		{Type: "Stan2Queue", Channel: "test", Queue: "DEV.QUEUE.1", BacklogInterval: 1000},
+	}
+
+	for _, config := range configs {
+		_, err := CreateConnector(config, &BridgeServer{})
+		require.Error(t, err)
+	}
+}
+
+func TestQueueDepthIsMonitored(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:            "Queue2NATS",
+			Subject:         subject,
+			Queue:           queue,
+			ExcludeHeaders:  true,
+			BacklogInterval: 50,
+			DepthWarning:    100,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	require.Eventually(t, func() bool {
+		var buf bytes.Buffer
+		tbs.Bridge.writeMetrics(&buf, tbs.Bridge.SafeStats())
+		return bytes.Contains(buf.Bytes(), []byte("nats_mq_connector_queue_depth{"))
+	}, 5*time.Second, 50*time.Millisecond)
+
+	stats := tbs.Bridge.SafeStats()
+	require.Equal(t, int64(0), stats.Connections[0].QueueDepth)
+	require.Empty(t, stats.Connections[0].BacklogWarning)
+}
+
+func TestChannelLagIsMonitored(t *testing.T) {
+	channel := "test"
+	queue := "DEV.QUEUE.1"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:            "Stan2Queue",
+			Channel:         channel,
+			Queue:           queue,
+			ExcludeHeaders:  true,
+			BacklogInterval: 2000,
+			LagWarning:      10,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	for i := 0; i < 3; i++ {
+		err = tbs.SC.Publish(channel, []byte("hello world"))
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < 3; i++ {
+		_, _, _, err = tbs.GetMessageFromQueue(queue, 5000)
+		require.NoError(t, err)
+	}
+
+	require.Eventually(t, func() bool {
+		stats := tbs.Bridge.SafeStats().Connections[0]
+		return stats.ChannelSequence == 3 && stats.AckedSequence == 3
+	}, 10*time.Second, 50*time.Millisecond)
+
+	stats := tbs.Bridge.SafeStats()
+	require.Equal(t, int64(0), stats.Connections[0].ChannelLag)
+	require.Empty(t, stats.Connections[0].BacklogWarning)
+}
@@ -26,6 +26,7 @@ import (
 
 	"github.com/nats-io/nats-mq/nats-mq/conf"
 	"github.com/nats-io/nats-mq/nats-mq/logging"
+	"github.com/nats-io/nats-mq/nats-mq/tracing"
 	nats "github.com/nats-io/nats.go"
 	stan "github.com/nats-io/stan.go"
 )
@@ -39,13 +40,15 @@ type BridgeServer struct {
 
 	startTime time.Time
 	config    conf.BridgeConfig
-	logger    logging.Logger
+	logger    *logging.LevelLogger // the connectors' loggers share its output, with their own levels
+	tracer    *tracing.Tracer      // nil if spans aren't exported
 
 	natsLock sync.Mutex
 	nats     *nats.Conn
 	stan     stan.Conn
 
 	connectors  []Connector
+	critical    map[string]bool // IDs of the connectors that fail readiness while they reconnect
 	replyToInfo map[string]conf.ConnectorConfig
 
 	reconnectLock  sync.Mutex
@@ -58,17 +61,21 @@ type BridgeServer struct {
 	monitoringServer *http.Server
 	httpListener     net.Listener
 	monitoringURL    string
+
+	natsMonitorSubs    []*nats.Subscription // the varz, healthz and readyz request subscriptions
+	natsMonitorDone    chan bool            // stops the stats publisher, only used with a stats subject
+	natsMonitorStopped sync.WaitGroup
 }
 
 // NewBridgeServer creates a new bridge server with a default logger
 func NewBridgeServer() *BridgeServer {
 	return &BridgeServer{
-		logger: logging.NewNATSLogger(logging.Config{
+		logger: logging.NewLevelLogger(logging.NewNATSLogger(logging.Config{
 			Colors: true,
 			Time:   true,
 			Debug:  true,
 			Trace:  true,
-		}),
+		}), "", logging.LevelTrace),
 	}
 }
 
@@ -109,20 +116,40 @@ func (bridge *BridgeServer) Start() error {
 	bridge.runningLock.Lock()
 	defer bridge.runningLock.Unlock()
 
+	if err := validateNATSMonitoring(bridge.config.Monitoring); err != nil {
+		return err
+	}
+
+	// the level loggers filter debug and trace, so the shared logger writes every level
+	logConfig := bridge.config.Logging
+	logConfig.Debug = true
+	logConfig.Trace = true
+
+	logger, err := logging.NewLogger(logConfig)
+	if err != nil {
+		return err
+	}
+
 	if bridge.logger != nil {
 		bridge.logger.Close()
 	}
 
 	bridge.running = true
 	bridge.startTime = time.Now()
-	bridge.logger = logging.NewNATSLogger(bridge.config.Logging)
+	bridge.logger = logging.NewLevelLogger(logger, "", logging.ConfigLevel(bridge.config.Logging))
 	bridge.replyToInfo = map[string]conf.ConnectorConfig{}
 	bridge.connectors = []Connector{}
+	bridge.critical = map[string]bool{}
 	bridge.reconnect = map[string]Connector{}
 
 	bridge.logger.Noticef("starting MQ-NATS bridge, version %s", version)
 	bridge.logger.Noticef("server time is %s", bridge.startTime.Format(time.UnixDate))
 
+	bridge.tracer, err = tracing.NewTracer(bridge.config.Tracing, bridge.logger)
+	if err != nil {
+		return err
+	}
+
 	if err := bridge.connectToNATS(); err != nil {
 		return err
 	}
@@ -143,6 +170,10 @@ func (bridge *BridgeServer) Start() error {
 		return err
 	}
 
+	if err := bridge.startNATSMonitoring(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -160,13 +191,17 @@ func (bridge *BridgeServer) Stop() {
 	bridge.running = false
 	bridge.stopReconnectTimer()
 	bridge.reconnect = map[string]Connector{} // clear the map
+	bridge.stopNATSMonitoring()
 
 	for _, c := range bridge.connectors {
 		err := c.Shutdown()
 
 		if err != nil {
 			bridge.logger.Noticef("error shutting down connector %s", err.Error())
+			continue
 		}
+
+		bridge.publishEvent(EventConnectorStopped, c, nil)
 	}
 
 	if bridge.nats != nil {
@@ -179,6 +214,8 @@ func (bridge *BridgeServer) Stop() {
 		bridge.logger.Noticef("disconnected from NATS streaming")
 	}
 
+	bridge.tracer.Close() // exports the spans that are waiting
+
 	err := bridge.StopMonitoring()
 	if err != nil {
 		bridge.logger.Noticef("error shutting down monitoring server %s", err.Error())
@@ -197,6 +234,10 @@ func (bridge *BridgeServer) initializeConnectors() error {
 		}
 
 		bridge.connectors = append(bridge.connectors, connector)
+
+		if c.Critical {
+			bridge.critical[connector.ID()] = true
+		}
 	}
 	return nil
 }
@@ -208,6 +249,7 @@ func (bridge *BridgeServer) startConnectors() error {
 			bridge.logger.Noticef("error starting %s, %s", c.String(), err.Error())
 			return err
 		}
+		bridge.publishEvent(EventConnectorStarted, c, nil)
 	}
 	return nil
 }
@@ -360,6 +402,7 @@ func (bridge *BridgeServer) ConnectorError(connector Connector, err error) {
 
 	description := connector.String()
 	bridge.logger.Errorf("a connector error has occurred, bridge will try to restart %s, %s", description, err.Error())
+	bridge.publishEvent(EventConnectorError, connector, err)
 
 	err = connector.Shutdown()
 
@@ -398,6 +441,7 @@ func (bridge *BridgeServer) checkConnections() {
 
 		description := connector.String()
 		bridge.logger.Errorf("a connector error has occurred, trying to restart %s, %s", description, err.Error())
+		bridge.publishEvent(EventConnectorError, connector, err)
 
 		err = connector.Shutdown()
 
@@ -455,6 +499,7 @@ func (bridge *BridgeServer) ensureReconnectTimer() {
 		// Do all the reconnects
 		for id, connector := range bridge.reconnect {
 			bridge.logger.Noticef("trying to restart connector %s", connector.String())
+			bridge.publishEvent(EventConnectorReconnecting, connector, nil)
 			err := connector.Start()
 
 			if err != nil {
@@ -463,6 +508,7 @@ func (bridge *BridgeServer) ensureReconnectTimer() {
 			}
 
 			delete(bridge.reconnect, id)
+			bridge.publishEvent(EventConnectorStarted, connector, nil)
 		}
 
 		bridge.reconnectTimer = nil
@@ -161,3 +161,38 @@ func TestMonitoringDisabled(t *testing.T) {
 
 	bridge.Stop()
 }
+
+func TestUnknownEncodingIsAnError(t *testing.T) {
+	config := conf.ConnectorConfig{
+		Type:     "Queue2NATS",
+		Subject:  "test",
+		Queue:    "DEV.QUEUE.1",
+		Encoding: "xml",
+	}
+
+	_, err := CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+}
+
+func TestNATSHeadersConfigErrors(t *testing.T) {
+	config := conf.ConnectorConfig{
+		Type:           "Queue2NATS",
+		Subject:        "test",
+		Queue:          "DEV.QUEUE.1",
+		NATSHeaders:    true,
+		ExcludeHeaders: true,
+	}
+
+	_, err := CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+
+	config = conf.ConnectorConfig{
+		Type:        "Queue2Stan",
+		Channel:     "test",
+		Queue:       "DEV.QUEUE.1",
+		NATSHeaders: true,
+	}
+
+	_, err = CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+}
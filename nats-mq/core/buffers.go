@@ -0,0 +1,212 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+)
+
+const (
+	// DefaultIncomingBufferSize is the buffer size, in bytes, used for polling if none is configured
+	DefaultIncomingBufferSize = 1024 * 8
+
+	// DefaultMaxBufferSize is the largest buffer, in bytes, used to get a truncated message if no max is configured,
+	// it is the largest message MQ allows
+	DefaultMaxBufferSize = 100 * 1024 * 1024
+)
+
+// validateBuffers checks the buffer sizes and that a poison queue is only used when getting from MQ
+func validateBuffers(config conf.ConnectorConfig) error {
+	if config.IncomingBufferSize < 0 || config.MaxBufferSize < 0 {
+		return fmt.Errorf("buffer sizes can't be negative")
+	}
+
+	if config.MaxBufferSize > 0 && config.IncomingBufferSize > config.MaxBufferSize {
+		return fmt.Errorf("incoming buffer size %d is larger than the max buffer size %d", config.IncomingBufferSize, config.MaxBufferSize)
+	}
+
+	if config.PoisonQueue != "" {
+		switch config.Type {
+		case conf.Queue2NATS, conf.Queue2Stan, conf.Topic2NATS, conf.Topic2Stan:
+		default:
+			return fmt.Errorf("a poison queue can only be used by connectors that get messages from MQ")
+		}
+	}
+
+	return nil
+}
+
+// isTruncated returns true if the error is from a get with a buffer that was too small for the message,
+// in which case the message is still on the queue
+func isTruncated(err error) bool {
+	mqret, ok := err.(*ibmmq.MQReturn)
+	return ok && mqret.MQRC == ibmmq.MQRC_TRUNCATED_MSG_FAILED
+}
+
+// maxBufferSize returns the configured max buffer size or the default
+func (mq *BridgeConnector) maxBufferSize() int {
+	if mq.config.MaxBufferSize > 0 {
+		return mq.config.MaxBufferSize
+	}
+	return DefaultMaxBufferSize
+}
+
+// nextBufferSize returns the size to retry a truncated get with, or 0 if the message can't fit in max bytes
+// The data length is used when MQ reports it, otherwise the buffer doubles, up to max
+func nextBufferSize(current int, dataLength int, max int) int {
+	if dataLength > max || current >= max {
+		return 0
+	}
+
+	if dataLength > current {
+		return dataLength
+	}
+
+	next := current * 2
+	if next > max || next <= 0 {
+		next = max
+	}
+	return next
+}
+
+// getTruncated retries a get that failed with a truncated message with larger buffers, up to the max
+// buffer size, the larger buffer is only used for this message so polling shrinks back afterwards
+// The MQ library doesn't return the data length with the error so the buffer grows by doubling,
+// newGet should create the MQMD and MQGMO the same way the polling loop does. If the message
+// doesn't fit the truncation error is returned with the MQMD from the last get, other errors are
+// returned as is, the MQ library returns no data with a warning so conversion warnings need getUnconverted
+func (mq *BridgeConnector) getTruncated(target *ibmmq.MQObject, mqmd *ibmmq.MQMD, gmo *ibmmq.MQGMO, size int, err error,
+	newGet func() (*ibmmq.MQMD, *ibmmq.MQGMO)) (*ibmmq.MQMD, *ibmmq.MQGMO, []byte, error) {
+	max := mq.maxBufferSize()
+
+	for isTruncated(err) {
+		size = nextBufferSize(size, 0, max)
+
+		if size == 0 {
+			return mqmd, gmo, nil, err
+		}
+
+		mq.Logger().Tracef("%s retrying truncated message with a buffer of %d bytes", mq.String(), size)
+
+		buffer := make([]byte, size)
+		mqmd, gmo = newGet()
+
+		var datalen int
+		datalen, err = target.Get(mqmd, gmo, buffer)
+
+		if !isTruncated(err) {
+			return mqmd, gmo, buffer[0:datalen], err
+		}
+	}
+
+	return mqmd, gmo, nil, err
+}
+
+// openPoisonQueue opens the poison queue the first time it is used, messages are put with all of the
+// context from the get, since the MQ library can't pass the context of the source queue's handle
+// - expects the lock to be held
+func (mq *BridgeConnector) openPoisonQueue() error {
+	if mq.poisonQueue != nil {
+		return nil
+	}
+
+	poisonQueue, err := mq.connectToQueue(mq.config.PoisonQueue, ibmmq.MQOO_OUTPUT|ibmmq.MQOO_SET_ALL_CONTEXT)
+	if err != nil {
+		return err
+	}
+	mq.poisonQueue = poisonQueue
+	return nil
+}
+
+// movePoisonMessage moves a message that is larger than the max buffer size to the poison queue,
+// in the current unit of work, the message is read with a buffer that is only used for the move
+// the data length is used if it is known - expects the lock to be held
+func (mq *BridgeConnector) movePoisonMessage(target *ibmmq.MQObject, md *ibmmq.MQMD, dataLength int) error {
+	if mq.config.PoisonQueue == "" {
+		return fmt.Errorf("message %x is larger than the max buffer size and no poison queue is configured", md.MsgId)
+	}
+
+	if err := mq.openPoisonQueue(); err != nil {
+		return err
+	}
+
+	size := nextBufferSize(mq.maxBufferSize(), dataLength, DefaultMaxBufferSize)
+	if size == 0 {
+		size = DefaultMaxBufferSize // the max buffer size is already the largest MQ message
+	}
+
+	for size > 0 {
+		getmd := ibmmq.NewMQMD()
+		getmd.MsgId = md.MsgId
+		gmo := ibmmq.NewMQGMO()
+		gmo.Version = ibmmq.MQGMO_VERSION_2
+		gmo.MatchOptions = ibmmq.MQMO_MATCH_MSG_ID
+		gmo.Options = ibmmq.MQGMO_SYNCPOINT
+		gmo.Options |= ibmmq.MQGMO_NO_WAIT
+		gmo.Options |= ibmmq.MQGMO_FAIL_IF_QUIESCING
+
+		buffer := make([]byte, size)
+		datalen, err := target.Get(getmd, gmo, buffer)
+
+		if isTruncated(err) {
+			size = nextBufferSize(size, 0, DefaultMaxBufferSize)
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		pmo := ibmmq.NewMQPMO()
+		pmo.Options = ibmmq.MQPMO_SYNCPOINT
+		pmo.Options |= ibmmq.MQPMO_FAIL_IF_QUIESCING
+		pmo.Options |= ibmmq.MQPMO_SET_ALL_CONTEXT
+
+		mq.Logger().Noticef("%s moving message %x of %d bytes to poison queue %s", mq.String(), getmd.MsgId, datalen, mq.config.PoisonQueue)
+
+		return mq.poisonQueue.Put(getmd, pmo, buffer[0:datalen])
+	}
+
+	return fmt.Errorf("message %x is larger than the largest MQ message", md.MsgId)
+}
+
+// handlePoisonMessage moves a truncated message to the poison queue and commits, unless a message
+// group is being read in which case the group commits the move - expects the lock to be held
+func (mq *BridgeConnector) handlePoisonMessage(conn Connector, target *ibmmq.MQObject, md *ibmmq.MQMD, dataLength int) {
+	if err := mq.movePoisonMessage(target, md, dataLength); err != nil {
+		mq.Logger().Noticef("poison message failure for %s, %s", mq.String(), err.Error())
+		if mq.group != nil {
+			mq.backoutGroup()
+		} else {
+			mq.qMgr.Back() // the message is left on the queue, the restart tries the move again
+		}
+		go mq.bridge.ConnectorError(conn, err) // run in a go routine so we can finish this method and unlock
+		return
+	}
+
+	if mq.group != nil {
+		return
+	}
+
+	if err := mq.qMgr.Cmit(); err != nil {
+		mq.Logger().Noticef("failed to commit, %s", err.Error())
+		mq.stats.AddCommitError(err)
+		go mq.bridge.ConnectorError(conn, err) // run in a go routine so we can finish this method and unlock
+	}
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextBufferSize(t *testing.T) {
+	require.Equal(t, 2048, nextBufferSize(1024, 0, 4096))
+	require.Equal(t, 4096, nextBufferSize(3000, 0, 4096))
+	require.Equal(t, 0, nextBufferSize(4096, 0, 4096))
+	require.Equal(t, 3000, nextBufferSize(1024, 3000, 4096))
+	require.Equal(t, 0, nextBufferSize(1024, 5000, 4096))
+	require.Equal(t, 2048, nextBufferSize(1024, 512, 4096))
+}
+
+func TestInvalidBufferSizesAreRejected(t *testing.T) {
+	config := conf.ConnectorConfig{
+		Type:               "Queue2NATS",
+		Subject:            "test",
+		Queue:              "DEV.QUEUE.1",
+		IncomingBufferSize: 4096,
+		MaxBufferSize:      1024,
+	}
+
+	_, err := CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+
+	config = conf.ConnectorConfig{
+		Type:        "NATS2Queue",
+		Subject:     "test",
+		Queue:       "DEV.QUEUE.1",
+		PoisonQueue: "DEV.QUEUE.2",
+	}
+
+	_, err = CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+}
+
+func TestPollingGrowsBufferForLargeMessages(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+	small := []byte("hello world")
+	large := bytes.Repeat([]byte("0123456789"), 300)
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:               "Queue2NATS",
+			Subject:            subject,
+			Queue:              queue,
+			ExcludeHeaders:     true,
+			UsePolling:         true,
+			IncomingBufferSize: 1024,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	done := make(chan []byte)
+
+	sub, err := tbs.NC.Subscribe(subject, func(m *nats.Msg) {
+		done <- m.Data
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	for _, msg := range [][]byte{large, small} {
+		err = tbs.PutMessageOnQueue(queue, ibmmq.NewMQMD(), msg)
+		require.NoError(t, err)
+
+		select {
+		case received := <-done:
+			require.Equal(t, msg, received)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for the message")
+		}
+	}
+
+	stats := tbs.Bridge.SafeStats()
+	connStats := stats.Connections[0]
+	require.Equal(t, int64(2), connStats.MessagesOut)
+	require.Equal(t, int64(0), connStats.Disconnects)
+}
+
+func testPoisonQueue(t *testing.T, usePolling bool) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+	poisonQueue := "DEV.QUEUE.2"
+	small := []byte("hello world")
+	large := bytes.Repeat([]byte("0123456789"), 300)
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:               "Queue2NATS",
+			Subject:            subject,
+			Queue:              queue,
+			ExcludeHeaders:     true,
+			UsePolling:         usePolling,
+			IncomingBufferSize: 1024,
+			MaxBufferSize:      2048,
+			PoisonQueue:        poisonQueue,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	done := make(chan []byte)
+
+	sub, err := tbs.NC.Subscribe(subject, func(m *nats.Msg) {
+		done <- m.Data
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	err = tbs.PutMessageOnQueue(queue, ibmmq.NewMQMD(), large)
+	require.NoError(t, err)
+	err = tbs.PutMessageOnQueue(queue, ibmmq.NewMQMD(), small)
+	require.NoError(t, err)
+
+	select {
+	case received := <-done:
+		require.Equal(t, small, received)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for the message")
+	}
+
+	_, _, data, err := tbs.GetMessageFromQueue(poisonQueue, 5000)
+	require.NoError(t, err)
+	require.Equal(t, large, data)
+
+	stats := tbs.Bridge.SafeStats()
+	connStats := stats.Connections[0]
+	require.Equal(t, int64(1), connStats.MessagesOut)
+	require.Equal(t, int64(0), connStats.Disconnects)
+}
+
+func TestPollingMovesOversizedMessagesToPoisonQueue(t *testing.T) {
+	testPoisonQueue(t, true)
+}
+
+func TestCallbackMovesOversizedMessagesToPoisonQueue(t *testing.T) {
+	testPoisonQueue(t, false)
+}
@@ -0,0 +1,248 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// CCSIDUTF8 is the MQ coded character set id for UTF-8
+const CCSIDUTF8 = 1208
+
+// ccsidEncodings are the coded character sets the bridge can convert UTF-8 bodies to
+// CCSID 500 is handled separately, see encodeCCSID500
+var ccsidEncodings = map[int]encoding.Encoding{
+	37:   charmap.CodePage037,
+	437:  charmap.CodePage437,
+	819:  charmap.ISO8859_1,
+	850:  charmap.CodePage850,
+	1047: charmap.CodePage1047,
+	1140: charmap.CodePage1140,
+	1252: charmap.Windows1252,
+}
+
+// ccsid500From037 maps code page 037 bytes to code page 500, the two code pages
+// contain the same characters and only differ in the position of seven of them
+var ccsid500From037 = map[byte]byte{
+	0x4A: 0xB0, // ¢
+	0x4F: 0xBB, // |
+	0x5A: 0x4F, // !
+	0x5F: 0xBA, // ¬
+	0xB0: 0x5F, // ^
+	0xBA: 0x4A, // [
+	0xBB: 0x5A, // ]
+}
+
+// CanConvertToCCSID returns true if the bridge can convert UTF-8 bodies to the ccsid
+func CanConvertToCCSID(ccsid int) bool {
+	if ccsid == CCSIDUTF8 || ccsid == 500 {
+		return true
+	}
+	_, ok := ccsidEncodings[ccsid]
+	return ok
+}
+
+// ConvertFromUTF8 converts a UTF-8 body to the provided ccsid, an error is returned
+// if the body isn't valid UTF-8 or contains characters the ccsid can't represent
+func ConvertFromUTF8(body []byte, ccsid int) ([]byte, error) {
+	if !utf8.Valid(body) {
+		return nil, fmt.Errorf("message body is not valid UTF-8")
+	}
+
+	if ccsid == CCSIDUTF8 {
+		return body, nil
+	}
+
+	if ccsid == 500 {
+		return encodeCCSID500(body)
+	}
+
+	enc, ok := ccsidEncodings[ccsid]
+	if !ok {
+		return nil, fmt.Errorf("unsupported CCSID %d", ccsid)
+	}
+
+	converted, err := enc.NewEncoder().Bytes(body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert message body to CCSID %d, %s", ccsid, err.Error())
+	}
+	return converted, nil
+}
+
+func encodeCCSID500(body []byte) ([]byte, error) {
+	converted, err := charmap.CodePage037.NewEncoder().Bytes(body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to convert message body to CCSID 500, %s", err.Error())
+	}
+
+	for i, b := range converted {
+		if mapped, ok := ccsid500From037[b]; ok {
+			converted[i] = mapped
+		}
+	}
+	return converted, nil
+}
+
+// validateCCSID checks that connectors that put to MQ can convert bodies to the CCSID
+func validateCCSID(config conf.ConnectorConfig) error {
+	if config.CCSID < 0 {
+		return fmt.Errorf("invalid CCSID %d in configuration", config.CCSID)
+	}
+
+	switch config.Type {
+	case conf.NATS2Queue, conf.Stan2Queue, conf.NATS2Topic, conf.Stan2Topic:
+		if config.CCSID != 0 && !CanConvertToCCSID(config.CCSID) {
+			return fmt.Errorf("the bridge can't convert message bodies to CCSID %d", config.CCSID)
+		}
+	}
+
+	return nil
+}
+
+// isConversionError returns true for the reason codes MQ uses when MQGMO_CONVERT fails, with a warning
+// the message has still been delivered, without conversion
+func isConversionError(mqret *ibmmq.MQReturn) bool {
+	switch mqret.MQRC {
+	case ibmmq.MQRC_NOT_CONVERTED, ibmmq.MQRC_CONVERTED_MSG_TOO_BIG, ibmmq.MQRC_FORMAT_ERROR,
+		ibmmq.MQRC_SOURCE_CCSID_ERROR, ibmmq.MQRC_TARGET_CCSID_ERROR:
+		return true
+	}
+	return false
+}
+
+// requestConversion asks MQ to convert the message data to the configured CCSID on get
+func (mq *BridgeConnector) requestConversion(mqmd *ibmmq.MQMD, gmo *ibmmq.MQGMO) {
+	if mq.config.CCSID == 0 {
+		return
+	}
+	gmo.Options |= ibmmq.MQGMO_CONVERT
+	mqmd.CodedCharSetId = int32(mq.config.CCSID)
+	mqmd.Encoding = ibmmq.MQENC_NATIVE
+}
+
+// isConversionWarning returns true if err is a warning from a get that MQ couldn't convert
+func isConversionWarning(err error) bool {
+	mqret, ok := err.(*ibmmq.MQReturn)
+	return ok && mqret.MQCC == ibmmq.MQCC_WARNING && isConversionError(mqret)
+}
+
+// getUnconverted reads a message again without conversion after MQ failed to convert it, the MQ library
+// doesn't return the data with a warning so the get is backed out and the message is read by its id
+// The warning is returned with the data so the callback still records it, in the middle of a group the
+// message can't be read on its own, so the group is backed out and the warning is returned as a failure
+func (mq *BridgeConnector) getUnconverted(qMgr *ibmmq.MQQueueManager, target *ibmmq.MQObject, md *ibmmq.MQMD, size int, warning error,
+	newGet func() (*ibmmq.MQMD, *ibmmq.MQGMO)) (*ibmmq.MQMD, *ibmmq.MQGMO, []byte, error) {
+	mq.Lock()
+	defer mq.Unlock()
+
+	if mq.group != nil {
+		mq.backoutGroup()
+		mqret := warning.(*ibmmq.MQReturn)
+		return md, nil, nil, &ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: mqret.MQRC}
+	}
+
+	if err := qMgr.Back(); err != nil {
+		return md, nil, nil, err
+	}
+
+	msgID := md.MsgId
+	newRawGet := func() (*ibmmq.MQMD, *ibmmq.MQGMO) {
+		mqmd, gmo := newGet()
+		gmo.Options &^= ibmmq.MQGMO_CONVERT
+		gmo.Options &^= ibmmq.MQGMO_WAIT
+		gmo.Options |= ibmmq.MQGMO_NO_WAIT
+		gmo.Version = ibmmq.MQGMO_VERSION_2
+		gmo.MatchOptions |= ibmmq.MQMO_MATCH_MSG_ID
+		mqmd.MsgId = msgID
+		return mqmd, gmo
+	}
+
+	mq.Logger().Tracef("%s reading message %x again without conversion", mq.String(), msgID)
+
+	mqmd, gmo := newRawGet()
+	buffer := make([]byte, size)
+	datalen, err := target.Get(mqmd, gmo, buffer)
+	data := buffer[0:datalen]
+
+	if isTruncated(err) {
+		mqmd, gmo, data, err = mq.getTruncated(target, mqmd, gmo, size, err, newRawGet)
+	}
+
+	if err != nil {
+		return mqmd, gmo, nil, err
+	}
+	return mqmd, gmo, data, warning
+}
+
+// publishUnconverted records a message that MQ delivered without converting it, the message is published
+// as it is, with its own CCSID in the header, since backing it out would only read it again
+func (mq *BridgeConnector) publishUnconverted(md *ibmmq.MQMD, mqret *ibmmq.MQReturn) {
+	err := fmt.Errorf("message %x was not converted to CCSID %d, reason code %d", md.MsgId, mq.config.CCSID, mqret.MQRC)
+	mq.Logger().Warnf("%s publishing unconverted message, %s", mq.String(), err.Error())
+	mq.stats.AddConversionError(err)
+}
+
+// convertForPut converts a UTF-8 body to the configured CCSID and marks the message as a string
+func (mq *BridgeConnector) convertForPut(mqmd *ibmmq.MQMD, body []byte) ([]byte, error) {
+	if mq.config.CCSID == 0 {
+		return body, nil
+	}
+
+	if isRFH2Format(mqmd.Format) {
+		return mq.convertRFH2ForPut(mqmd, body)
+	}
+
+	converted, err := ConvertFromUTF8(body, mq.config.CCSID)
+	if err != nil {
+		return nil, err
+	}
+
+	mqmd.CodedCharSetId = int32(mq.config.CCSID)
+	mqmd.Format = ibmmq.MQFMT_STRING
+	return converted, nil
+}
+
+// convertRFH2ForPut converts the payload after an RFH2 header, the header is left as is
+// except for the fields that describe the payload
+func (mq *BridgeConnector) convertRFH2ForPut(mqmd *ibmmq.MQMD, body []byte) ([]byte, error) {
+	header, payload, err := parseRFH2(body, mqmd.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	converted, err := ConvertFromUTF8(payload, mq.config.CCSID)
+	if err != nil {
+		return nil, err
+	}
+
+	header.CodedCharSetID = int32(mq.config.CCSID)
+	header.Format = ibmmq.MQFMT_STRING
+
+	for i, folder := range header.Folders {
+		if strings.HasPrefix(folder, "<mcd>") {
+			header.Folders[i] = strings.Replace(folder, "<Msd>jms_bytes</Msd>", "<Msd>jms_text</Msd>", 1)
+		}
+	}
+
+	return append(header.Bytes(mqmd.Encoding), converted...), nil
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertFromUTF8(t *testing.T) {
+	hello := []byte{0xC8, 0x85, 0x93, 0x93, 0x96}
+
+	converted, err := ConvertFromUTF8([]byte("Hello"), 37)
+	require.NoError(t, err)
+	require.Equal(t, hello, converted)
+
+	converted, err = ConvertFromUTF8([]byte("Hello"), 500)
+	require.NoError(t, err)
+	require.Equal(t, hello, converted)
+
+	converted, err = ConvertFromUTF8([]byte("Hello"), 1047)
+	require.NoError(t, err)
+	require.Equal(t, hello, converted)
+
+	converted, err = ConvertFromUTF8([]byte("Hello"), CCSIDUTF8)
+	require.NoError(t, err)
+	require.Equal(t, []byte("Hello"), converted)
+}
+
+func TestConvertBracketsFromUTF8(t *testing.T) {
+	converted, err := ConvertFromUTF8([]byte("[!]"), 37)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xBA, 0x5A, 0xBB}, converted)
+
+	converted, err = ConvertFromUTF8([]byte("[!]"), 500)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x4A, 0x4F, 0x5A}, converted)
+
+	converted, err = ConvertFromUTF8([]byte("[!]"), 1047)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xAD, 0x5A, 0xBD}, converted)
+}
+
+func TestConvertFromUTF8Failures(t *testing.T) {
+	_, err := ConvertFromUTF8([]byte{0xff, 0xfe}, 500)
+	require.Error(t, err)
+
+	_, err = ConvertFromUTF8([]byte("€"), 37)
+	require.Error(t, err)
+
+	_, err = ConvertFromUTF8([]byte("hello"), 1)
+	require.Error(t, err)
+
+	require.True(t, CanConvertToCCSID(500))
+	require.True(t, CanConvertToCCSID(1047))
+	require.False(t, CanConvertToCCSID(1))
+}
+
+func TestConvertForPutSetsFormat(t *testing.T) {
+	mq := &BridgeConnector{
+		config: conf.ConnectorConfig{
+			CCSID: 1047,
+		},
+	}
+
+	mqmd := &ibmmq.MQMD{}
+	converted, err := mq.convertForPut(mqmd, []byte("Hello"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{0xC8, 0x85, 0x93, 0x93, 0x96}, converted)
+	require.Equal(t, int32(1047), mqmd.CodedCharSetId)
+	require.Equal(t, ibmmq.MQFMT_STRING, mqmd.Format)
+}
+
+func TestCCSIDConfigErrors(t *testing.T) {
+	config := conf.ConnectorConfig{
+		Type:    "NATS2Queue",
+		Subject: "test",
+		Queue:   "DEV.QUEUE.1",
+		CCSID:   1,
+	}
+
+	_, err := CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+
+	config.CCSID = -1
+	_, err = CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+}
+
+func TestNotConvertedMessagesArePublished(t *testing.T) {
+	bridge := NewBridgeServer()
+	mq := &Queue2NATSConnector{}
+	mq.init(bridge, conf.ConnectorConfig{Type: "Queue2NATS", CCSID: 1047}, "Queue:DEV.QUEUE.1 to NATS:test")
+
+	mqErr := &ibmmq.MQReturn{
+		MQCC: ibmmq.MQCC_WARNING,
+		MQRC: ibmmq.MQRC_NOT_CONVERTED,
+	}
+
+	require.True(t, mq.checkMQCallback(mq, nil, &ibmmq.MQMD{}, nil, mqErr))
+	require.Equal(t, int64(1), mq.stats.ConversionErrors)
+}
+
+func TestPollingPublishesUnconvertedMessages(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+	msg := []byte{0x00, 0xff, 0x10, 0x80}
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:           "Queue2NATS",
+			Subject:        subject,
+			Queue:          queue,
+			ExcludeHeaders: true,
+			UsePolling:     true,
+			CCSID:          1047,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	done := make(chan []byte)
+
+	sub, err := tbs.NC.Subscribe(subject, func(m *nats.Msg) {
+		done <- m.Data
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	// MQ can't convert a message without a format
+	mqmd := ibmmq.NewMQMD()
+	mqmd.Format = ibmmq.MQFMT_NONE
+	mqmd.CodedCharSetId = CCSIDUTF8
+	err = tbs.PutMessageOnQueue(queue, mqmd, msg)
+	require.NoError(t, err)
+
+	select {
+	case received := <-done:
+		require.Equal(t, msg, received)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for the message")
+	}
+
+	stats := tbs.Bridge.SafeStats()
+	connStats := stats.Connections[0]
+	require.Equal(t, int64(1), connStats.MessagesOut)
+	require.Equal(t, int64(1), connStats.ConversionErrors)
+}
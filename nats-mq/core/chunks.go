@@ -0,0 +1,248 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats-mq/message"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
+	stan "github.com/nats-io/stan.go"
+)
+
+const (
+	defaultChunkTimeout     = 30 * time.Second
+	defaultChunkMemoryLimit = 64 * 1024 * 1024
+
+	// chunkSlack is left out of the server max payload for the streaming protocol and chunk layout
+	chunkSlack = 1024
+)
+
+// chunkState holds the incomplete chunked messages for a NATS/stan to MQ connector
+// the header and reply come from the first chunk, stan messages are acked once the payload is put
+type chunkState struct {
+	assembler *message.ChunkAssembler
+	timeout   time.Duration
+	done      chan bool // stops the expiry timer, nil when it isn't running
+	headers   map[string]nats.Header
+	replies   map[string]string
+	acks      map[string][]*stan.Msg
+}
+
+func newChunkState(timeout int, memoryLimit int64) *chunkState {
+	chunkTimeout := defaultChunkTimeout
+	if timeout > 0 {
+		chunkTimeout = time.Duration(timeout) * time.Millisecond
+	}
+
+	if memoryLimit <= 0 {
+		memoryLimit = defaultChunkMemoryLimit
+	}
+
+	return &chunkState{
+		assembler: message.NewChunkAssembler(memoryLimit, chunkTimeout),
+		timeout:   chunkTimeout,
+		headers:   map[string]nats.Header{},
+		replies:   map[string]string{},
+		acks:      map[string][]*stan.Msg{},
+	}
+}
+
+// cleanup forgets the transfers that failed or expired and returns their stan messages, which should be acked
+// so they aren't redelivered, completed transfers are removed by assembleChunk before the cleanup
+func (chunks *chunkState) cleanup() []*stan.Msg {
+	dropped := []*stan.Msg{}
+	for pending, acks := range chunks.acks {
+		if !chunks.assembler.Active(pending) {
+			dropped = append(dropped, acks...)
+			delete(chunks.headers, pending)
+			delete(chunks.replies, pending)
+			delete(chunks.acks, pending)
+		}
+	}
+	return dropped
+}
+
+// startChunkExpiry drops incomplete transfers once they time out, even if no more chunks arrive,
+// the stan chunks they held are acked - expects the lock to be held
+func (mq *BridgeConnector) startChunkExpiry() {
+	if mq.chunks == nil || mq.chunks.done != nil {
+		return
+	}
+
+	chunks := mq.chunks
+	done := make(chan bool)
+	chunks.done = done
+
+	go func() {
+		ticker := time.NewTicker(chunks.timeout)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			mq.Lock()
+			expired := chunks.assembler.Expire()
+			for _, id := range expired {
+				err := fmt.Errorf("incomplete chunked message %s timed out", id)
+				mq.Logger().Noticef("dropping chunks for %s, %s", mq.String(), err.Error())
+				mq.stats.AddConversionError(err)
+			}
+			mq.ackMessages(chunks.cleanup())
+			mq.Unlock()
+		}
+	}()
+}
+
+// stopChunkExpiry stops the expiry timer - expects the lock to be held
+func (mq *BridgeConnector) stopChunkExpiry() {
+	if mq.chunks == nil || mq.chunks.done == nil {
+		return
+	}
+	close(mq.chunks.done)
+	mq.chunks.done = nil
+}
+
+// validateChunking checks that a max chunk size leaves room for the chunk layout
+func validateChunking(config conf.ConnectorConfig) error {
+	if config.MaxChunkSize < 0 || (config.MaxChunkSize > 0 && config.MaxChunkSize <= message.ChunkOverhead) {
+		return fmt.Errorf("max chunk size %d is too small", config.MaxChunkSize)
+	}
+	return nil
+}
+
+// natsHeaderSize returns the number of bytes the header adds to a NATS message
+func natsHeaderSize(header nats.Header) int {
+	if len(header) == 0 {
+		return 0
+	}
+
+	size := len("NATS/1.0\r\n\r\n")
+	for k, values := range header {
+		for _, v := range values {
+			size += len(k) + len(": ") + len(v) + len("\r\n")
+		}
+	}
+	return size
+}
+
+// maxChunkSize returns the largest payload the connector can publish in a single message
+func (mq *BridgeConnector) maxChunkSize(header nats.Header) int {
+	max := mq.config.MaxChunkSize
+	if max <= 0 {
+		max = int(mq.bridge.NATS().MaxPayload()) - chunkSlack
+	}
+	return max - natsHeaderSize(header)
+}
+
+// publishChunked passes the message to the callback, splitting it into chunks first if chunking is on
+// and the message is too big, only the first chunk carries the header and reply subject
+func (mq *BridgeConnector) publishChunked(cb NATSCallback, natsMsg []byte, header nats.Header, replyTo string) error {
+	if !mq.config.Chunking {
+		return cb(natsMsg, header, replyTo)
+	}
+
+	maxSize := mq.maxChunkSize(header)
+
+	if len(natsMsg) <= maxSize {
+		return cb(natsMsg, header, replyTo)
+	}
+
+	chunks, err := message.SplitIntoChunks(natsMsg, maxSize)
+	if err != nil {
+		return err
+	}
+
+	mq.Logger().Tracef("%s splitting message of %d bytes into %d chunks", mq.String(), len(natsMsg), len(chunks))
+
+	for i, chunk := range chunks {
+		if i == 0 {
+			err = cb(chunk, header, replyTo)
+		} else {
+			err = cb(chunk, nil, "")
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// assembleChunk collects chunks until a payload is complete, messages that aren't chunks are returned as is
+// ok is false while chunks are still missing or if the chunk was dropped, the returned stan messages
+// should be acked once the payload is put, stan messages for chunks that are dropped are acked
+// and counted as conversion errors - expects the lock to be held
+func (mq *BridgeConnector) assembleChunk(data []byte, header nats.Header, replyTo string, stanMsg *stan.Msg) ([]byte, nats.Header, string, []*stan.Msg, bool) {
+	acks := []*stan.Msg{}
+	if stanMsg != nil {
+		acks = append(acks, stanMsg)
+	}
+
+	if mq.chunks == nil || !message.IsChunk(data) {
+		return data, header, replyTo, acks, true
+	}
+
+	chunks := mq.chunks
+	chunk, err := message.DecodeChunk(data)
+	if err != nil {
+		mq.Logger().Noticef("dropping invalid chunk for %s, %s", mq.String(), err.Error())
+		mq.stats.AddConversionError(err)
+		mq.ackMessages(acks)
+		return nil, nil, "", nil, false
+	}
+
+	id := chunk.TransferID
+
+	if chunk.Index == 0 {
+		chunks.headers[id] = header
+		chunks.replies[id] = replyTo
+	}
+	chunks.acks[id] = append(chunks.acks[id], acks...)
+
+	payload, complete, err := chunks.assembler.Add(chunk)
+
+	if err != nil {
+		mq.Logger().Noticef("chunk failure for %s, %s", mq.String(), err.Error())
+		mq.stats.AddConversionError(err)
+	}
+
+	if complete {
+		header = chunks.headers[id]
+		replyTo = chunks.replies[id]
+		acks = chunks.acks[id]
+		delete(chunks.headers, id)
+		delete(chunks.replies, id)
+		delete(chunks.acks, id)
+	}
+
+	mq.ackMessages(chunks.cleanup())
+
+	if !complete {
+		return nil, nil, "", nil, false
+	}
+
+	mq.Logger().Tracef("%s reassembled %d chunks into a message of %d bytes", mq.String(), chunk.Count, len(payload))
+
+	return payload, header, replyTo, acks, true
+}
@@ -0,0 +1,291 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/message"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func newChunkingConnector(maxChunkSize int) *BridgeConnector {
+	mq := &BridgeConnector{}
+	mq.init(NewBridgeServer(), conf.ConnectorConfig{
+		Chunking:     true,
+		MaxChunkSize: maxChunkSize,
+	}, "test")
+	return mq
+}
+
+type publishedMessage struct {
+	data    []byte
+	header  nats.Header
+	replyTo string
+}
+
+func TestPublishAndAssembleChunks(t *testing.T) {
+	sender := newChunkingConnector(1024)
+	receiver := newChunkingConnector(0)
+
+	published := []publishedMessage{}
+	cb := func(natsMsg []byte, header nats.Header, replyTo string) error {
+		published = append(published, publishedMessage{natsMsg, header, replyTo})
+		return nil
+	}
+
+	header := nats.Header{}
+	header.Set("MQ-Format", "MQSTR")
+
+	payload := bytes.Repeat([]byte("0123456789"), 1000)
+	err := sender.publishChunked(cb, payload, header, "reply")
+	require.NoError(t, err)
+	require.True(t, len(published) > 1)
+
+	for i, p := range published {
+		require.True(t, len(p.data)+natsHeaderSize(p.header) <= 1024)
+		require.True(t, message.IsChunk(p.data))
+		if i == 0 {
+			require.Equal(t, "reply", p.replyTo)
+			require.Equal(t, "MQSTR", p.header.Get("MQ-Format"))
+		} else {
+			require.Empty(t, p.replyTo)
+			require.Nil(t, p.header)
+		}
+	}
+
+	// deliver the first chunk last, the header and reply should still come from it
+	order := append(published[1:], published[0])
+	for i, p := range order {
+		data, h, reply, _, ok := receiver.assembleChunk(p.data, p.header, p.replyTo, nil)
+
+		if i < len(order)-1 {
+			require.False(t, ok)
+			continue
+		}
+
+		require.True(t, ok)
+		require.Equal(t, payload, data)
+		require.Equal(t, "reply", reply)
+		require.Equal(t, "MQSTR", h.Get("MQ-Format"))
+	}
+
+	require.Empty(t, receiver.chunks.acks)
+	require.Empty(t, receiver.chunks.headers)
+}
+
+func TestSmallMessagesAreNotChunked(t *testing.T) {
+	sender := newChunkingConnector(1024)
+
+	published := [][]byte{}
+	cb := func(natsMsg []byte, header nats.Header, replyTo string) error {
+		published = append(published, natsMsg)
+		return nil
+	}
+
+	err := sender.publishChunked(cb, []byte("hello world"), nil, "")
+	require.NoError(t, err)
+	require.Len(t, published, 1)
+	require.Equal(t, "hello world", string(published[0]))
+
+	data, _, _, _, ok := sender.assembleChunk(published[0], nil, "", nil)
+	require.True(t, ok)
+	require.Equal(t, "hello world", string(data))
+}
+
+func TestChunkTimeoutCleansUp(t *testing.T) {
+	receiver := &BridgeConnector{}
+	receiver.init(NewBridgeServer(), conf.ConnectorConfig{
+		Chunking:     true,
+		ChunkTimeout: 50,
+	}, "test")
+
+	chunks, err := message.SplitIntoChunks(bytes.Repeat([]byte("0123456789"), 1000), 1024)
+	require.NoError(t, err)
+
+	_, _, _, _, ok := receiver.assembleChunk(chunks[0], nil, "", nil)
+	require.False(t, ok)
+	require.Len(t, receiver.chunks.acks, 1)
+
+	time.Sleep(100 * time.Millisecond)
+
+	other, err := message.SplitIntoChunks([]byte("hello world"), 1024)
+	require.NoError(t, err)
+
+	data, _, _, _, ok := receiver.assembleChunk(other[0], nil, "", nil)
+	require.True(t, ok)
+	require.Equal(t, "hello world", string(data))
+	require.Empty(t, receiver.chunks.acks)
+}
+
+func TestChunkExpiryRunsWithoutNewChunks(t *testing.T) {
+	receiver := &BridgeConnector{}
+	receiver.init(NewBridgeServer(), conf.ConnectorConfig{
+		Chunking:     true,
+		ChunkTimeout: 50,
+	}, "test")
+
+	chunks, err := message.SplitIntoChunks(bytes.Repeat([]byte("0123456789"), 1000), 1024)
+	require.NoError(t, err)
+
+	receiver.Lock()
+	_, _, _, _, ok := receiver.assembleChunk(chunks[0], nil, "", nil)
+	require.False(t, ok)
+	receiver.startChunkExpiry()
+	receiver.Unlock()
+
+	time.Sleep(200 * time.Millisecond)
+
+	receiver.Lock()
+	defer receiver.Unlock()
+	receiver.stopChunkExpiry()
+	require.Empty(t, receiver.chunks.acks)
+	count, _ := receiver.chunks.assembler.Pending()
+	require.Equal(t, 0, count)
+}
+
+func TestChunkConfigErrors(t *testing.T) {
+	config := conf.ConnectorConfig{
+		Type:         "Queue2NATS",
+		Subject:      "test",
+		Queue:        "DEV.QUEUE.1",
+		Chunking:     true,
+		MaxChunkSize: 10,
+	}
+
+	_, err := CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+}
+
+func TestSendOnQueueReceiveChunksOnNats(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+	msg := bytes.Repeat([]byte("0123456789"), 300)
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:           "Queue2NATS",
+			Subject:        subject,
+			Queue:          queue,
+			ExcludeHeaders: true,
+			Chunking:       true,
+			MaxChunkSize:   1024,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	done := make(chan []byte)
+	assembler := message.NewChunkAssembler(0, 0)
+
+	sub, err := tbs.NC.Subscribe(subject, func(m *nats.Msg) {
+		chunk, err := message.DecodeChunk(m.Data)
+		if err != nil {
+			return
+		}
+		payload, complete, _ := assembler.Add(chunk)
+		if complete {
+			done <- payload
+		}
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	err = tbs.PutMessageOnQueue(queue, ibmmq.NewMQMD(), msg)
+	require.NoError(t, err)
+
+	select {
+	case received := <-done:
+		require.Equal(t, msg, received)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for the chunks")
+	}
+}
+
+func TestSendChunksOnNATSReceiveOnQueue(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+	msg := bytes.Repeat([]byte("0123456789"), 300)
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:           "NATS2Queue",
+			Subject:        subject,
+			Queue:          queue,
+			ExcludeHeaders: true,
+			Chunking:       true,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	chunks, err := message.SplitIntoChunks(msg, 1024)
+	require.NoError(t, err)
+
+	for _, chunk := range chunks {
+		err = tbs.NC.Publish(subject, chunk)
+		require.NoError(t, err)
+	}
+
+	_, _, data, err := tbs.GetMessageFromQueue(queue, 5000)
+	require.NoError(t, err)
+	require.Equal(t, msg, data)
+}
+
+func TestInvalidChunksOnStanAreAcked(t *testing.T) {
+	channel := "test"
+	queue := "DEV.QUEUE.1"
+	msg := "hello world"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:           "Stan2Queue",
+			Channel:        channel,
+			Queue:          queue,
+			ExcludeHeaders: true,
+			Chunking:       true,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	err = tbs.SC.Publish(channel, []byte(message.ChunkMagic+"not a chunk"))
+	require.NoError(t, err)
+
+	err = tbs.SC.Publish(channel, []byte(msg))
+	require.NoError(t, err)
+
+	_, _, data, err := tbs.GetMessageFromQueue(queue, 5000)
+	require.NoError(t, err)
+	require.Equal(t, msg, string(data))
+
+	stats := tbs.Bridge.SafeStats()
+	connStats := stats.Connections[0]
+	require.Equal(t, int64(1), connStats.MessagesOut)
+	require.Equal(t, int64(1), connStats.ConversionErrors)
+	require.Equal(t, uint64(2), connStats.AckedSequence)
+}
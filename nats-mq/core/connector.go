@@ -21,7 +21,9 @@ import (
 	"time"
 
 	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/message"
 	"github.com/nats-io/nats-mq/nats-mq/conf"
+	"github.com/nats-io/nats-mq/nats-mq/logging"
 	nats "github.com/nats-io/nats.go"
 	"github.com/nats-io/nuid"
 	stan "github.com/nats-io/stan.go"
@@ -38,10 +40,50 @@ type Connector interface {
 	ID() string
 
 	Stats() ConnectorStats
+
+	LogLevel() logging.Level
+	SetLogLevel(level string) error
+}
+
+// connectorValidators check the options for each feature, in the order they are listed
+var connectorValidators = []func(config conf.ConnectorConfig) error{
+	validateEncoding,
+	validateNATSHeaders,
+	validateCCSID,
+	validateRFH2,
+	validateMessageGroups,
+	validateChunking,
+	validateObjectStore,
+	validateBuffers,
+	validateRequestReply,
+	validateService,
+	validateReports,
+	validateExpiry,
+	validateDedupe,
+	validatePutContext,
+	validateRoutes,
+	validateBacklog,
+	validateLatency,
+	validateLogLevel,
+}
+
+// validateConnectorConfig checks the options that are shared by all connector types
+func validateConnectorConfig(config conf.ConnectorConfig) error {
+	for _, validate := range connectorValidators {
+		if err := validate(config); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // CreateConnector builds a connector from the supplied configuration
 func CreateConnector(config conf.ConnectorConfig, bridge *BridgeServer) (Connector, error) {
+	if err := validateConnectorConfig(config); err != nil {
+		return nil, err
+	}
+
 	switch config.Type {
 	case conf.Queue2NATS:
 		bridge.RegisterReplyInfo("S:"+config.Subject, config)
@@ -80,7 +122,25 @@ type BridgeConnector struct {
 	bridge *BridgeServer
 	stats  ConnectorStats
 
-	qMgr *ibmmq.MQQueueManager
+	qMgr        *ibmmq.MQQueueManager
+	poisonQueue *ibmmq.MQObject // opened the first time a message is too large for the max buffer size
+
+	group  *messageGroup // the partially read MQ message group, if any
+	chunks *chunkState   // incomplete chunked messages, only used with chunking
+
+	objectStores map[string]nats.ObjectStore // object store buckets in use, by name
+	offloaded    []*message.ObjectReference  // objects stored in the current unit of work
+
+	requests *requestState // the reply queue and requests in flight, only used with request/reply
+
+	dedupe *dedupeCache // IDs of messages put to MQ, only used with a dedupe window
+
+	routes []route // destinations by priority and persistence, only used with routes
+
+	backlog *backlogMonitor // checks the source queue or channel, only used with a backlog interval
+
+	logger      *logging.LevelLogger // the bridge's output, with the connector's prefix and level
+	fieldLogger logging.Logger       // the logger with the connector's id and name as fields
 }
 
 // Start is a no-op, designed for overriding
@@ -114,7 +174,9 @@ func (mq *BridgeConnector) ID() string {
 func (mq *BridgeConnector) Stats() ConnectorStats {
 	mq.Lock()
 	defer mq.Unlock()
-	return mq.stats
+	stats := mq.stats
+	stats.UpdateWindows(time.Now()) // the window is shared with the copy, so summarize it while the lock is held
+	return stats
 }
 
 // Init sets up common fields for all connectors
@@ -124,10 +186,24 @@ func (mq *BridgeConnector) init(bridge *BridgeServer, config conf.ConnectorConfi
 	mq.stats = NewConnectorStats()
 	mq.stats.Name = name
 	mq.stats.ID = mq.config.ID
+	mq.stats.Type = mq.config.Type
+	mq.stats.monitorsBacklog = monitorsBacklog(mq.config)
 
 	if mq.config.ID == "" {
 		mq.stats.ID = nuid.Next()
 	}
+
+	mq.initLogger()
+
+	if mq.config.Chunking {
+		mq.chunks = newChunkState(mq.config.ChunkTimeout, mq.config.ChunkMemoryLimit)
+	}
+
+	if mq.config.DedupeWindow > 0 {
+		mq.dedupe = newDedupeCache(mq.config.DedupeWindow, mq.config.DedupeSize, mq.config.DedupeBucket)
+	}
+
+	mq.parseRoutes()
 }
 
 // init the MQ connection - expects the lock to be held by the caller
@@ -139,9 +215,12 @@ func (mq *BridgeConnector) connectToMQ() error {
 		return err
 	}
 
-	mq.bridge.Logger().Tracef("connected to queue manager %s at %s as %s for %s", mqconfig.QueueManager, mqconfig.ConnectionName, mqconfig.ChannelName, mq.String())
+	mq.Logger().Tracef("connected to queue manager %s at %s as %s for %s", mqconfig.QueueManager, mqconfig.ConnectionName, mqconfig.ChannelName, mq.String())
 
 	mq.qMgr = qMgr
+	mq.poisonQueue = nil  // handles from an earlier connection are closed by the disconnect
+	mq.group = nil        // a partial group was backed out when the earlier connection closed
+	mq.backoutOffloaded() // and so were the objects stored for it
 	return nil
 }
 
@@ -177,7 +256,7 @@ func (mq *BridgeConnector) subscribeToTopic(topicName string) (*ibmmq.MQObject,
 // connectToTopic sets up a topic for output
 func (mq *BridgeConnector) connectToTopic(topicName string) (*ibmmq.MQObject, error) {
 	mqod := ibmmq.NewMQOD()
-	openOptions := ibmmq.MQOO_OUTPUT
+	openOptions := mq.outputOptions()
 	mqod.ObjectType = ibmmq.MQOT_TOPIC
 	mqod.ObjectString = topicName
 	topic, err := mq.qMgr.Open(mqod, openOptions)
@@ -188,24 +267,30 @@ func (mq *BridgeConnector) connectToTopic(topicName string) (*ibmmq.MQObject, er
 }
 
 // NATSCallback used by mq-nats connectors in an MQ library callback
+// The header is only set when the connector uses NATS headers
 // The lock will be held by the caller!
-type NATSCallback func(natsMsg []byte, replyTo string) error
+type NATSCallback func(natsMsg []byte, header nats.Header, replyTo string) error
 
 // ShutdownCallback is returned when setting up a callback or polling so the connector can shut it down
 type ShutdownCallback func() error
 
 func (mq *BridgeConnector) setUpListener(target *ibmmq.MQObject, cb NATSCallback, conn Connector) (ShutdownCallback, error) {
+	return mq.setUpMQListener(mq.qMgr, target, mq.createMQCallback(cb, conn))
+}
+
+// setUpMQListener calls the MQ callback for each message on the target, using polling or callbacks based on the config
+func (mq *BridgeConnector) setUpMQListener(qMgr *ibmmq.MQQueueManager, target *ibmmq.MQObject, callback ibmmq.MQCB_FUNCTION) (ShutdownCallback, error) {
 	if mq.config.UsePolling {
-		return mq.setUpPolling(target, cb, conn)
+		return mq.setUpPolling(qMgr, target, callback)
 	}
-	return mq.setUpCallback(target, cb, conn)
+	return mq.setUpCallback(qMgr, target, callback)
 }
 
-func (mq *BridgeConnector) setUpCallback(target *ibmmq.MQObject, cb NATSCallback, conn Connector) (ShutdownCallback, error) {
+func (mq *BridgeConnector) setUpCallback(qMgr *ibmmq.MQQueueManager, target *ibmmq.MQObject, callback ibmmq.MQCB_FUNCTION) (ShutdownCallback, error) {
 	mqmd := ibmmq.NewMQMD()
 	gmo := ibmmq.NewMQGMO()
 	cmho := ibmmq.NewMQCMHO()
-	propsMsgHandle, err := mq.qMgr.CrtMH(cmho)
+	propsMsgHandle, err := qMgr.CrtMH(cmho)
 
 	if err != nil {
 		return nil, err
@@ -216,11 +301,18 @@ func (mq *BridgeConnector) setUpCallback(target *ibmmq.MQObject, cb NATSCallback
 	gmo.Options |= ibmmq.MQGMO_WAIT
 	gmo.Options |= ibmmq.MQGMO_FAIL_IF_QUIESCING
 	gmo.Options |= ibmmq.MQGMO_PROPERTIES_IN_HANDLE
+	mq.requestConversion(mqmd, gmo)
+	mq.requestGroups(mqmd, gmo)
 
-	mq.bridge.Logger().Tracef("setting up callback for %s", mq.String())
+	mq.Logger().Tracef("setting up callback for %s", mq.String())
 
 	cbd := ibmmq.NewMQCBD()
-	cbd.CallbackFunction = mq.createMQCallback(cb, conn)
+	cbd.CallbackFunction = callback
+
+	// MQ grows the callback buffer as needed, up to the max, larger messages go to the poison queue
+	if mq.config.MaxBufferSize > 0 {
+		cbd.MaxMsgLength = int32(mq.config.MaxBufferSize)
+	}
 
 	err = target.CB(ibmmq.MQOP_REGISTER, cbd, mqmd, gmo)
 
@@ -230,24 +322,24 @@ func (mq *BridgeConnector) setUpCallback(target *ibmmq.MQObject, cb NATSCallback
 
 	ctlo := ibmmq.NewMQCTLO()
 	ctlo.Options = ibmmq.MQCTLO_FAIL_IF_QUIESCING
-	err = mq.qMgr.Ctl(ibmmq.MQOP_START, ctlo)
+	err = qMgr.Ctl(ibmmq.MQOP_START, ctlo)
 	if err != nil {
 		return nil, err
 	}
 
 	return func() error {
-		if err := mq.qMgr.Ctl(ibmmq.MQOP_STOP, ctlo); err != nil {
-			mq.bridge.Logger().Noticef("error stopping callbacks, %s", err.Error())
+		if err := qMgr.Ctl(ibmmq.MQOP_STOP, ctlo); err != nil {
+			mq.Logger().Noticef("error stopping callbacks, %s", err.Error())
 		}
 		gmo.MsgHandle.DltMH(ibmmq.NewMQDMHO()) // ignore the error
 		return nil
 	}, nil
 }
 
-func (mq *BridgeConnector) setUpPolling(target *ibmmq.MQObject, cb NATSCallback, conn Connector) (ShutdownCallback, error) {
+func (mq *BridgeConnector) setUpPolling(qMgr *ibmmq.MQQueueManager, target *ibmmq.MQObject, callback ibmmq.MQCB_FUNCTION) (ShutdownCallback, error) {
 	bufferSize := mq.config.IncomingBufferSize
 	if bufferSize == 0 {
-		bufferSize = 1024 * 8
+		bufferSize = DefaultIncomingBufferSize
 	}
 	buffer := make([]byte, bufferSize)
 
@@ -257,37 +349,52 @@ func (mq *BridgeConnector) setUpPolling(target *ibmmq.MQObject, cb NATSCallback,
 	}
 	running := true
 	done := make(chan bool)
-	callback := mq.createMQCallback(cb, conn)
 
 	cmho := ibmmq.NewMQCMHO()
-	propsMsgHandle, err := mq.qMgr.CrtMH(cmho)
+	propsMsgHandle, err := qMgr.CrtMH(cmho)
 
 	if err != nil {
 		return nil, err
 	}
 
-	mq.bridge.Logger().Tracef("starting polling for %s", mq.String())
+	newGet := func() (*ibmmq.MQMD, *ibmmq.MQGMO) {
+		mqmd := ibmmq.NewMQMD()
+		gmo := ibmmq.NewMQGMO()
+		gmo.Options = ibmmq.MQGMO_SYNCPOINT
+		gmo.Options |= ibmmq.MQGMO_WAIT
+		gmo.Options |= ibmmq.MQGMO_FAIL_IF_QUIESCING
+		gmo.Options |= ibmmq.MQGMO_PROPERTIES_IN_HANDLE
+		gmo.MsgHandle = propsMsgHandle
+		gmo.WaitInterval = waitTimeout
+		mq.requestConversion(mqmd, gmo)
+		mq.requestGroups(mqmd, gmo)
+		return mqmd, gmo
+	}
+
+	mq.Logger().Tracef("starting polling for %s", mq.String())
 
 	go func() {
 		for running {
-			mqmd := ibmmq.NewMQMD()
-			gmo := ibmmq.NewMQGMO()
-			gmo.Options = ibmmq.MQGMO_SYNCPOINT
-			gmo.Options |= ibmmq.MQGMO_WAIT
-			gmo.Options |= ibmmq.MQGMO_FAIL_IF_QUIESCING
-			gmo.Options |= ibmmq.MQGMO_PROPERTIES_IN_HANDLE
-			gmo.MsgHandle = propsMsgHandle
-			gmo.WaitInterval = waitTimeout
+			mqmd, gmo := newGet()
+
+			datalen, err := target.Get(mqmd, gmo, buffer)
+			data := buffer[0:datalen]
 
-			len, err := target.Get(mqmd, gmo, buffer)
+			if isTruncated(err) {
+				mqmd, gmo, data, err = mq.getTruncated(target, mqmd, gmo, bufferSize, err, newGet)
+			}
+
+			if isConversionWarning(err) {
+				mqmd, gmo, data, err = mq.getUnconverted(qMgr, target, mqmd, bufferSize, err, newGet)
+			}
 
 			if err != nil {
 				mqret := err.(*ibmmq.MQReturn)
 				if mqret.MQRC != ibmmq.MQRC_NO_MSG_AVAILABLE {
-					callback(mq.qMgr, target, mqmd, gmo, buffer[0:len], nil, mqret)
+					callback(qMgr, target, mqmd, gmo, data, nil, mqret)
 				}
 			} else {
-				callback(mq.qMgr, target, mqmd, gmo, buffer[0:len], nil, nil)
+				callback(qMgr, target, mqmd, gmo, data, nil, nil)
 			}
 
 			select {
@@ -312,25 +419,13 @@ func (mq *BridgeConnector) createMQCallback(cb NATSCallback, conn Connector) fun
 		defer mq.Unlock()
 		start := time.Now()
 
-		if mqErr != nil && mqErr.MQCC != ibmmq.MQCC_OK {
-			if mqErr.MQRC == ibmmq.MQRC_NO_MSG_AVAILABLE {
-				mq.bridge.Logger().Tracef("message timeout on %s", mq.String())
-				return
-			}
-
-			err := fmt.Errorf("mq error in callback %s", mqErr.Error())
-			go mq.bridge.ConnectorError(conn, err)
-			return
-		}
-
-		// ignore event calls
-		if cbc != nil && cbc.CallType == ibmmq.MQCBCT_EVENT_CALL {
+		if !mq.checkMQCallback(conn, hObj, md, cbc, mqErr) {
 			return
 		}
 
 		bufferLen := len(buffer)
 
-		mq.bridge.Logger().Tracef("%s got raw mq message with body of length %d", mq.String(), bufferLen)
+		mq.messageLogger(bufferLen, nil).Tracef("%s got raw mq message with body of length %d", mq.String(), bufferLen)
 
 		qmgrFlag := mq.qMgr
 
@@ -339,45 +434,135 @@ func (mq *BridgeConnector) createMQCallback(cb NATSCallback, conn Connector) fun
 		}
 
 		mq.stats.AddMessageIn(int64(bufferLen))
-		natsMsg, replyTo, err := mq.bridge.MQToNATSMessage(md, gmo.MsgHandle, buffer, bufferLen, qmgrFlag)
+		mq.recordMQLatency(md, gmo, start)
+
+		span := mq.startMQSpan(&gmo.MsgHandle, start)
+		defer span.End()
+
+		publish := mq.routeCallback(cb, md)
+
+		if mq.isGroupMessage(gmo) {
+			mq.handleGroupMessage(publish, conn, md, gmo, buffer, start)
+			return
+		}
+
+		var natsMsg []byte
+		var header nats.Header
+		var replyTo string
+		var err error
+
+		convertStart := time.Now()
+
+		if mq.config.NATSHeaders {
+			natsMsg, header, replyTo, err = mq.bridge.MQToNATSHeaders(md, gmo.MsgHandle, buffer, bufferLen, mq.messageOptions())
+		} else {
+			natsMsg, replyTo, err = mq.bridge.MQToNATSMessageWithOptions(md, gmo.MsgHandle, buffer, bufferLen, qmgrFlag, mq.messageOptions())
+		}
+
+		span.Step("convert", convertStart, err)
 
 		if err != nil {
-			mq.bridge.Logger().Noticef("message conversion failure %s, %s", mq.String(), err.Error())
-			mq.qMgr.Back()
+			mq.messageLogger(bufferLen, err).Noticef("message conversion failure %s, %s", mq.String(), err.Error())
+			mq.stats.AddConversionError(err)
+			mq.handleUndelivered(conn, md, buffer)
 			return
 		}
 
-		err = cb(natsMsg, replyTo)
+		header = withNATSMsgID(header, mq.natsMsgID(md, gmo.MsgHandle))
+		header = withTraceContext(header, span.Context())
+
+		publishStart := time.Now()
+		err = mq.publishPayload(publish, natsMsg, header, replyTo)
+		span.Step("publish", publishStart, err)
 
 		if err != nil {
-			mq.bridge.Logger().Noticef("publish failure for %s, %s", mq.String(), err.Error())
-			mq.qMgr.Back()
+			mq.messageLogger(bufferLen, err).Noticef("publish failure for %s, %s", mq.String(), err.Error())
+			mq.stats.AddPublishError(err)
+			mq.handleUndelivered(conn, md, buffer)
 		} else {
-			if err := mq.qMgr.Cmit(); err != nil {
-				mq.bridge.Logger().Noticef("failed to commit, %s", err.Error())
+			mq.sendDeliveryReports(md, buffer)
+
+			commitStart := time.Now()
+			err = mq.qMgr.Cmit()
+			span.Step("commit", commitStart, err)
+
+			if err != nil {
+				mq.messageLogger(bufferLen, err).Noticef("failed to commit, %s", err.Error())
+				mq.stats.AddCommitError(err)
+				mq.backoutOffloaded()
 				go mq.bridge.ConnectorError(conn, err) // run in a go routine so we can finish this method and unlock
 				return
 			}
+			mq.commitOffloaded()
 			mq.stats.AddMessageOut(int64(len(natsMsg)))
 			mq.stats.AddRequestTime(time.Since(start))
 		}
 	}
 }
 
-func (mq *BridgeConnector) stanMessageHandler(natsMsg []byte, replyTo string) error {
-	return mq.bridge.Stan().Publish(mq.config.Channel, natsMsg)
+// checkMQCallback handles errors and event calls in an MQ callback, returns true if there is a message to handle
+// expects the lock to be held
+func (mq *BridgeConnector) checkMQCallback(conn Connector, hObj *ibmmq.MQObject, md *ibmmq.MQMD, cbc *ibmmq.MQCBC, mqErr *ibmmq.MQReturn) bool {
+	if mqErr != nil && mqErr.MQCC == ibmmq.MQCC_WARNING && isConversionError(mqErr) {
+		mq.publishUnconverted(md, mqErr)
+		mqErr = nil
+	}
+
+	if mqErr != nil && mqErr.MQCC != ibmmq.MQCC_OK {
+		if mqErr.MQRC == ibmmq.MQRC_NO_MSG_AVAILABLE {
+			mq.Logger().Tracef("message timeout on %s", mq.String())
+			return false
+		}
+
+		if mqErr.MQRC == ibmmq.MQRC_TRUNCATED_MSG_FAILED {
+			dataLength := 0
+			if cbc != nil {
+				dataLength = int(cbc.DataLength)
+			}
+			mq.handlePoisonMessage(conn, hObj, md, dataLength)
+			return false
+		}
+
+		err := fmt.Errorf("mq error in callback %s", mqErr.Error())
+		go mq.bridge.ConnectorError(conn, err)
+		return false
+	}
+
+	// ignore event calls
+	if cbc != nil && cbc.CallType == ibmmq.MQCBCT_EVENT_CALL {
+		return false
+	}
+
+	return true
 }
 
-func (mq *BridgeConnector) natsMessageHandler(natsMsg []byte, replyTo string) error {
-	var err error
-	if replyTo != "" {
-		err = mq.bridge.NATS().PublishRequest(mq.config.Subject, replyTo, natsMsg)
-	} else {
-		err = mq.bridge.NATS().Publish(mq.config.Subject, natsMsg)
+// publishPayload offloads or chunks large payloads, based on the configuration, before passing them to the callback
+func (mq *BridgeConnector) publishPayload(cb NATSCallback, natsMsg []byte, header nats.Header, replyTo string) error {
+	natsMsg, err := mq.offloadPayload(natsMsg)
+	if err != nil {
+		return err
+	}
+
+	err = mq.publishChunked(cb, natsMsg, header, replyTo)
+	if err != nil {
+		mq.backoutOffloaded()
 	}
 	return err
 }
 
+func (mq *BridgeConnector) stanMessageHandler(natsMsg []byte, header nats.Header, replyTo string) error {
+	return mq.bridge.Stan().Publish(mq.config.Channel, natsMsg)
+}
+
+func (mq *BridgeConnector) natsMessageHandler(natsMsg []byte, header nats.Header, replyTo string) error {
+	return mq.bridge.NATS().PublishMsg(&nats.Msg{
+		Subject: mq.config.Subject,
+		Reply:   replyTo,
+		Header:  header,
+		Data:    natsMsg,
+	})
+}
+
 // set up a nats subscription, assumes the lock is held
 func (mq *BridgeConnector) subscribeToNATS(subject string, natsQueue string, dest *ibmmq.MQObject) (*nats.Subscription, error) {
 	callback := func(m *nats.Msg) {
@@ -391,24 +576,89 @@ func (mq *BridgeConnector) subscribeToNATS(subject string, natsQueue string, des
 			qmgrFlag = nil
 		}
 		mq.stats.AddMessageIn(int64(len(m.Data)))
-		mqmd, handle, buffer, err := mq.bridge.NATSToMQMessage(m.Data, m.Reply, qmgrFlag)
 
-		mq.bridge.Logger().Tracef("%s got decoded nats message with body length %d", mq.String(), len(buffer))
+		reference, natsHeader, reply, _, ok := mq.assembleChunk(m.Data, m.Header, m.Reply, nil)
+		if !ok {
+			return
+		}
+
+		msgID := natsHeader.Get(nats.MsgIdHdr)
+		if mq.isDuplicate(msgID) {
+			mq.Logger().Tracef("%s dropped duplicate message %s", mq.String(), msgID)
+			mq.stats.AddDuplicate()
+			return
+		}
 
+		data, err := mq.resolvePayload(reference)
 		if err != nil {
-			mq.bridge.Logger().Noticef("message conversion failure, %s, %s", mq.String(), err.Error())
+			mq.Logger().Noticef("object store failure, %s, %s", mq.String(), err.Error())
+			mq.stats.AddConversionError(err)
+			return
+		}
+
+		var mqmd *ibmmq.MQMD
+		var handle ibmmq.MQMessageHandle
+		var buffer []byte
+
+		convertStart := time.Now()
+
+		if mq.config.NATSHeaders {
+			mqmd, handle, buffer, err = mq.bridge.NATSHeadersToMQMessage(data, natsHeader, reply, mq.qMgr, mq.messageOptions())
+		} else {
+			mqmd, handle, buffer, err = mq.bridge.NATSToMQMessageWithOptions(data, reply, qmgrFlag, mq.messageOptions())
+		}
+
+		span := mq.startNATSSpan(natsHeader, handle, start)
+		defer span.End()
+		span.Step("convert", convertStart, err)
+
+		mq.messageLogger(len(buffer), nil).Tracef("%s got decoded nats message with body length %d", mq.String(), len(buffer))
+
+		if mq.droppedExpired(err) {
+			mq.consumeReference(reference)
 			return
 		}
 
+		if err != nil {
+			mq.messageLogger(len(data), err).Noticef("message conversion failure, %s, %s", mq.String(), err.Error())
+			mq.stats.AddConversionError(err)
+			return
+		}
+
+		buffer, err = mq.convertForPut(mqmd, buffer)
+		if err != nil {
+			span.SetError(err)
+			mq.messageLogger(len(buffer), err).Noticef("message conversion failure, %s, %s", mq.String(), err.Error())
+			mq.stats.AddConversionError(err)
+			return
+		}
+
+		if mq.isRequest(reply) {
+			mq.prepareRequest(mqmd)
+		}
+
+		mq.applyDefaultExpiry(mqmd)
+
 		pmo := ibmmq.NewMQPMO()
 		pmo.Options = ibmmq.MQPMO_NO_SYNCPOINT
 		pmo.OriginalMsgHandle = handle
+		mq.applyPutContext(mqmd, pmo)
+		mq.applyPriorityAndPersistence(mqmd, natsHeader)
+		pmo.OriginalMsgHandle = mq.traceHandle(pmo.OriginalMsgHandle, span)
 
+		putStart := time.Now()
 		err = dest.Put(mqmd, pmo, buffer)
+		span.Step("put", putStart, err)
 
 		if err != nil {
-			mq.bridge.Logger().Noticef("MQ publish failure, %s, %s", mq.String(), err.Error())
+			mq.messageLogger(len(buffer), err).Noticef("MQ publish failure, %s, %s", mq.String(), err.Error())
+			mq.stats.AddPutError(err)
 		} else {
+			if mq.isRequest(reply) {
+				mq.trackRequest(mqmd, reply)
+			}
+			mq.recordPut(msgID)
+			mq.consumeReference(reference)
 			mq.stats.AddMessageOut(int64(len(buffer)))
 			mq.stats.AddRequestTime(time.Since(start))
 		}
@@ -459,23 +709,68 @@ func (mq *BridgeConnector) subscribeToChannel(dest *ibmmq.MQObject) (stan.Subscr
 		}
 
 		mq.stats.AddMessageIn(int64(len(msg.Data)))
-		mqmd, handle, buffer, err := mq.bridge.NATSToMQMessage(msg.Data, "", qmgrFlag)
+
+		reference, _, _, acks, ok := mq.assembleChunk(msg.Data, nil, "", msg)
+		if !ok {
+			return
+		}
+
+		data, err := mq.resolvePayload(reference)
 		if err != nil {
-			mq.bridge.Logger().Noticef("message conversion failure, %s, %s", mq.String(), err.Error())
+			mq.Logger().Noticef("object store failure, %s, %s", mq.String(), err.Error())
+			mq.stats.AddConversionError(err)
 			return
 		}
-		mq.bridge.Logger().Tracef("%s got decoded stan message with body length %d", mq.String(), len(buffer))
+
+		convertStart := time.Now()
+		mqmd, handle, buffer, err := mq.bridge.NATSToMQMessageWithOptions(data, "", qmgrFlag, mq.messageOptions())
+
+		span := mq.startNATSSpan(nil, handle, start)
+		defer span.End()
+		span.Step("convert", convertStart, err)
+
+		if mq.droppedExpired(err) {
+			mq.ackMessages(acks)
+			mq.consumeReference(reference)
+			return
+		}
+		if err != nil {
+			mq.messageLogger(len(data), err).Noticef("message conversion failure, %s, %s", mq.String(), err.Error())
+			mq.stats.AddConversionError(err)
+			return
+		}
+		mq.messageLogger(len(buffer), nil).Tracef("%s got decoded stan message with body length %d", mq.String(), len(buffer))
+
+		handle, err = mq.recordStanLatency(msg, start, handle)
+		if err != nil {
+			mq.Logger().Noticef("failed to set the latency property for %s, %s", mq.String(), err.Error())
+		}
+
+		buffer, err = mq.convertForPut(mqmd, buffer)
+		if err != nil {
+			span.SetError(err)
+			mq.messageLogger(len(buffer), err).Noticef("message conversion failure, %s, %s", mq.String(), err.Error())
+			mq.stats.AddConversionError(err)
+			return
+		}
+
+		mq.applyDefaultExpiry(mqmd)
 
 		pmo := ibmmq.NewMQPMO()
 		pmo.Options = ibmmq.MQPMO_NO_SYNCPOINT
-		pmo.OriginalMsgHandle = handle
+		pmo.OriginalMsgHandle = mq.traceHandle(handle, span)
+		mq.applyPutContext(mqmd, pmo)
 
+		putStart := time.Now()
 		err = dest.Put(mqmd, pmo, buffer)
+		span.Step("put", putStart, err)
 
 		if err != nil {
-			mq.bridge.Logger().Noticef("MQ put failure, %s, %s", mq.String(), err.Error())
+			mq.messageLogger(len(buffer), err).Noticef("MQ put failure, %s, %s", mq.String(), err.Error())
+			mq.stats.AddPutError(err)
 		} else {
-			msg.Ack()
+			mq.ackMessages(acks)
+			mq.consumeReference(reference)
 			mq.stats.AddMessageOut(int64(len(buffer)))
 			mq.stats.AddRequestTime(time.Since(start))
 		}
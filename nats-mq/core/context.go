@@ -0,0 +1,81 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+)
+
+// validatePutContext checks the put context, and that it and copying the persistence are only used when
+// putting to MQ
+func validatePutContext(config conf.ConnectorConfig) error {
+	switch config.PutContext {
+	case "":
+	case conf.PutContextIdentity, conf.PutContextAll:
+		if config.ExcludeHeaders {
+			return fmt.Errorf("put context can't be used when headers are excluded")
+		}
+	default:
+		return fmt.Errorf("unknown put context %q in configuration", config.PutContext)
+	}
+
+	if config.PutContext != "" || config.CopyPersistence {
+		switch config.Type {
+		case conf.NATS2Queue, conf.Stan2Queue, conf.NATS2Topic, conf.Stan2Topic:
+		default:
+			return fmt.Errorf("put context and persistence can only be used by connectors that put messages to MQ")
+		}
+	}
+
+	return nil
+}
+
+// outputOptions returns the open options for the queue or topic a connector puts to, the destination
+// has to be opened with the authority to set the context the connector puts with
+func (mq *BridgeConnector) outputOptions() int32 {
+	switch mq.config.PutContext {
+	case conf.PutContextIdentity:
+		return ibmmq.MQOO_OUTPUT | ibmmq.MQOO_SET_IDENTITY_CONTEXT
+	case conf.PutContextAll:
+		return ibmmq.MQOO_OUTPUT | ibmmq.MQOO_SET_ALL_CONTEXT
+	default:
+		return ibmmq.MQOO_OUTPUT
+	}
+}
+
+// applyPutContext adds the put options for the connector's context to the PMO, messages without a put date
+// and time only get their identity context, the persistence is reset to the queue default unless the
+// connector copies it from the message
+func (mq *BridgeConnector) applyPutContext(mqmd *ibmmq.MQMD, pmo *ibmmq.MQPMO) {
+	if !mq.config.CopyPersistence {
+		mqmd.Persistence = ibmmq.MQPER_PERSISTENCE_AS_Q_DEF
+	}
+
+	switch mq.config.PutContext {
+	case conf.PutContextIdentity:
+		pmo.Options |= ibmmq.MQPMO_SET_IDENTITY_CONTEXT
+	case conf.PutContextAll:
+		if strings.TrimSpace(mqmd.PutDate) == "" || strings.TrimSpace(mqmd.PutTime) == "" {
+			pmo.Options |= ibmmq.MQPMO_SET_IDENTITY_CONTEXT
+		} else {
+			pmo.Options |= ibmmq.MQPMO_SET_ALL_CONTEXT
+		}
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/message"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutContextConfigIsValidated(t *testing.T) {
+	configs := []conf.ConnectorConfig{
+		{Type: "NATS2Queue", Subject: "test", Queue: "DEV.QUEUE.1", PutContext: "some"},
+		{Type: "NATS2Queue", Subject: "test", Queue: "DEV.QUEUE.1", PutContext: "all", ExcludeHeaders: true},
+		{Type: "Queue2NATS", Subject: "test", Queue: "DEV.QUEUE.1", PutContext: "identity"},
+		{Type: "Queue2NATS", Subject: "test", Queue: "DEV.QUEUE.1", CopyPersistence: true},
+	}
+
+	for _, config := range configs {
+		_, err := CreateConnector(config, &BridgeServer{})
+		require.Error(t, err)
+	}
+}
+
+func TestPutWithAllContext(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:            "NATS2Queue",
+			Subject:         subject,
+			Queue:           queue,
+			PutContext:      "all",
+			CopyPersistence: true,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	bridgeMessage := message.NewBridgeMessage([]byte("hello"))
+	bridgeMessage.Header.UserIdentifier = "someone"
+	bridgeMessage.Header.ApplIdentityData = "identity"
+	bridgeMessage.Header.PutApplName = "origin"
+	bridgeMessage.Header.PutDate = "20190102"
+	bridgeMessage.Header.PutTime = "03040506"
+	bridgeMessage.Header.Persistence = ibmmq.MQPER_PERSISTENT
+	encoded, err := bridgeMessage.Encode()
+	require.NoError(t, err)
+
+	err = tbs.NC.Publish(subject, encoded)
+	require.NoError(t, err)
+
+	mqmd, _, data, err := tbs.GetMessageFromQueue(queue, 5000)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+
+	require.Equal(t, "someone", strings.TrimSpace(mqmd.UserIdentifier))
+	require.Equal(t, "identity", strings.TrimSpace(mqmd.ApplIdentityData))
+	require.Equal(t, "origin", strings.TrimSpace(mqmd.PutApplName))
+	require.Equal(t, "20190102", mqmd.PutDate)
+	require.Equal(t, "03040506", mqmd.PutTime)
+	require.Equal(t, ibmmq.MQPER_PERSISTENT, mqmd.Persistence)
+}
+
+func TestPutWithIdentityContext(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:       "NATS2Queue",
+			Subject:    subject,
+			Queue:      queue,
+			PutContext: "identity",
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	bridgeMessage := message.NewBridgeMessage([]byte("hello"))
+	bridgeMessage.Header.UserIdentifier = "someone"
+	bridgeMessage.Header.PutDate = "20190102"
+	bridgeMessage.Header.Persistence = ibmmq.MQPER_PERSISTENT
+	encoded, err := bridgeMessage.Encode()
+	require.NoError(t, err)
+
+	err = tbs.NC.Publish(subject, encoded)
+	require.NoError(t, err)
+
+	mqmd, _, _, err := tbs.GetMessageFromQueue(queue, 5000)
+	require.NoError(t, err)
+
+	require.Equal(t, "someone", strings.TrimSpace(mqmd.UserIdentifier))
+	require.NotEqual(t, "20190102", mqmd.PutDate)                  // the origin context is set by MQ
+	require.Equal(t, ibmmq.MQPER_NOT_PERSISTENT, mqmd.Persistence) // DEV.QUEUE.1 defaults to not persistent
+}
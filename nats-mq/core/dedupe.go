@@ -0,0 +1,279 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
+)
+
+// DefaultDedupeSize is the number of message IDs a connector remembers when the size isn't set
+const DefaultDedupeSize = 10000
+
+// validateDedupe checks the NATS message ID options, used by MQ to NATS connectors, and the dedupe
+// options, used by NATS to MQ connectors
+func validateDedupe(config conf.ConnectorConfig) error {
+	if config.NATSMsgID {
+		if config.Type != conf.Queue2NATS && config.Type != conf.Topic2NATS {
+			return fmt.Errorf("NATS message IDs are only supported by MQ to NATS connectors")
+		}
+
+		if config.Chunking {
+			return fmt.Errorf("NATS message IDs can't be used with chunking")
+		}
+	} else if config.NATSMsgIDProperty != "" {
+		return fmt.Errorf("a NATS message ID property requires NATS message IDs")
+	}
+
+	if config.DedupeWindow < 0 || config.DedupeSize < 0 {
+		return fmt.Errorf("dedupe window and size can't be negative")
+	}
+
+	if config.DedupeWindow > 0 && config.Type != conf.NATS2Queue && config.Type != conf.NATS2Topic {
+		return fmt.Errorf("dedupe is only supported by NATS to MQ connectors")
+	}
+
+	if config.DedupeBucket != "" {
+		if config.DedupeWindow == 0 {
+			return fmt.Errorf("a dedupe bucket requires a dedupe window")
+		}
+
+		if !validBucketName.MatchString(config.DedupeBucket) {
+			return fmt.Errorf("invalid dedupe bucket name %q", config.DedupeBucket)
+		}
+	}
+
+	return nil
+}
+
+// natsMsgID returns the ID to publish in the Nats-Msg-Id header for an MQ message, the hex encoded
+// MsgId or the value of the configured property, "" if IDs are off or the property isn't set
+func (mq *BridgeConnector) natsMsgID(md *ibmmq.MQMD, handle ibmmq.MQMessageHandle) string {
+	if !mq.config.NATSMsgID {
+		return ""
+	}
+
+	if mq.config.NATSMsgIDProperty == "" {
+		if isEmptyID(md.MsgId) {
+			return ""
+		}
+		return hex.EncodeToString(md.MsgId)
+	}
+
+	impo := ibmmq.NewMQIMPO()
+	impo.Options = ibmmq.MQIMPO_CONVERT_VALUE
+	_, value, err := handle.InqMP(impo, ibmmq.NewMQPD(), mq.config.NATSMsgIDProperty)
+	if err != nil || value == nil {
+		return ""
+	}
+
+	if b, ok := value.([]byte); ok {
+		return hex.EncodeToString(b)
+	}
+	return fmt.Sprint(value)
+}
+
+// withNATSMsgID sets the Nats-Msg-Id header, so JetStream can drop a message that is published again
+// after a failed commit, the header is created if there isn't one
+func withNATSMsgID(header nats.Header, id string) nats.Header {
+	if id == "" {
+		return header
+	}
+	if header == nil {
+		header = nats.Header{}
+	}
+	header.Set(nats.MsgIdHdr, id)
+	return header
+}
+
+// dedupeCache remembers the Nats-Msg-Id of messages a connector put to MQ for the dedupe window, up to a
+// maximum number of IDs, the oldest are forgotten first, the IDs are also stored in a KV bucket if one is set
+type dedupeCache struct {
+	window time.Duration
+	size   int
+	seen   map[string]time.Time
+	order  []string // IDs sorted by the time they were put
+	bucket string
+	kv     nats.KeyValue
+}
+
+func newDedupeCache(window int, size int, bucket string) *dedupeCache {
+	if size <= 0 {
+		size = DefaultDedupeSize
+	}
+
+	return &dedupeCache{
+		window: time.Duration(window) * time.Millisecond,
+		size:   size,
+		seen:   map[string]time.Time{},
+		bucket: bucket,
+	}
+}
+
+// expire forgets IDs that are older than the window, or over the size limit
+func (cache *dedupeCache) expire(now time.Time) {
+	for len(cache.order) > 0 {
+		id := cache.order[0]
+		if now.Sub(cache.seen[id]) < cache.window && len(cache.order) <= cache.size {
+			return
+		}
+		delete(cache.seen, id)
+		cache.order = cache.order[1:]
+	}
+}
+
+// contains returns true if the ID was put within the window
+func (cache *dedupeCache) contains(id string, now time.Time) bool {
+	cache.expire(now)
+	at, ok := cache.seen[id]
+	return ok && now.Sub(at) < cache.window
+}
+
+// add records an ID that was put
+func (cache *dedupeCache) add(id string, now time.Time) {
+	cache.insert(id, now)
+	cache.expire(now)
+}
+
+// restore records an ID that was put at an earlier time, such as one read from the KV bucket
+func (cache *dedupeCache) restore(id string, at time.Time, now time.Time) {
+	cache.insert(id, at)
+	cache.expire(now)
+}
+
+// insert keeps the order sorted by the time each ID was put, so that expire can stop at the first ID in the window
+func (cache *dedupeCache) insert(id string, at time.Time) {
+	if _, ok := cache.seen[id]; ok {
+		for i, existing := range cache.order {
+			if existing == id {
+				cache.order = append(cache.order[:i], cache.order[i+1:]...)
+				break
+			}
+		}
+	}
+
+	i := sort.Search(len(cache.order), func(i int) bool {
+		return cache.seen[cache.order[i]].After(at)
+	})
+	cache.order = append(cache.order, "")
+	copy(cache.order[i+1:], cache.order[i:])
+	cache.order[i] = id
+	cache.seen[id] = at
+}
+
+// dedupeKey encodes the ID as a valid KV key
+func dedupeKey(id string) string {
+	return hex.EncodeToString([]byte(id))
+}
+
+// dedupeStore returns the KV bucket for the cache, creating it with the window as its TTL if it doesn't
+// exist, nil is returned if the connector doesn't persist IDs - expects the lock to be held
+func (mq *BridgeConnector) dedupeStore() (nats.KeyValue, error) {
+	cache := mq.dedupe
+	if cache.bucket == "" || cache.kv != nil {
+		return cache.kv, nil
+	}
+
+	js, err := mq.bridge.NATS().JetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	kv, err := js.KeyValue(cache.bucket)
+
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		mq.Logger().Noticef("creating dedupe bucket %s for %s", cache.bucket, mq.String())
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket: cache.bucket,
+			TTL:    cache.window,
+		})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	cache.kv = kv
+	return kv, nil
+}
+
+// isDuplicate returns true if a message with the ID was already put to MQ within the dedupe window, the KV
+// bucket is checked for IDs that aren't in memory, KV errors are logged and only memory is used
+// expects the lock to be held
+func (mq *BridgeConnector) isDuplicate(id string) bool {
+	if mq.dedupe == nil || id == "" {
+		return false
+	}
+
+	now := time.Now()
+
+	if mq.dedupe.contains(id, now) {
+		return true
+	}
+
+	kv, err := mq.dedupeStore()
+	if err != nil {
+		mq.Logger().Noticef("dedupe bucket failure for %s, %s", mq.String(), err.Error())
+		return false
+	}
+
+	if kv == nil {
+		return false
+	}
+
+	entry, err := kv.Get(dedupeKey(id))
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return false
+	}
+	if err != nil {
+		mq.Logger().Noticef("dedupe bucket failure for %s, %s", mq.String(), err.Error())
+		mq.dedupe.kv = nil
+		return false
+	}
+
+	if now.Sub(entry.Created()) >= mq.dedupe.window {
+		return false
+	}
+
+	mq.dedupe.restore(id, entry.Created(), now)
+	return true
+}
+
+// recordPut remembers the ID of a message that was put to MQ - expects the lock to be held
+func (mq *BridgeConnector) recordPut(id string) {
+	if mq.dedupe == nil || id == "" {
+		return
+	}
+
+	mq.dedupe.add(id, time.Now())
+
+	kv, err := mq.dedupeStore()
+	if err == nil && kv != nil {
+		_, err = kv.Put(dedupeKey(id), nil)
+	}
+
+	if err != nil {
+		mq.Logger().Noticef("dedupe bucket failure for %s, %s", mq.String(), err.Error())
+		mq.dedupe.kv = nil
+	}
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupeCacheWindow(t *testing.T) {
+	cache := newDedupeCache(1000, 0, "")
+	now := time.Now()
+
+	require.False(t, cache.contains("one", now))
+	cache.add("one", now)
+	require.True(t, cache.contains("one", now.Add(500*time.Millisecond)))
+	require.False(t, cache.contains("one", now.Add(time.Second)))
+	require.Empty(t, cache.order)
+}
+
+func TestDedupeCacheSize(t *testing.T) {
+	cache := newDedupeCache(60000, 3, "")
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		cache.add(fmt.Sprintf("%d", i), now)
+	}
+
+	require.Len(t, cache.seen, 3)
+	require.False(t, cache.contains("0", now))
+	require.False(t, cache.contains("1", now))
+	require.True(t, cache.contains("4", now))
+}
+
+func TestDedupeCacheRestoresInOrder(t *testing.T) {
+	cache := newDedupeCache(1000, 10, "")
+	now := time.Now()
+
+	cache.add("new", now)
+	cache.restore("old", now.Add(-900*time.Millisecond), now)
+	require.Equal(t, []string{"old", "new"}, cache.order)
+
+	// the restored ID expires on time, even though it was added last
+	require.True(t, cache.contains("old", now.Add(50*time.Millisecond)))
+	require.False(t, cache.contains("old", now.Add(200*time.Millisecond)))
+	require.True(t, cache.contains("new", now.Add(200*time.Millisecond)))
+
+	// putting an ID again moves it to the end
+	cache.add("again", now.Add(300*time.Millisecond))
+	cache.add("new", now.Add(400*time.Millisecond))
+	require.Equal(t, []string{"again", "new"}, cache.order)
+}
+
+func TestWithNATSMsgID(t *testing.T) {
+	require.Nil(t, withNATSMsgID(nil, ""))
+
+	header := withNATSMsgID(nil, "one")
+	require.Equal(t, "one", header.Get(nats.MsgIdHdr))
+
+	header = nats.Header{}
+	header.Set("MQ-Format", "MQSTR")
+	header = withNATSMsgID(header, "two")
+	require.Equal(t, "two", header.Get(nats.MsgIdHdr))
+	require.Equal(t, "MQSTR", header.Get("MQ-Format"))
+}
+
+func TestDedupeConfigIsValidated(t *testing.T) {
+	configs := []conf.ConnectorConfig{
+		{Type: "NATS2Queue", Subject: "test", Queue: "DEV.QUEUE.1", NATSMsgID: true},
+		{Type: "Queue2NATS", Subject: "test", Queue: "DEV.QUEUE.1", NATSMsgIDProperty: "id"},
+		{Type: "Queue2NATS", Subject: "test", Queue: "DEV.QUEUE.1", NATSMsgID: true, Chunking: true},
+		{Type: "Queue2NATS", Subject: "test", Queue: "DEV.QUEUE.1", DedupeWindow: 1000},
+		{Type: "NATS2Queue", Subject: "test", Queue: "DEV.QUEUE.1", DedupeWindow: -1},
+		{Type: "NATS2Queue", Subject: "test", Queue: "DEV.QUEUE.1", DedupeBucket: "ids"},
+		{Type: "NATS2Queue", Subject: "test", Queue: "DEV.QUEUE.1", DedupeWindow: 1000, DedupeBucket: "bad.name"},
+	}
+
+	for _, config := range configs {
+		_, err := CreateConnector(config, &BridgeServer{})
+		require.Error(t, err)
+	}
+}
+
+func TestMsgIDIsPublishedAsNATSMsgID(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:           "Queue2NATS",
+			Subject:        subject,
+			Queue:          queue,
+			ExcludeHeaders: true,
+			NATSMsgID:      true,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	done := make(chan string)
+
+	sub, err := tbs.NC.Subscribe(subject, func(m *nats.Msg) {
+		done <- m.Header.Get(nats.MsgIdHdr)
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	mqmd := ibmmq.NewMQMD()
+	err = tbs.PutMessageOnQueue(queue, mqmd, []byte("hello"))
+	require.NoError(t, err)
+
+	select {
+	case id := <-done:
+		require.Equal(t, hex.EncodeToString(mqmd.MsgId), id)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for the message")
+	}
+}
+
+func TestDuplicatesAreNotPut(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:           "NATS2Queue",
+			Subject:        subject,
+			Queue:          queue,
+			ExcludeHeaders: true,
+			DedupeWindow:   60000,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	for _, body := range []string{"one", "two", "three"} {
+		msg := nats.NewMsg(subject)
+		msg.Data = []byte(body)
+		if body != "three" {
+			msg.Header.Set(nats.MsgIdHdr, "id")
+		}
+		err = tbs.NC.PublishMsg(msg)
+		require.NoError(t, err)
+	}
+
+	_, _, data, err := tbs.GetMessageFromQueue(queue, 5000)
+	require.NoError(t, err)
+	require.Equal(t, "one", string(data))
+
+	_, _, data, err = tbs.GetMessageFromQueue(queue, 5000)
+	require.NoError(t, err)
+	require.Equal(t, "three", string(data))
+
+	stats := tbs.Bridge.SafeStats()
+	require.Equal(t, int64(1), stats.Connections[0].Duplicates)
+}
+
+func TestDedupeSurvivesRestart(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:           "NATS2Queue",
+			Subject:        subject,
+			Queue:          queue,
+			ExcludeHeaders: true,
+			DedupeWindow:   60000,
+			DedupeBucket:   "dedupe",
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	msg := nats.NewMsg(subject)
+	msg.Data = []byte("hello")
+	msg.Header.Set(nats.MsgIdHdr, "id")
+
+	err = tbs.NC.PublishMsg(msg)
+	require.NoError(t, err)
+
+	_, _, data, err := tbs.GetMessageFromQueue(queue, 5000)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+
+	tbs.StopBridge()
+	err = tbs.StartBridge(connect, false)
+	require.NoError(t, err)
+
+	err = tbs.NC.PublishMsg(msg)
+	require.NoError(t, err)
+
+	_, _, _, err = tbs.GetMessageFromQueue(queue, 1000)
+	require.Error(t, err)
+
+	require.Eventually(t, func() bool {
+		return tbs.Bridge.SafeStats().Connections[0].Duplicates == 1
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/message"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+)
+
+// validateExpiry checks the default expiry
+func validateExpiry(config conf.ConnectorConfig) error {
+	if config.Expiry < 0 {
+		return fmt.Errorf("expiry can't be negative")
+	}
+
+	return nil
+}
+
+// applyDefaultExpiry sets the connector's default expiry on messages that don't have one, the
+// config is in milliseconds and the MQMD in tenths of a second, rounded up
+func (mq *BridgeConnector) applyDefaultExpiry(mqmd *ibmmq.MQMD) {
+	if mq.config.Expiry <= 0 || mqmd.Expiry != message.UnlimitedExpiry {
+		return
+	}
+	mqmd.Expiry = int32((mq.config.Expiry + 99) / 100)
+}
+
+// droppedExpired returns true, and updates the stats, if the conversion error is for a message that
+// expired before it could be put to MQ - expects the lock to be held
+func (mq *BridgeConnector) droppedExpired(err error) bool {
+	if !errors.Is(err, ErrMessageExpired) {
+		return false
+	}
+	mq.Logger().Tracef("%s dropped an expired message", mq.String())
+	mq.stats.AddExpired()
+	return true
+}
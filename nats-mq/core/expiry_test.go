@@ -0,0 +1,156 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/message"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultExpiry(t *testing.T) {
+	mq := &BridgeConnector{}
+	mq.init(NewBridgeServer(), conf.ConnectorConfig{
+		Expiry: 1050,
+	}, "test")
+
+	mqmd := ibmmq.NewMQMD()
+	mq.applyDefaultExpiry(mqmd)
+	require.Equal(t, int32(11), mqmd.Expiry)
+
+	// messages with an expiry keep it
+	mqmd = ibmmq.NewMQMD()
+	mqmd.Expiry = 5
+	mq.applyDefaultExpiry(mqmd)
+	require.Equal(t, int32(5), mqmd.Expiry)
+}
+
+func TestExpiredMessagesAreNotConverted(t *testing.T) {
+	bridge := &BridgeServer{}
+
+	msg := message.NewBridgeMessage([]byte("hello"))
+	msg.Header.SetExpiry(1, time.Now().Add(-time.Second))
+	headers, err := msg.EncodeHeaders()
+	require.NoError(t, err)
+
+	_, _, _, err = bridge.NATSHeadersToMQMessage(msg.Body, nats.Header(headers), "", nil, MessageOptions{})
+	require.Equal(t, ErrMessageExpired, err)
+}
+
+func TestExpiryConfigIsValidated(t *testing.T) {
+	config := conf.ConnectorConfig{
+		Type:    "NATS2Queue",
+		Subject: "test",
+		Queue:   "DEV.QUEUE.1",
+		Expiry:  -1,
+	}
+
+	_, err := CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+}
+
+func TestExpiryIsCarriedThroughNATS(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:    "Queue2NATS",
+			Subject: subject,
+			Queue:   queue,
+		},
+		{
+			Type:    "NATS2Queue",
+			Subject: "back",
+			Queue:   "DEV.QUEUE.2",
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	done := make(chan *message.BridgeMessage)
+
+	sub, err := tbs.NC.Subscribe(subject, func(m *nats.Msg) {
+		msg, err := message.DecodeBridgeMessage(m.Data)
+		if err != nil {
+			return
+		}
+		done <- msg
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	mqmd := ibmmq.NewMQMD()
+	mqmd.Expiry = 600
+	err = tbs.PutMessageOnQueue(queue, mqmd, []byte("hello"))
+	require.NoError(t, err)
+
+	var received *message.BridgeMessage
+	select {
+	case received = <-done:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for the message")
+	}
+	require.NotZero(t, received.Header.ExpiresAt)
+
+	encoded, err := received.Encode()
+	require.NoError(t, err)
+	err = tbs.NC.Publish("back", encoded)
+	require.NoError(t, err)
+
+	mqmd, _, _, err = tbs.GetMessageFromQueue("DEV.QUEUE.2", 5000)
+	require.NoError(t, err)
+	require.True(t, mqmd.Expiry > 0 && mqmd.Expiry <= 600)
+}
+
+func TestExpiredMessagesAreDropped(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:    "NATS2Queue",
+			Subject: subject,
+			Queue:   queue,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	msg := message.NewBridgeMessage([]byte("hello"))
+	msg.Header.SetExpiry(10, time.Now().Add(-time.Minute))
+	encoded, err := msg.Encode()
+	require.NoError(t, err)
+
+	err = tbs.NC.Publish(subject, encoded)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return tbs.Bridge.SafeStats().Connections[0].Expired == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	_, _, _, err = tbs.GetMessageFromQueue(queue, 500)
+	require.Error(t, err)
+}
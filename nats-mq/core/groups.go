@@ -0,0 +1,293 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/message"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
+)
+
+// MQ group status values, returned in the MQGMO
+const (
+	mqGroupStatusNotInGroup = ' ' // MQGS_NOT_IN_GROUP
+	mqGroupStatusLastMsg    = 'L' // MQGS_LAST_MSG_IN_GROUP
+)
+
+// messageGroup tracks a group that has been partially read in the current unit of work
+type messageGroup struct {
+	count    int32
+	replyTo  string
+	msgID    string                   // the NATS message ID of the first message
+	messages []*message.BridgeMessage // only used when groups are published as one message
+	size     int                      // the bytes in messages
+	poisoned bool                     // the group is too large and is being moved to the poison queue
+}
+
+// validateMessageGroups checks the group mode and that the connector reads from a queue
+func validateMessageGroups(config conf.ConnectorConfig) error {
+	switch config.MessageGroups {
+	case "":
+	case conf.MessageGroupsMessage, conf.MessageGroupsBatch:
+		if config.Type != conf.Queue2NATS && config.Type != conf.Queue2Stan {
+			return fmt.Errorf("message groups are only supported by queue to NATS and NATS streaming connectors")
+		}
+	default:
+		return fmt.Errorf("unknown message groups mode %q in configuration", config.MessageGroups)
+	}
+
+	if config.MaxGroupSize < 0 {
+		return fmt.Errorf("max group size can't be negative")
+	}
+
+	return nil
+}
+
+// maxGroupSize returns the configured max group size or the default
+func (mq *BridgeConnector) maxGroupSize() int {
+	if mq.config.MaxGroupSize > 0 {
+		return mq.config.MaxGroupSize
+	}
+	return DefaultMaxBufferSize
+}
+
+// requestGroups asks MQ to return complete logical messages, in group order, and only once
+// every message in a group is on the queue
+func (mq *BridgeConnector) requestGroups(mqmd *ibmmq.MQMD, gmo *ibmmq.MQGMO) {
+	if mq.config.MessageGroups == "" {
+		return
+	}
+	gmo.Options |= ibmmq.MQGMO_ALL_MSGS_AVAILABLE
+	gmo.Options |= ibmmq.MQGMO_COMPLETE_MSG
+	gmo.Options |= ibmmq.MQGMO_LOGICAL_ORDER
+	if gmo.Version < ibmmq.MQGMO_VERSION_2 {
+		gmo.Version = ibmmq.MQGMO_VERSION_2
+	}
+	if mqmd.Version < ibmmq.MQMD_VERSION_2 {
+		mqmd.Version = ibmmq.MQMD_VERSION_2
+	}
+}
+
+// isGroupMessage returns true if the connector handles groups and the message is part of one
+func (mq *BridgeConnector) isGroupMessage(gmo *ibmmq.MQGMO) bool {
+	return mq.config.MessageGroups != "" && gmo.GroupStatus != mqGroupStatusNotInGroup && gmo.GroupStatus != 0
+}
+
+// handleGroupMessage publishes or holds a message from a group, the unit of work is only
+// committed after the last message in the group is published - expects the lock to be held
+func (mq *BridgeConnector) handleGroupMessage(cb NATSCallback, conn Connector, md *ibmmq.MQMD, gmo *ibmmq.MQGMO, buffer []byte, start time.Time) {
+	replySubject, replyChannel := mq.bridge.mqReplyTo(md)
+	body := make([]byte, len(buffer))
+	copy(body, buffer)
+
+	var mqMsg *message.BridgeMessage
+	var err error
+
+	if mq.config.ExcludeHeaders {
+		mqMsg = message.NewBridgeMessage(body)
+		mqMsg.Header = mapMQMDToHeader(md)
+	} else {
+		mqMsg, err = mq.bridge.mqToBridgeMessage(md, gmo.MsgHandle, body, replyChannel, mq.messageOptions())
+	}
+
+	if err != nil {
+		mq.Logger().Noticef("message conversion failure %s, %s", mq.String(), err.Error())
+		mq.stats.AddConversionError(err)
+		mq.backoutGroup()
+		return
+	}
+
+	msgID := mq.natsMsgID(md, gmo.MsgHandle)
+
+	if mq.group == nil {
+		mq.group = &messageGroup{
+			replyTo: replySubject,
+			msgID:   msgID,
+		}
+	}
+	mq.group.count++
+	last := gmo.GroupStatus == mqGroupStatusLastMsg
+
+	mq.Logger().Tracef("%s got message %d in group %x", mq.String(), mq.group.count, mqMsg.Header.GroupID)
+
+	if mq.config.MessageGroups == conf.MessageGroupsBatch {
+		err = mq.publishBridgeMessage(cb, mqMsg, replySubject, msgID)
+
+		// without headers the marker would look like an empty message
+		if err == nil && last && !mq.config.ExcludeHeaders {
+			completeID := ""
+			if msgID != "" {
+				completeID = msgID + ".complete"
+			}
+			err = mq.publishBridgeMessage(cb, message.NewGroupCompleteMessage(mqMsg.Header.GroupID, mq.group.count), "", completeID)
+		}
+	} else if mq.group.poisoned || mq.group.size+len(mqMsg.Body) > mq.maxGroupSize() {
+		if err := mq.moveGroupToPoisonQueue(mqMsg); err != nil {
+			mq.Logger().Noticef("poison message failure for %s, %s", mq.String(), err.Error())
+			mq.backoutGroup()
+			go mq.bridge.ConnectorError(conn, err) // run in a go routine so we can finish this method and unlock
+			return
+		}
+	} else {
+		mq.group.messages = append(mq.group.messages, mqMsg)
+		mq.group.size += len(mqMsg.Body)
+
+		if last {
+			err = mq.publishBridgeMessage(cb, mergeGroup(mq.group.messages), mq.group.replyTo, mq.group.msgID)
+		}
+	}
+
+	if err != nil {
+		mq.Logger().Noticef("publish failure for %s, %s", mq.String(), err.Error())
+		mq.stats.AddPublishError(err)
+		mq.backoutGroup()
+		return
+	}
+
+	if !last {
+		return
+	}
+
+	mq.group = nil
+
+	if err := mq.qMgr.Cmit(); err != nil {
+		mq.Logger().Noticef("failed to commit, %s", err.Error())
+		mq.stats.AddCommitError(err)
+		mq.backoutOffloaded()
+		go mq.bridge.ConnectorError(conn, err) // run in a go routine so we can finish this method and unlock
+		return
+	}
+	mq.commitOffloaded()
+
+	mq.stats.AddRequestTime(time.Since(start))
+}
+
+// backoutGroup drops the partial group and backs out the unit of work, so the whole group is read again
+func (mq *BridgeConnector) backoutGroup() {
+	mq.group = nil
+	mq.backoutOffloaded()
+	mq.qMgr.Back()
+	mq.stats.AddBackout()
+}
+
+// moveGroupToPoisonQueue moves a group that is too large to publish as one message to the poison queue, the
+// messages held so far and the rest of the group are put in the group's unit of work - expects the lock to be held
+func (mq *BridgeConnector) moveGroupToPoisonQueue(mqMsg *message.BridgeMessage) error {
+	if mq.config.PoisonQueue == "" {
+		return fmt.Errorf("group %x is larger than the max group size and no poison queue is configured", mqMsg.Header.GroupID)
+	}
+
+	if !mq.group.poisoned {
+		mq.Logger().Noticef("%s moving group %x, larger than %d bytes, to poison queue %s", mq.String(), mqMsg.Header.GroupID,
+			mq.maxGroupSize(), mq.config.PoisonQueue)
+
+		held := mq.group.messages
+		mq.group.poisoned = true
+		mq.group.messages = nil
+		mq.group.size = 0
+
+		for _, msg := range held {
+			if err := mq.putPoisonMessage(msg); err != nil {
+				return err
+			}
+		}
+	}
+
+	return mq.putPoisonMessage(mqMsg)
+}
+
+// putPoisonMessage puts a message that has already been read to the poison queue, in the current
+// unit of work - expects the lock to be held
+func (mq *BridgeConnector) putPoisonMessage(msg *message.BridgeMessage) error {
+	if err := mq.openPoisonQueue(); err != nil {
+		return err
+	}
+
+	mqmd := mapHeaderToMQMD(&msg.Header)
+	mqmd.Version = ibmmq.MQMD_VERSION_2 // for the group fields
+
+	handle, err := mq.bridge.mapPropertiesToHandle(msg, mq.qMgr)
+	if err != nil {
+		return err
+	}
+	defer handle.DltMH(ibmmq.NewMQDMHO()) // ignore the error
+
+	pmo := ibmmq.NewMQPMO()
+	pmo.Options = ibmmq.MQPMO_SYNCPOINT
+	pmo.Options |= ibmmq.MQPMO_FAIL_IF_QUIESCING
+	pmo.Options |= ibmmq.MQPMO_SET_ALL_CONTEXT
+	pmo.OriginalMsgHandle = handle
+
+	return mq.poisonQueue.Put(mqmd, pmo, msg.Body)
+}
+
+// publishBridgeMessage encodes the message the way the connector is configured and passes it to the callback
+// with the NATS message ID, if there is one
+func (mq *BridgeConnector) publishBridgeMessage(cb NATSCallback, mqMsg *message.BridgeMessage, replyTo string, msgID string) error {
+	var natsMsg []byte
+	var header nats.Header
+	var err error
+
+	if mq.config.ExcludeHeaders {
+		natsMsg = mqMsg.Body
+	} else if mq.config.NATSHeaders {
+		var headers map[string][]string
+		headers, err = mqMsg.EncodeHeaders()
+		header = nats.Header(headers)
+		natsMsg = mqMsg.Body
+	} else {
+		natsMsg, err = mqMsg.EncodeWith(mq.config.Encoding)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = mq.publishPayload(cb, natsMsg, withNATSMsgID(header, msgID), replyTo)
+
+	if err != nil {
+		return err
+	}
+
+	mq.stats.AddMessageOut(int64(len(natsMsg)))
+	return nil
+}
+
+// mergeGroup joins the bodies of the messages in a group, in order, the header and properties
+// come from the first message and the message flags are cleared since the result isn't part of a group
+func mergeGroup(messages []*message.BridgeMessage) *message.BridgeMessage {
+	bodies := make([][]byte, 0, len(messages))
+	for _, msg := range messages {
+		bodies = append(bodies, msg.Body)
+	}
+
+	merged := message.NewBridgeMessage(bytes.Join(bodies, nil))
+
+	if len(messages) > 0 {
+		merged.Header = messages[0].Header
+		merged.Properties = messages[0].Properties
+		merged.Header.MsgFlags = ibmmq.MQMF_NONE
+		merged.Header.Offset = 0
+		merged.Header.OriginalLength = int32(len(merged.Body))
+	}
+
+	return merged
+}
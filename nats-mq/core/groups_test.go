@@ -0,0 +1,197 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/message"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeGroup(t *testing.T) {
+	first := message.NewBridgeMessage([]byte("hello "))
+	first.Header.GroupID = []byte("group")
+	first.Header.MsgSeqNumber = 1
+	first.Header.MsgFlags = ibmmq.MQMF_MSG_IN_GROUP
+	first.SetProperty("name", "first")
+
+	last := message.NewBridgeMessage([]byte("world"))
+	last.Header.GroupID = []byte("group")
+	last.Header.MsgSeqNumber = 2
+	last.Header.MsgFlags = ibmmq.MQMF_LAST_MSG_IN_GROUP
+	last.SetProperty("name", "last")
+
+	merged := mergeGroup([]*message.BridgeMessage{first, last})
+	require.Equal(t, "hello world", string(merged.Body))
+	require.Equal(t, []byte("group"), merged.Header.GroupID)
+	require.Equal(t, ibmmq.MQMF_NONE, merged.Header.MsgFlags)
+	require.Equal(t, int32(11), merged.Header.OriginalLength)
+
+	name, ok := merged.GetStringProperty("name")
+	require.True(t, ok)
+	require.Equal(t, "first", name)
+}
+
+func TestMessageGroupsConfigErrors(t *testing.T) {
+	config := conf.ConnectorConfig{
+		Type:          "Queue2NATS",
+		Subject:       "test",
+		Queue:         "DEV.QUEUE.1",
+		MessageGroups: "all",
+	}
+
+	_, err := CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+
+	config.Type = "NATS2Queue"
+	config.MessageGroups = conf.MessageGroupsBatch
+	_, err = CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+
+	config.Type = "Topic2NATS"
+	_, err = CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+
+	config.Type = "Queue2NATS"
+	config.MaxGroupSize = -1
+	_, err = CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+}
+
+func TestLargeGroupNeedsAPoisonQueue(t *testing.T) {
+	bridge := NewBridgeServer()
+	mq := &Queue2NATSConnector{}
+	mq.init(bridge, conf.ConnectorConfig{
+		Type:          "Queue2NATS",
+		MessageGroups: conf.MessageGroupsMessage,
+		MaxGroupSize:  4,
+	}, "Queue:DEV.QUEUE.1 to NATS:test")
+
+	mq.group = &messageGroup{}
+	msg := message.NewBridgeMessage([]byte("hello"))
+	msg.Header.GroupID = []byte("group")
+
+	require.Equal(t, 4, mq.maxGroupSize())
+	require.Error(t, mq.moveGroupToPoisonQueue(msg))
+	require.False(t, mq.group.poisoned)
+}
+
+func TestQueueGroupAsOneNATSMessage(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:          "Queue2NATS",
+			Subject:       subject,
+			Queue:         queue,
+			MessageGroups: conf.MessageGroupsMessage,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	done := make(chan []byte, 10)
+
+	sub, err := tbs.NC.Subscribe(subject, func(msg *nats.Msg) {
+		done <- msg.Data
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	err = tbs.PutGroupOnQueue(queue, [][]byte{[]byte("one "), []byte("two "), []byte("three")})
+	require.NoError(t, err)
+
+	var received []byte
+	select {
+	case received = <-done:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for the group")
+	}
+
+	bridgeMessage, err := message.DecodeBridgeMessage(received)
+	require.NoError(t, err)
+	require.Equal(t, "one two three", string(bridgeMessage.Body))
+
+	select {
+	case <-done:
+		require.FailNow(t, "group was published more than once")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestQueueGroupAsBatch(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:          "Queue2NATS",
+			Subject:       subject,
+			Queue:         queue,
+			MessageGroups: conf.MessageGroupsBatch,
+			UsePolling:    true,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	done := make(chan []byte, 10)
+
+	sub, err := tbs.NC.Subscribe(subject, func(msg *nats.Msg) {
+		done <- msg.Data
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	bodies := []string{"one", "two", "three"}
+	err = tbs.PutGroupOnQueue(queue, [][]byte{[]byte(bodies[0]), []byte(bodies[1]), []byte(bodies[2])})
+	require.NoError(t, err)
+
+	for i := 0; i <= len(bodies); i++ {
+		var received []byte
+		select {
+		case received = <-done:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for the group")
+		}
+
+		bridgeMessage, err := message.DecodeBridgeMessage(received)
+		require.NoError(t, err)
+
+		if i < len(bodies) {
+			require.Equal(t, bodies[i], string(bridgeMessage.Body))
+			require.Equal(t, int32(i+1), bridgeMessage.Header.MsgSeqNumber)
+			require.False(t, bridgeMessage.IsGroupComplete())
+		} else {
+			require.True(t, bridgeMessage.IsGroupComplete())
+			require.Equal(t, int32(len(bodies)), bridgeMessage.Header.MsgSeqNumber)
+		}
+	}
+
+	stats := tbs.Bridge.SafeStats()
+	require.Equal(t, int64(3), stats.Connections[0].MessagesIn)
+	require.Equal(t, int64(4), stats.Connections[0].MessagesOut)
+}
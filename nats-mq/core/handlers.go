@@ -29,6 +29,7 @@ func (bridge *BridgeServer) stanConnectionLost(sc stan.Conn, err error) {
 		return
 	}
 	bridge.logger.Warnf("nats streaming disconnected")
+	bridge.publishEvent(EventStanDisconnected, nil, err)
 
 	bridge.natsLock.Lock()
 	bridge.stan = nil // we lost stan
@@ -42,11 +43,13 @@ func (bridge *BridgeServer) natsDisconnected(nc *nats.Conn) {
 		return
 	}
 	bridge.logger.Warnf("nats disconnected")
+	bridge.publishEvent(EventNATSDisconnected, nil, nc.LastError()) // buffered by the client until it reconnects
 	bridge.checkConnections()
 }
 
 func (bridge *BridgeServer) natsReconnected(nc *nats.Conn) {
 	bridge.logger.Warnf("nats reconnected")
+	bridge.publishEvent(EventNATSReconnected, nil, nil)
 }
 
 func (bridge *BridgeServer) natsClosed(nc *nats.Conn) {
@@ -0,0 +1,138 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// HealthComponent describes a part of the bridge that isn't working
+type HealthComponent struct {
+	Component string `json:"component"` // nats, stan or connector
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Critical  bool   `json:"critical"` // true if the component fails the readiness check
+	Error     string `json:"error"`
+}
+
+// Readiness is returned by the /readyz endpoint
+type Readiness struct {
+	Ready   bool              `json:"ready"`
+	Failing []HealthComponent `json:"failing,omitempty"`
+}
+
+// readiness checks the NATS and streaming connections, the connectors waiting to reconnect and the connectors
+// that are over a backlog warning
+func (bridge *BridgeServer) readiness() Readiness {
+	ready := Readiness{Ready: true}
+
+	fail := func(component HealthComponent) {
+		ready.Failing = append(ready.Failing, component)
+		if component.Critical {
+			ready.Ready = false
+		}
+	}
+
+	if !bridge.CheckNATS() {
+		fail(HealthComponent{Component: "nats", Critical: true, Error: "not connected to NATS"})
+	}
+
+	if bridge.config.STAN.ClusterID != "" && !bridge.CheckStan() {
+		fail(HealthComponent{Component: "stan", Critical: true, Error: "not connected to NATS streaming"})
+	}
+
+	reconnecting := bridge.reconnectingConnectors()
+
+	ids := make([]string, 0, len(reconnecting))
+	for id := range reconnecting {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		fail(HealthComponent{
+			Component: "connector",
+			ID:        id,
+			Name:      reconnecting[id].String(),
+			Critical:  bridge.isCritical(id),
+			Error:     "waiting to reconnect",
+		})
+	}
+
+	for _, connector := range bridge.connectors {
+		if _, ok := reconnecting[connector.ID()]; ok {
+			continue
+		}
+
+		cstats := connector.Stats()
+		if cstats.BacklogWarning == "" {
+			continue
+		}
+
+		fail(HealthComponent{
+			Component: "connector",
+			ID:        cstats.ID,
+			Name:      cstats.Name,
+			Critical:  bridge.isCritical(cstats.ID),
+			Error:     cstats.BacklogWarning,
+		})
+	}
+
+	return ready
+}
+
+// reconnectingConnectors returns a copy of the connectors waiting to reconnect, by ID
+func (bridge *BridgeServer) reconnectingConnectors() map[string]Connector {
+	bridge.reconnectLock.Lock()
+	defer bridge.reconnectLock.Unlock()
+
+	reconnecting := make(map[string]Connector, len(bridge.reconnect))
+	for id, connector := range bridge.reconnect {
+		reconnecting[id] = connector
+	}
+	return reconnecting
+}
+
+// isCritical returns true if the connector fails the readiness check, every connector is critical if none is marked
+func (bridge *BridgeServer) isCritical(id string) bool {
+	return len(bridge.critical) == 0 || bridge.critical[id]
+}
+
+// HandleReadyz returns status 200 if the bridge is ready, or 503 if it isn't, with the failing components
+func (bridge *BridgeServer) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	bridge.statsLock.Lock()
+	bridge.httpReqStats[ReadyzPath]++
+	bridge.statsLock.Unlock()
+
+	ready := bridge.readiness()
+
+	readyzJSON, err := json.Marshal(ready)
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if ready.Ready {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(readyzJSON)
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	"github.com/stretchr/testify/require"
+)
+
+func newReconnectingConnector(bridge *BridgeServer, id string) Connector {
+	mq := &BridgeConnector{}
+	mq.init(bridge, conf.ConnectorConfig{ID: id}, "connector "+id)
+	bridge.reconnect[id] = mq
+	return mq
+}
+
+func TestReadinessWithoutCriticalConnectors(t *testing.T) {
+	bridge := NewBridgeServer()
+	bridge.critical = map[string]bool{}
+	bridge.reconnect = map[string]Connector{}
+
+	newReconnectingConnector(bridge, "alpha")
+
+	ready := bridge.readiness()
+	require.False(t, ready.Ready)
+	require.Len(t, ready.Failing, 2) // nats isn't connected either
+
+	require.Equal(t, "nats", ready.Failing[0].Component)
+	require.Equal(t, "connector", ready.Failing[1].Component)
+	require.Equal(t, "alpha", ready.Failing[1].ID)
+	require.True(t, ready.Failing[1].Critical)
+}
+
+func TestReadinessOnlyFailsForCriticalConnectors(t *testing.T) {
+	bridge := NewBridgeServer()
+	bridge.critical = map[string]bool{"beta": true}
+	bridge.reconnect = map[string]Connector{}
+
+	newReconnectingConnector(bridge, "alpha")
+
+	ready := bridge.readiness()
+	require.Len(t, ready.Failing, 2)
+	require.False(t, ready.Failing[1].Critical)
+
+	newReconnectingConnector(bridge, "beta")
+
+	ready = bridge.readiness()
+	require.Len(t, ready.Failing, 3)
+	require.True(t, ready.Failing[2].Critical)
+}
+
+func TestReadyzPage(t *testing.T) {
+	connect := []conf.ConnectorConfig{
+		{
+			Type:           "NATS2Queue",
+			Subject:        "test",
+			Queue:          "DEV.QUEUE.1",
+			ExcludeHeaders: true,
+			Critical:       true,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	readyz := tbs.Bridge.GetMonitoringRootURL() + "readyz"
+
+	response, err := http.Get(readyz)
+	require.NoError(t, err)
+	response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	err = tbs.StopNATS()
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		response, err := http.Get(readyz)
+		if err != nil {
+			return false
+		}
+		response.Body.Close()
+		return response.StatusCode == http.StatusServiceUnavailable
+	}, 5*time.Second, 50*time.Millisecond)
+
+	response, err = http.Get(readyz)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	contents, err := ioutil.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	ready := Readiness{}
+	err = json.Unmarshal(contents, &ready)
+	require.NoError(t, err)
+	require.False(t, ready.Ready)
+	require.Equal(t, "nats", ready.Failing[0].Component)
+
+	// liveness doesn't depend on the connections
+	response, err = http.Get(tbs.Bridge.GetMonitoringRootURL() + "healthz")
+	require.NoError(t, err)
+	response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+}
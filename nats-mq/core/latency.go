@@ -0,0 +1,125 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	stan "github.com/nats-io/stan.go"
+)
+
+// LatencyBuckets are the upper bounds, in seconds, of the source latency histogram published for Prometheus
+var LatencyBuckets = [...]float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900, 3600}
+
+// validateLatency checks that the latency property can be set on the messages the connector reads
+func validateLatency(config conf.ConnectorConfig) error {
+	if config.LatencyProperty == "" {
+		return nil
+	}
+
+	switch config.Type {
+	case conf.Queue2NATS, conf.Queue2Stan, conf.Topic2NATS, conf.Topic2Stan:
+		if config.ExcludeHeaders {
+			return fmt.Errorf("a latency property can't be used when headers are excluded")
+		}
+	case conf.Stan2Queue, conf.Stan2Topic:
+		if config.RFH2 {
+			return fmt.Errorf("a latency property can't be used with RFH2 headers")
+		}
+	default:
+		return fmt.Errorf("a latency property can only be used by connectors that read from MQ or a streaming channel")
+	}
+
+	return nil
+}
+
+// mqSourceLatency returns the time from the MQ put to the arrival of the message at the bridge,
+// ok is false if the message doesn't have a put date and time
+func mqSourceLatency(md *ibmmq.MQMD, arrival time.Time) (time.Duration, bool) {
+	putTime, err := parsePutTime(md.PutDate, md.PutTime)
+	if err != nil {
+		return 0, false
+	}
+	return clampLatency(arrival.Sub(putTime)), true
+}
+
+// stanSourceLatency returns the time from the publish to the arrival of the message at the bridge
+func stanSourceLatency(msg *stan.Msg, arrival time.Time) (time.Duration, bool) {
+	if msg.Timestamp <= 0 {
+		return 0, false
+	}
+	return clampLatency(arrival.Sub(time.Unix(0, msg.Timestamp))), true
+}
+
+// clampLatency treats latencies below zero, from clocks that don't agree, as zero
+func clampLatency(latency time.Duration) time.Duration {
+	if latency < 0 {
+		return 0
+	}
+	return latency
+}
+
+// recordMQLatency records the source latency of a message from MQ and stamps it on the message handle,
+// so it is copied into the properties of the NATS message - expects the lock to be held
+func (mq *BridgeConnector) recordMQLatency(md *ibmmq.MQMD, gmo *ibmmq.MQGMO, arrival time.Time) {
+	latency, ok := mqSourceLatency(md, arrival)
+	if !ok {
+		return
+	}
+
+	mq.stats.AddSourceLatency(latency)
+
+	if mq.config.LatencyProperty == "" {
+		return
+	}
+
+	if err := mq.stampLatency(&gmo.MsgHandle, latency); err != nil {
+		mq.Logger().Noticef("failed to set the latency property for %s, %s", mq.String(), err.Error())
+	}
+}
+
+// recordStanLatency records the source latency of a message from a channel and stamps it on the handle
+// for the put, a handle is created if there isn't one - expects the lock to be held
+func (mq *BridgeConnector) recordStanLatency(msg *stan.Msg, arrival time.Time, handle ibmmq.MQMessageHandle) (ibmmq.MQMessageHandle, error) {
+	latency, ok := stanSourceLatency(msg, arrival)
+	if !ok {
+		return handle, nil
+	}
+
+	mq.stats.AddSourceLatency(latency)
+
+	if mq.config.LatencyProperty == "" {
+		return handle, nil
+	}
+
+	if handle == EmptyHandle {
+		var err error
+		handle, err = mq.qMgr.CrtMH(ibmmq.NewMQCMHO())
+		if err != nil {
+			return EmptyHandle, err
+		}
+	}
+
+	return handle, mq.stampLatency(&handle, latency)
+}
+
+// stampLatency sets the latency property, in milliseconds, on the handle
+func (mq *BridgeConnector) stampLatency(handle *ibmmq.MQMessageHandle, latency time.Duration) error {
+	return handle.SetMP(ibmmq.NewMQSMPO(), mq.config.LatencyProperty, ibmmq.NewMQPD(), int64(latency/time.Millisecond))
+}
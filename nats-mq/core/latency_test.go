@@ -0,0 +1,125 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
+	stan "github.com/nats-io/stan.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMQSourceLatency(t *testing.T) {
+	arrival := time.Date(2019, 4, 1, 13, 5, 10, 0, time.UTC)
+
+	latency, ok := mqSourceLatency(&ibmmq.MQMD{PutDate: "20190401", PutTime: "13050750"}, arrival)
+	require.True(t, ok)
+	require.Equal(t, 2500*time.Millisecond, latency)
+
+	// the queue manager's clock is ahead of the bridge's
+	latency, ok = mqSourceLatency(&ibmmq.MQMD{PutDate: "20190401", PutTime: "13051100"}, arrival)
+	require.True(t, ok)
+	require.Equal(t, time.Duration(0), latency)
+
+	_, ok = mqSourceLatency(&ibmmq.MQMD{}, arrival)
+	require.False(t, ok)
+}
+
+func TestStanSourceLatency(t *testing.T) {
+	arrival := time.Now()
+
+	msg := &stan.Msg{}
+	_, ok := stanSourceLatency(msg, arrival)
+	require.False(t, ok)
+
+	msg.Timestamp = arrival.Add(-time.Second).UnixNano()
+	latency, ok := stanSourceLatency(msg, arrival)
+	require.True(t, ok)
+	require.Equal(t, time.Second, latency)
+}
+
+func TestSourceLatencyStats(t *testing.T) {
+	stats := NewConnectorStats()
+
+	for i := 1; i <= 100; i++ {
+		stats.AddSourceLatency(time.Duration(i) * time.Millisecond)
+	}
+	stats.UpdateQuintiles()
+
+	require.Equal(t, int64(100), stats.LatencyCount)
+	require.InDelta(t, float64(50*time.Millisecond), stats.LatencyQuintile50, float64(5*time.Millisecond))
+	require.InDelta(t, float64(95*time.Millisecond), stats.LatencyQuintile95, float64(5*time.Millisecond))
+	require.Equal(t, int64(10), stats.latencyBuckets[0]) // up to 10ms
+}
+
+func TestLatencyPropertyConfigErrors(t *testing.T) {
+	configs := []conf.ConnectorConfig{
+		{Type: "Queue2NATS", Subject: "test", Queue: "DEV.QUEUE.1", LatencyProperty: "Latency", ExcludeHeaders: true},
+		{Type: "Stan2Queue", Channel: "test", Queue: "DEV.QUEUE.1", LatencyProperty: "Latency", RFH2: true},
+		{Type: "NATS2Queue", Subject: "test", Queue: "DEV.QUEUE.1", LatencyProperty: "Latency"},
+	}
+
+	for _, config := range configs {
+		_, err := CreateConnector(config, &BridgeServer{})
+		require.Error(t, err)
+	}
+}
+
+func TestLatencyPropertyOnNATSMessage(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:            "Queue2NATS",
+			Subject:         subject,
+			Queue:           queue,
+			NATSHeaders:     true,
+			LatencyProperty: "Latency",
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	done := make(chan *nats.Msg, 1)
+	sub, err := tbs.NC.Subscribe(subject, func(m *nats.Msg) {
+		done <- m
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	err = tbs.PutMessageOnQueue(queue, ibmmq.NewMQMD(), []byte("hello world"))
+	require.NoError(t, err)
+
+	select {
+	case m := <-done:
+		latency, err := strconv.ParseInt(m.Header.Get("MQ-Prop-Latency"), 10, 64)
+		require.NoError(t, err)
+		require.True(t, latency >= 0)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for the message")
+	}
+
+	stats := tbs.Bridge.SafeStats()
+	require.Equal(t, int64(1), stats.Connections[0].LatencyCount)
+}
@@ -0,0 +1,182 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	"github.com/nats-io/nats-mq/nats-mq/logging"
+)
+
+// validateLogLevel checks the connector's log level
+func validateLogLevel(config conf.ConnectorConfig) error {
+	if config.LogLevel == "" {
+		return nil
+	}
+
+	_, err := logging.ParseLevel(config.LogLevel)
+	return err
+}
+
+// initLogger creates the connector's logger, it writes to the bridge's output with the connector's id as a prefix,
+// and the logger with the connector's fields, which shares its level
+func (mq *BridgeConnector) initLogger() {
+	mq.logger = mq.bridge.logger.WithLevel(fmt.Sprintf("[%s] ", mq.ID()), mq.configuredLogLevel())
+	mq.fieldLogger = mq.logger.WithFields(logging.Fields{
+		"connector_id": mq.ID(),
+		"connector":    mq.String(),
+	})
+}
+
+// configuredLogLevel returns the level from the connector's config, or the bridge's level if it doesn't have one
+func (mq *BridgeConnector) configuredLogLevel() logging.Level {
+	if mq.config.LogLevel != "" {
+		level, _ := logging.ParseLevel(mq.config.LogLevel) // checked when the connector is created
+		return level
+	}
+	if mq.bridge.logger == nil {
+		return logging.LevelInfo
+	}
+	return mq.bridge.logger.Level()
+}
+
+// Logger returns the connector's logger with its id and name as fields
+func (mq *BridgeConnector) Logger() logging.Logger {
+	return mq.fieldLogger
+}
+
+// LogLevel returns the connector's current log level
+func (mq *BridgeConnector) LogLevel() logging.Level {
+	return mq.logger.Level()
+}
+
+// SetLogLevel changes the connector's log level while it is running, "" goes back to the configured level
+func (mq *BridgeConnector) SetLogLevel(name string) error {
+	level := mq.configuredLogLevel()
+
+	if name != "" {
+		var err error
+		level, err = logging.ParseLevel(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	mq.logger.SetLevel(level)
+	return nil
+}
+
+// messageLogger returns the connector's logger with the size of the message, and the completion
+// and reason codes if the error is from MQ
+func (mq *BridgeConnector) messageLogger(size int, err error) logging.Logger {
+	fields := logging.Fields{
+		"size": size,
+	}
+
+	if mqret, ok := err.(*ibmmq.MQReturn); ok && mqret != nil {
+		fields["mq_cc"] = mqret.MQCC
+		fields["mq_rc"] = mqret.MQRC
+	}
+
+	return mq.Logger().WithFields(fields)
+}
+
+// LogLevels is the response from the log level endpoint
+type LogLevels struct {
+	Level      string           `json:"level"`
+	Connectors []ConnectorLevel `json:"connectors"`
+}
+
+// ConnectorLevel is the current log level of a connector
+type ConnectorLevel struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Level string `json:"level"`
+}
+
+// logLevels returns the levels of the bridge and its connectors
+func (bridge *BridgeServer) logLevels() LogLevels {
+	levels := LogLevels{
+		Level:      bridge.logger.Level().String(),
+		Connectors: []ConnectorLevel{},
+	}
+
+	for _, connector := range bridge.connectors {
+		levels.Connectors = append(levels.Connectors, ConnectorLevel{
+			ID:    connector.ID(),
+			Name:  connector.String(),
+			Level: connector.LogLevel().String(),
+		})
+	}
+	return levels
+}
+
+// HandleLogLevel returns the log levels, a PUT or POST with id and level query parameters changes the level of
+// a connector until the bridge restarts, an empty level goes back to the configured level
+func (bridge *BridgeServer) HandleLogLevel(w http.ResponseWriter, r *http.Request) {
+	bridge.statsLock.Lock()
+	bridge.httpReqStats[LogLevelPath]++
+	bridge.statsLock.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "the id of a connector is required", http.StatusBadRequest)
+			return
+		}
+
+		var connector Connector
+		for _, c := range bridge.connectors {
+			if c.ID() == id {
+				connector = c
+				break
+			}
+		}
+
+		if connector == nil {
+			http.Error(w, fmt.Sprintf("unknown connector %q", id), http.StatusNotFound)
+			return
+		}
+
+		if err := connector.SetLogLevel(r.URL.Query().Get("level")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		bridge.logger.Noticef("log level for %s set to %s", connector.String(), connector.LogLevel())
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	levelsJSON, err := json.Marshal(bridge.logLevels())
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(levelsJSON)
+}
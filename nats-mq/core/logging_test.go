@@ -0,0 +1,140 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	"github.com/nats-io/nats-mq/nats-mq/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectorLogFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	bridge := &BridgeServer{logger: logging.NewLevelLogger(logging.NewJSONLogger(logging.Config{}, buf), "", logging.LevelInfo)}
+
+	mq := &BridgeConnector{}
+	mq.init(bridge, conf.ConnectorConfig{Type: "Queue2NATS", ID: "abc"}, "Queue2NATS:DEV.QUEUE.1")
+
+	mq.messageLogger(11, &ibmmq.MQReturn{MQCC: ibmmq.MQCC_FAILED, MQRC: ibmmq.MQRC_NO_MSG_AVAILABLE}).Noticef("get failure")
+
+	entry := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, "[abc] get failure", entry["msg"])
+	require.Equal(t, "abc", entry["connector_id"])
+	require.Equal(t, "Queue2NATS:DEV.QUEUE.1", entry["connector"])
+	require.Equal(t, float64(11), entry["size"])
+	require.Equal(t, float64(ibmmq.MQCC_FAILED), entry["mq_cc"])
+	require.Equal(t, float64(ibmmq.MQRC_NO_MSG_AVAILABLE), entry["mq_rc"])
+
+	buf.Reset()
+	mq.messageLogger(5, fmt.Errorf("not from mq")).Noticef("publish failure")
+
+	entry = map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, float64(5), entry["size"])
+	require.NotContains(t, entry, "mq_rc")
+}
+
+func TestConnectorLogLevel(t *testing.T) {
+	buf := &bytes.Buffer{}
+	bridge := &BridgeServer{logger: logging.NewLevelLogger(logging.NewTextLogger(logging.Config{Debug: true, Trace: true}, buf), "", logging.LevelInfo)}
+
+	quiet := &BridgeConnector{}
+	quiet.init(bridge, conf.ConnectorConfig{Type: "Queue2NATS", ID: "quiet"}, "quiet")
+
+	verbose := &BridgeConnector{}
+	verbose.init(bridge, conf.ConnectorConfig{Type: "Queue2NATS", ID: "verbose", LogLevel: "trace"}, "verbose")
+
+	require.Equal(t, logging.LevelInfo, quiet.LogLevel())
+	require.Equal(t, logging.LevelTrace, verbose.LogLevel())
+
+	quiet.Logger().Tracef("quiet trace")
+	quiet.Logger().Noticef("quiet notice")
+	verbose.Logger().Tracef("verbose trace")
+	bridge.Logger().Tracef("bridge trace")
+
+	require.NotContains(t, buf.String(), "quiet trace")
+	require.Contains(t, buf.String(), "[INF] [quiet] quiet notice")
+	require.Contains(t, buf.String(), "[TRC] [verbose] verbose trace")
+	require.NotContains(t, buf.String(), "bridge trace")
+
+	require.NoError(t, quiet.SetLogLevel("debug"))
+	quiet.Logger().Debugf("quiet debug")
+	require.Contains(t, buf.String(), "[DBG] [quiet] quiet debug")
+
+	require.Error(t, quiet.SetLogLevel("loud"))
+	require.Equal(t, logging.LevelDebug, quiet.LogLevel())
+
+	require.NoError(t, quiet.SetLogLevel(""))
+	require.Equal(t, logging.LevelInfo, quiet.LogLevel())
+	require.NoError(t, verbose.SetLogLevel(""))
+	require.Equal(t, logging.LevelTrace, verbose.LogLevel())
+}
+
+func TestLogLevelConfigErrors(t *testing.T) {
+	config := conf.ConnectorConfig{Type: "NATS2Queue", Subject: "test", Queue: "DEV.QUEUE.1", LogLevel: "loud"}
+	_, err := CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+}
+
+func TestLogLevelEndpoint(t *testing.T) {
+	bridge := &BridgeServer{
+		logger:       logging.NewLevelLogger(logging.NewTextLogger(logging.Config{}, &bytes.Buffer{}), "", logging.LevelInfo),
+		httpReqStats: map[string]int64{},
+	}
+
+	mq := &Queue2NATSConnector{}
+	mq.init(bridge, conf.ConnectorConfig{Type: "Queue2NATS", ID: "abc"}, "Queue2NATS:DEV.QUEUE.1")
+	bridge.connectors = []Connector{mq}
+
+	levels := func(method string, target string, status int) LogLevels {
+		w := httptest.NewRecorder()
+		bridge.HandleLogLevel(w, httptest.NewRequest(method, target, nil))
+		require.Equal(t, status, w.Code)
+
+		levels := LogLevels{}
+		if status == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &levels))
+		}
+		return levels
+	}
+
+	current := levels(http.MethodGet, LogLevelPath, http.StatusOK)
+	require.Equal(t, "info", current.Level)
+	require.Equal(t, []ConnectorLevel{{ID: "abc", Name: "Queue2NATS:DEV.QUEUE.1", Level: "info"}}, current.Connectors)
+
+	current = levels(http.MethodPut, LogLevelPath+"?id=abc&level=trace", http.StatusOK)
+	require.Equal(t, "info", current.Level)
+	require.Equal(t, "trace", current.Connectors[0].Level)
+	require.Equal(t, logging.LevelTrace, mq.LogLevel())
+
+	levels(http.MethodPut, LogLevelPath+"?level=trace", http.StatusBadRequest)
+	levels(http.MethodPut, LogLevelPath+"?id=xyz&level=trace", http.StatusNotFound)
+	levels(http.MethodPut, LogLevelPath+"?id=abc&level=loud", http.StatusBadRequest)
+	levels(http.MethodDelete, LogLevelPath, http.StatusMethodNotAllowed)
+
+	current = levels(http.MethodPost, LogLevelPath+"?id=abc", http.StatusOK)
+	require.Equal(t, "info", current.Connectors[0].Level)
+	require.Equal(t, int64(7), bridge.httpReqStats[LogLevelPath])
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// metricsPrefix is added to the name of every metric
+const metricsPrefix = "nats_mq_"
+
+// connectorCounters are the per-connector counters, with the field each one is read from
+var connectorCounters = []struct {
+	name  string
+	help  string
+	value func(stats *ConnectorStats) int64
+}{
+	{"connector_messages_in_total", "Messages received by the connector.", func(s *ConnectorStats) int64 { return s.MessagesIn }},
+	{"connector_messages_out_total", "Messages sent by the connector.", func(s *ConnectorStats) int64 { return s.MessagesOut }},
+	{"connector_bytes_in_total", "Bytes received by the connector.", func(s *ConnectorStats) int64 { return s.BytesIn }},
+	{"connector_bytes_out_total", "Bytes sent by the connector.", func(s *ConnectorStats) int64 { return s.BytesOut }},
+	{"connector_connects_total", "Times the connector has connected.", func(s *ConnectorStats) int64 { return s.Connects }},
+	{"connector_disconnects_total", "Times the connector has disconnected.", func(s *ConnectorStats) int64 { return s.Disconnects }},
+	{"connector_request_timeouts_total", "NATS requests that didn't get an MQ reply in time.", func(s *ConnectorStats) int64 { return s.RequestTimeouts }},
+	{"connector_orphaned_replies_total", "MQ replies that didn't match a pending request.", func(s *ConnectorStats) int64 { return s.OrphanedReplies }},
+	{"connector_expired_total", "Messages dropped because they expired before the put to MQ.", func(s *ConnectorStats) int64 { return s.Expired }},
+	{"connector_duplicates_total", "Messages dropped because they were already put to MQ.", func(s *ConnectorStats) int64 { return s.Duplicates }},
+	{"connector_conversion_errors_total", "Messages that couldn't be converted.", func(s *ConnectorStats) int64 { return s.ConversionErrors }},
+	{"connector_publish_errors_total", "Messages from MQ that couldn't be published.", func(s *ConnectorStats) int64 { return s.PublishErrors }},
+	{"connector_put_errors_total", "Messages that couldn't be put to MQ.", func(s *ConnectorStats) int64 { return s.PutErrors }},
+	{"connector_commit_errors_total", "MQ units of work that couldn't be committed.", func(s *ConnectorStats) int64 { return s.CommitErrors }},
+	{"connector_backouts_total", "MQ units of work that were backed out.", func(s *ConnectorStats) int64 { return s.Backouts }},
+}
+
+// backlogGauges are only written for the connectors that check their backlog
+var backlogGauges = []struct {
+	name  string
+	help  string
+	value func(stats *ConnectorStats) float64
+}{
+	{"connector_queue_depth", "Messages on the queue the connector reads from.", func(s *ConnectorStats) float64 { return float64(s.QueueDepth) }},
+	{"connector_oldest_message_age_seconds", "Age of the first message on the queue the connector reads from.", func(s *ConnectorStats) float64 { return float64(s.OldestMessageAge) / 1000 }},
+	{"connector_channel_lag", "Messages on the channel after the last one the connector acked.", func(s *ConnectorStats) float64 { return float64(s.ChannelLag) }},
+	{"connector_backlog_warning", "1 if the connector is over a backlog warning.", func(s *ConnectorStats) float64 { return boolMetric(s.BacklogWarning != "") }},
+}
+
+// HandleMetrics returns the bridge and connector statistics in the Prometheus text format
+func (bridge *BridgeServer) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	bridge.statsLock.Lock()
+	bridge.httpReqStats[MetricsPath]++
+	bridge.statsLock.Unlock()
+
+	var buf bytes.Buffer
+	bridge.writeMetrics(&buf, bridge.stats())
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// writeMetrics writes the metrics for the bridge and each connector
+func (bridge *BridgeServer) writeMetrics(w io.Writer, stats BridgeStats) {
+	writeMetricHeader(w, "nats_connected", "gauge", "1 if the bridge is connected to NATS.")
+	writeMetric(w, "nats_connected", "", boolMetric(bridge.CheckNATS()))
+
+	writeMetricHeader(w, "stan_connected", "gauge", "1 if the bridge is connected to NATS streaming.")
+	writeMetric(w, "stan_connected", "", boolMetric(bridge.CheckStan()))
+
+	writeMetricHeader(w, "reconnecting_connectors", "gauge", "Connectors waiting to reconnect.")
+	writeMetric(w, "reconnecting_connectors", "", float64(bridge.reconnectCount()))
+
+	writeMetricHeader(w, "connector_connected", "gauge", "1 if the connector is connected.")
+	for i := range stats.Connections {
+		cstats := &stats.Connections[i]
+		writeMetric(w, "connector_connected", connectorLabels(cstats), boolMetric(cstats.Connected))
+	}
+
+	for _, counter := range connectorCounters {
+		writeMetricHeader(w, counter.name, "counter", counter.help)
+		for i := range stats.Connections {
+			cstats := &stats.Connections[i]
+			writeMetric(w, counter.name, connectorLabels(cstats), float64(counter.value(cstats)))
+		}
+	}
+
+	for _, gauge := range backlogGauges {
+		writeMetricHeader(w, gauge.name, "gauge", gauge.help)
+		for i := range stats.Connections {
+			cstats := &stats.Connections[i]
+			if cstats.monitorsBacklog {
+				writeMetric(w, gauge.name, connectorLabels(cstats), gauge.value(cstats))
+			}
+		}
+	}
+
+	writeMetricHeader(w, "connector_request_seconds", "histogram", "Time taken to handle each message.")
+	for i := range stats.Connections {
+		cstats := &stats.Connections[i]
+		writeHistogram(w, "connector_request_seconds", connectorLabels(cstats), RequestTimeBuckets[:], cstats.requestBuckets[:], cstats.requestSeconds, cstats.RequestCount)
+	}
+
+	writeMetricHeader(w, "connector_source_latency_seconds", "histogram", "Time from the MQ put or streaming publish to the arrival at the bridge.")
+	for i := range stats.Connections {
+		cstats := &stats.Connections[i]
+		writeHistogram(w, "connector_source_latency_seconds", connectorLabels(cstats), LatencyBuckets[:], cstats.latencyBuckets[:], cstats.latencySeconds, cstats.LatencyCount)
+	}
+}
+
+// writeHistogram writes the cumulative buckets, sum and count for a histogram, the counts are by bucket
+func writeHistogram(w io.Writer, name string, labels string, bounds []float64, counts []int64, sum float64, count int64) {
+	cumulative := int64(0)
+	for b, bound := range bounds {
+		cumulative += counts[b]
+		le := labels + `,le="` + strconv.FormatFloat(bound, 'g', -1, 64) + `"`
+		writeMetric(w, name+"_bucket", le, float64(cumulative))
+	}
+	writeMetric(w, name+"_bucket", labels+`,le="+Inf"`, float64(count))
+	writeMetric(w, name+"_sum", labels, sum)
+	writeMetric(w, name+"_count", labels, float64(count))
+}
+
+// reconnectCount returns the number of connectors waiting to reconnect
+func (bridge *BridgeServer) reconnectCount() int {
+	bridge.reconnectLock.Lock()
+	defer bridge.reconnectLock.Unlock()
+	return len(bridge.reconnect)
+}
+
+func writeMetricHeader(w io.Writer, name string, kind string, help string) {
+	fmt.Fprintf(w, "# HELP %s%s %s\n", metricsPrefix, name, help)
+	fmt.Fprintf(w, "# TYPE %s%s %s\n", metricsPrefix, name, kind)
+}
+
+func writeMetric(w io.Writer, name string, labels string, value float64) {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s%s%s %s\n", metricsPrefix, name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// connectorLabels returns the id, name and type labels for a connector
+func connectorLabels(stats *ConnectorStats) string {
+	return fmt.Sprintf(`id="%s",name="%s",type="%s"`, escapeLabel(stats.ID), escapeLabel(stats.Name), escapeLabel(stats.Type))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
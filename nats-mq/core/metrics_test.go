@@ -0,0 +1,105 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestTimeBuckets(t *testing.T) {
+	stats := NewConnectorStats()
+	stats.AddRequestTime(200 * time.Microsecond)
+	stats.AddRequestTime(3 * time.Millisecond)
+	stats.AddRequestTime(time.Minute)
+
+	require.Equal(t, int64(1), stats.requestBuckets[0])
+	require.Equal(t, int64(1), stats.requestBuckets[3])
+	require.InDelta(t, 60.0032, stats.requestSeconds, 0.0001)
+
+	total := int64(0)
+	for _, count := range stats.requestBuckets {
+		total += count
+	}
+	require.Equal(t, int64(2), total) // the minute is only in +Inf
+}
+
+func TestWriteMetrics(t *testing.T) {
+	bridge := NewBridgeServer()
+
+	cstats := NewConnectorStats()
+	cstats.Name = `Queue2NATS:"DEV.QUEUE.1"`
+	cstats.ID = "alpha"
+	cstats.Type = "Queue2NATS"
+	cstats.AddConnect()
+	cstats.AddMessageIn(10)
+	cstats.AddMessageOut(12)
+	cstats.AddRequestTime(2 * time.Millisecond)
+
+	var buf bytes.Buffer
+	bridge.writeMetrics(&buf, BridgeStats{Connections: []ConnectorStats{cstats}})
+	metrics := buf.String()
+
+	labels := `id="alpha",name="Queue2NATS:\"DEV.QUEUE.1\"",type="Queue2NATS"`
+
+	require.Contains(t, metrics, "# TYPE nats_mq_connector_messages_in_total counter\n")
+	require.Contains(t, metrics, "nats_mq_connector_messages_in_total{"+labels+"} 1\n")
+	require.Contains(t, metrics, "nats_mq_connector_bytes_out_total{"+labels+"} 12\n")
+	require.Contains(t, metrics, "nats_mq_connector_connected{"+labels+"} 1\n")
+	require.Contains(t, metrics, "# TYPE nats_mq_connector_request_seconds histogram\n")
+	require.Contains(t, metrics, "nats_mq_connector_request_seconds_bucket{"+labels+`,le="0.001"} 0`+"\n")
+	require.Contains(t, metrics, "nats_mq_connector_request_seconds_bucket{"+labels+`,le="0.0025"} 1`+"\n")
+	require.Contains(t, metrics, "nats_mq_connector_request_seconds_bucket{"+labels+`,le="+Inf"} 1`+"\n")
+	require.Contains(t, metrics, "nats_mq_connector_request_seconds_count{"+labels+"} 1\n")
+	require.Contains(t, metrics, "nats_mq_nats_connected 0\n")
+	require.Contains(t, metrics, "nats_mq_reconnecting_connectors 0\n")
+}
+
+func TestMetricsPage(t *testing.T) {
+	connect := []conf.ConnectorConfig{
+		{
+			Type:           "NATS2Queue",
+			Subject:        "test",
+			Queue:          "DEV.QUEUE.1",
+			ExcludeHeaders: true,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	response, err := http.Get(tbs.Bridge.GetMonitoringRootURL() + "metrics")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.True(t, strings.HasPrefix(response.Header.Get("Content-Type"), "text/plain"))
+
+	contents, err := ioutil.ReadAll(response.Body)
+	require.NoError(t, err)
+	metrics := string(contents)
+
+	require.Contains(t, metrics, "nats_mq_nats_connected 1\n")
+	require.Contains(t, metrics, "nats_mq_stan_connected 1\n")
+	require.Contains(t, metrics, `type="NATS2Queue"} 1`)
+}
@@ -28,9 +28,12 @@ import (
 
 // HTTP endpoints
 const (
-	RootPath    = "/"
-	VarzPath    = "/varz"
-	HealthzPath = "/healthz"
+	RootPath     = "/"
+	VarzPath     = "/varz"
+	HealthzPath  = "/healthz"
+	MetricsPath  = "/metrics"
+	ReadyzPath   = "/readyz"
+	LogLevelPath = "/loglevel"
 )
 
 // startMonitoring starts the HTTP or HTTPs server if needed.
@@ -58,9 +61,12 @@ func (bridge *BridgeServer) startMonitoring() error {
 
 	// Used to track HTTP requests
 	bridge.httpReqStats = map[string]int64{
-		RootPath:    0,
-		VarzPath:    0,
-		HealthzPath: 0,
+		RootPath:     0,
+		VarzPath:     0,
+		HealthzPath:  0,
+		MetricsPath:  0,
+		ReadyzPath:   0,
+		LogLevelPath: 0,
 	}
 
 	var (
@@ -116,6 +122,9 @@ func (bridge *BridgeServer) startMonitoring() error {
 	mux.HandleFunc(RootPath, bridge.HandleRoot)
 	mux.HandleFunc(VarzPath, bridge.HandleVarz)
 	mux.HandleFunc(HealthzPath, bridge.HandleHealthz)
+	mux.HandleFunc(MetricsPath, bridge.HandleMetrics)
+	mux.HandleFunc(ReadyzPath, bridge.HandleReadyz)
+	mux.HandleFunc(LogLevelPath, bridge.HandleLogLevel)
 
 	// Do not set a WriteTimeout because it could cause cURL/browser
 	// to return empty response or unable to display page if the
@@ -185,6 +194,9 @@ func (bridge *BridgeServer) HandleRoot(w http.ResponseWriter, r *http.Request) {
     <br/>
 		<a href=/varz>varz</a><br/>
 		<a href=/healthz>healthz</a><br/>
+		<a href=/readyz>readyz</a><br/>
+		<a href=/metrics>metrics</a><br/>
+		<a href=/loglevel>loglevel</a><br/>
     <br/>
   </body>
 </html>`)
@@ -210,7 +222,7 @@ func (bridge *BridgeServer) HandleVarz(w http.ResponseWriter, r *http.Request) {
 	w.Write(varzJSON)
 }
 
-// HandleHealthz returns status 200.
+// HandleHealthz returns status 200, it is a liveness check, use /readyz to check the connections
 func (bridge *BridgeServer) HandleHealthz(w http.ResponseWriter, r *http.Request) {
 	bridge.statsLock.Lock()
 	bridge.httpReqStats[HealthzPath]++
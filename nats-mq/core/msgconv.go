@@ -17,15 +17,22 @@ package core
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/ibm-messaging/mq-golang/ibmmq"
 	"github.com/nats-io/nats-mq/message"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
 )
 
 // EmptyHandle is used when there is no message handle to pass in
 var EmptyHandle ibmmq.MQMessageHandle = ibmmq.MQMessageHandle{}
 
+// ErrMessageExpired is returned when a message from NATS/stan has expired before it could be put to MQ
+var ErrMessageExpired = errors.New("message has expired")
+
 // Copies the array, empty or not
 func copyByteArray(data []byte) []byte {
 	newArray := make([]byte, len(data))
@@ -45,8 +52,9 @@ func copyByteArrayIfNotEmpty(data []byte, def []byte, size int32) []byte {
 }
 
 // mapMQMDToHeader creates a new bridge header from an MQMD, copying all the contents
+// the expiry is also recorded as an expiration time, so the remaining life can be put back to MQ
 func mapMQMDToHeader(mqmd *ibmmq.MQMD) message.BridgeHeader {
-	return message.BridgeHeader{
+	header := message.BridgeHeader{
 		Version:          mqmd.Version,
 		Report:           mqmd.Report,
 		MsgType:          mqmd.MsgType,
@@ -76,21 +84,25 @@ func mapMQMDToHeader(mqmd *ibmmq.MQMD) message.BridgeHeader {
 		MsgFlags:         mqmd.MsgFlags,
 		OriginalLength:   mqmd.OriginalLength,
 	}
+	header.SetExpiry(mqmd.Expiry, time.Now())
+	return header
 }
 
 // mapHeaderToMQMD copies most of the fields, some will be ignored on Put, fields that cannot be set are skiped
+// the expiry is set to the life the message has left, not the original expiry, the context fields are only
+// used if the connector puts with a context and the persistence is reset unless the connector copies it
 func mapHeaderToMQMD(header *message.BridgeHeader) *ibmmq.MQMD {
 	mqmd := ibmmq.NewMQMD()
 
 	/* some fields shouldn't be copied, they aren't user editable
 	mqmd.Version = header.Version
 	mqmd.MsgType = header.MsgType
-	mqmd.Expiry = header.Expiry
 	mqmd.BackoutCount = header.BackoutCount
+	*/
 	mqmd.Persistence = header.Persistence
 	mqmd.PutDate = header.PutDate
 	mqmd.PutTime = header.PutTime
-	*/
+	mqmd.Expiry = header.RemainingExpiry(time.Now())
 	mqmd.Report = header.Report
 	mqmd.Feedback = header.Feedback
 	mqmd.Encoding = header.Encoding
@@ -173,12 +185,8 @@ func (bridge *BridgeServer) mapPropertiesToHandle(msg *message.BridgeMessage, qm
 	return handle, nil
 }
 
-//MQToNATSMessage convert an incoming MQ message to a set of NATS bytes and a reply subject
-// if the qmgr is nil, the return value is just the message body
-// if the qmgr is not nil the message is encoded as a BridgeMessage
-// The data array is always just bytes from MQ, and is not an encoded BridgeMessage
-// Header fields that are byte arrays are trimmed, "\x00" removed, on conversion to BridgeMessage.Header
-func (bridge *BridgeServer) MQToNATSMessage(mqmd *ibmmq.MQMD, handle ibmmq.MQMessageHandle, data []byte, length int, qmgr *ibmmq.MQQueueManager) ([]byte, string, error) {
+// mqReplyTo maps the reply to queue in the MQMD to a subject or channel, using the bridge's connectors
+func (bridge *BridgeServer) mqReplyTo(mqmd *ibmmq.MQMD) (string, string) {
 	replySubject := ""
 	replyChannel := ""
 	replyQ := ""
@@ -201,22 +209,168 @@ func (bridge *BridgeServer) MQToNATSMessage(mqmd *ibmmq.MQMD, handle ibmmq.MQMes
 		}
 	}
 
-	if qmgr == nil {
-		return data[:length], replySubject, nil
+	return replySubject, replyChannel
+}
+
+// natsReplyTo maps a reply to subject or channel to a queue and queue manager, using the bridge's connectors
+func (bridge *BridgeServer) natsReplyTo(replyTo string) (string, string) {
+	replyQ := ""
+	replyQMgr := ""
+
+	if replyTo != "" {
+		connectTo, ok := bridge.replyToInfo["S:"+replyTo]
+
+		if !ok {
+			connectTo, ok = bridge.replyToInfo["C:"+replyTo]
+		}
+
+		if ok && connectTo.Queue != "" {
+			replyQ = connectTo.Queue
+			replyQMgr = connectTo.MQ.QueueManager
+		}
 	}
 
-	mqMsg := message.NewBridgeMessage(data[:length])
+	return replyQ, replyQMgr
+}
+
+// mqToBridgeMessage builds a bridge message from the MQMD, properties and body
+// if the options ask for RFH2 an RFH2 header is removed from the body and its folders are copied to the
+// properties, a header the bridge can't parse is left in the body
+func (bridge *BridgeServer) mqToBridgeMessage(mqmd *ibmmq.MQMD, handle ibmmq.MQMessageHandle, body []byte, replyChannel string, opts MessageOptions) (*message.BridgeMessage, error) {
+	mqMsg := message.NewBridgeMessage(body)
 
 	mqMsg.Header = mapMQMDToHeader(mqmd)
 	mqMsg.Header.ReplyToChannel = replyChannel
 
 	err := bridge.copyMessageProperties(handle, mqMsg)
 
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.RFH2 {
+		return mqMsg, nil
+	}
+
+	err = stripRFH2(mqMsg)
+
+	if err != nil {
+		bridge.Logger().Warnf("leaving the RFH2 header in message %x, %s", mqmd.MsgId, err.Error())
+	}
+
+	return mqMsg, nil
+}
+
+// bridgeMessageToMQ builds the MQMD, properties handle and body for a bridge message
+// if rfh2 is true the properties are written into an RFH2 header in front of the body instead of the handle
+// ErrMessageExpired is returned if the message expired while it was in NATS/stan
+func (bridge *BridgeServer) bridgeMessageToMQ(mqMsg *message.BridgeMessage, replyQ string, replyQMgr string, qmgr *ibmmq.MQQueueManager, rfh2 bool) (*ibmmq.MQMD, ibmmq.MQMessageHandle, []byte, error) {
+	if mqMsg.Header.Expired(time.Now()) {
+		return nil, EmptyHandle, nil, ErrMessageExpired
+	}
+
+	if mqMsg.Header.ReplyToChannel != "" {
+		connectTo, ok := bridge.replyToInfo["C:"+mqMsg.Header.ReplyToChannel]
+		if ok && connectTo.Queue != "" {
+			replyQ = connectTo.Queue
+			replyQMgr = connectTo.MQ.QueueManager
+		}
+	}
+
+	mqmd := mapHeaderToMQMD(&mqMsg.Header)
+
+	if replyQ != "" {
+		mqmd.ReplyToQ = replyQ
+		mqmd.ReplyToQMgr = replyQMgr
+	}
+
+	if rfh2 {
+		body, err := wrapRFH2(mqMsg, mqmd)
+
+		if err != nil {
+			return nil, EmptyHandle, nil, err
+		}
+
+		return mqmd, EmptyHandle, body, nil
+	}
+
+	handle, err := bridge.mapPropertiesToHandle(mqMsg, qmgr)
+
+	if err != nil {
+		return nil, EmptyHandle, nil, err
+	}
+
+	return mqmd, handle, mqMsg.Body, nil
+}
+
+// MessageOptions control how messages are converted between MQ and NATS, the zero value
+// uses msgpack and leaves RFH2 headers alone
+type MessageOptions struct {
+	Encoding string // wire format for encoded BridgeMessages, "msgpack" (the default) or "json"
+	RFH2     bool   // build an RFH2 header from the properties on put, and remove it on get
+}
+
+// validateEncoding checks the wire format for encoded BridgeMessages
+func validateEncoding(config conf.ConnectorConfig) error {
+	switch config.Encoding {
+	case "", message.EncodingMsgpack, message.EncodingJSON:
+		return nil
+	default:
+		return fmt.Errorf("unknown encoding %q in configuration", config.Encoding)
+	}
+}
+
+// validateNATSHeaders checks that NATS headers are only used where a message can carry them
+func validateNATSHeaders(config conf.ConnectorConfig) error {
+	if !config.NATSHeaders {
+		return nil
+	}
+
+	if config.ExcludeHeaders {
+		return fmt.Errorf("can't use NATS headers and exclude headers on the same connector")
+	}
+
+	switch config.Type {
+	case conf.Queue2Stan, conf.Stan2Queue, conf.Topic2Stan, conf.Stan2Topic:
+		return fmt.Errorf("NATS headers are not supported by NATS streaming connectors")
+	}
+
+	return nil
+}
+
+// messageOptions returns the conversion options from the connector's config
+func (mq *BridgeConnector) messageOptions() MessageOptions {
+	return MessageOptions{
+		Encoding: mq.config.Encoding,
+		RFH2:     mq.config.RFH2,
+	}
+}
+
+//MQToNATSMessage convert an incoming MQ message to a set of NATS bytes and a reply subject
+// if the qmgr is nil, the return value is just the message body
+// if the qmgr is not nil the message is encoded as a BridgeMessage
+// The data array is always just bytes from MQ, and is not an encoded BridgeMessage
+// Header fields that are byte arrays are trimmed, "\x00" removed, on conversion to BridgeMessage.Header
+func (bridge *BridgeServer) MQToNATSMessage(mqmd *ibmmq.MQMD, handle ibmmq.MQMessageHandle, data []byte, length int, qmgr *ibmmq.MQQueueManager) ([]byte, string, error) {
+	return bridge.MQToNATSMessageWithOptions(mqmd, handle, data, length, qmgr, MessageOptions{})
+}
+
+// MQToNATSMessageWithOptions is MQToNATSMessage with the encoding, and RFH2 handling, from the options
+// if the options ask for RFH2 an RFH2 header is removed from the body when the message is encoded
+func (bridge *BridgeServer) MQToNATSMessageWithOptions(mqmd *ibmmq.MQMD, handle ibmmq.MQMessageHandle, data []byte, length int, qmgr *ibmmq.MQQueueManager, opts MessageOptions) ([]byte, string, error) {
+	replySubject, replyChannel := bridge.mqReplyTo(mqmd)
+
+	if qmgr == nil {
+		return data[:length], replySubject, nil
+	}
+
+	mqMsg, err := bridge.mqToBridgeMessage(mqmd, handle, data[:length], replyChannel, opts)
+
 	if err != nil {
 		return nil, "", err
 	}
 
-	encoded, err := mqMsg.Encode()
+	encoded, err := mqMsg.EncodeWith(opts.Encoding)
 
 	if err != nil {
 		return nil, "", err
@@ -225,27 +379,42 @@ func (bridge *BridgeServer) MQToNATSMessage(mqmd *ibmmq.MQMD, handle ibmmq.MQMes
 	return encoded, replySubject, nil
 }
 
+// MQToNATSHeaders convert an incoming MQ message to a NATS body, a set of NATS headers and a reply subject
+// The body is the MQ body, the MQMD and properties are mapped to headers using the
+// naming scheme in the message package, for example MQ-MsgId and MQ-Prop-<name>
+// if the options ask for RFH2 an RFH2 header is removed from the body, the folders are copied to properties,
+// otherwise the body is untouched, the encoding in the options isn't used
+func (bridge *BridgeServer) MQToNATSHeaders(mqmd *ibmmq.MQMD, handle ibmmq.MQMessageHandle, data []byte, length int, opts MessageOptions) ([]byte, nats.Header, string, error) {
+	replySubject, replyChannel := bridge.mqReplyTo(mqmd)
+
+	mqMsg, err := bridge.mqToBridgeMessage(mqmd, handle, data[:length], replyChannel, opts)
+
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	headers, err := mqMsg.EncodeHeaders()
+
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	return mqMsg.Body, nats.Header(headers), replySubject, nil
+}
+
 // NATSToMQMessage decode an incoming nats message to an MQ message
 // if the qmgr is nil, data is considered to just be a message body
-// if the qmgr is not nil the message is treated as an encoded BridgeMessage
+// if the qmgr is not nil the message is treated as a BridgeMessage
 // The returned byte array just bytes from MQ, and is not an encoded BridgeMessage
 // Header fields that are byte arrays are padded, "\x00" added, on conversion from BridgeMessage.Header
 func (bridge *BridgeServer) NATSToMQMessage(data []byte, replyTo string, qmgr *ibmmq.MQQueueManager) (*ibmmq.MQMD, ibmmq.MQMessageHandle, []byte, error) {
-	replyQ := ""
-	replyQMgr := ""
-
-	if replyTo != "" {
-		connectTo, ok := bridge.replyToInfo["S:"+replyTo]
-
-		if !ok {
-			connectTo, ok = bridge.replyToInfo["C:"+replyTo]
-		}
+	return bridge.NATSToMQMessageWithOptions(data, replyTo, qmgr, MessageOptions{})
+}
 
-		if ok && connectTo.Queue != "" {
-			replyQ = connectTo.Queue
-			replyQMgr = connectTo.MQ.QueueManager
-		}
-	}
+// NATSToMQMessageWithOptions is NATSToMQMessage with the encoding, and RFH2 handling, from the options
+// if the options ask for RFH2 the body is prefixed with an RFH2 header, built from the properties, for JMS consumers
+func (bridge *BridgeServer) NATSToMQMessageWithOptions(data []byte, replyTo string, qmgr *ibmmq.MQQueueManager, opts MessageOptions) (*ibmmq.MQMD, ibmmq.MQMessageHandle, []byte, error) {
+	replyQ, replyQMgr := bridge.natsReplyTo(replyTo)
 
 	if qmgr == nil {
 		mqmd := ibmmq.NewMQMD()
@@ -255,6 +424,11 @@ func (bridge *BridgeServer) NATSToMQMessage(data []byte, replyTo string, qmgr *i
 			mqmd.ReplyToQMgr = replyQMgr
 		}
 
+		if opts.RFH2 {
+			body, err := wrapRFH2(message.NewBridgeMessage(data), mqmd)
+			return mqmd, EmptyHandle, body, err
+		}
+
 		return mqmd, EmptyHandle, data, nil
 	}
 
@@ -263,32 +437,26 @@ func (bridge *BridgeServer) NATSToMQMessage(data []byte, replyTo string, qmgr *i
 		return nil, EmptyHandle, nil, fmt.Errorf("tried to convert empty message to BridgeMessage")
 	}
 
-	mqMsg, err := message.DecodeBridgeMessage(data)
+	mqMsg, err := message.DecodeBridgeMessageWith(data, opts.Encoding)
 
 	if err != nil {
 		return nil, EmptyHandle, nil, err
 	}
 
-	if mqMsg.Header.ReplyToChannel != "" {
-		connectTo, ok := bridge.replyToInfo["C:"+mqMsg.Header.ReplyToChannel]
-		if ok && connectTo.Queue != "" {
-			replyQ = connectTo.Queue
-			replyQMgr = connectTo.MQ.QueueManager
-		}
-	}
+	return bridge.bridgeMessageToMQ(mqMsg, replyQ, replyQMgr, qmgr, opts.RFH2)
+}
 
-	handle, err := bridge.mapPropertiesToHandle(mqMsg, qmgr)
+// NATSHeadersToMQMessage converts an incoming nats message that carries the MQMD and properties
+// in NATS headers to an MQ message, the data is used as the body without any decoding
+// the encoding in the options isn't used, RFH2 is handled as in NATSToMQMessageWithOptions
+func (bridge *BridgeServer) NATSHeadersToMQMessage(data []byte, header nats.Header, replyTo string, qmgr *ibmmq.MQQueueManager, opts MessageOptions) (*ibmmq.MQMD, ibmmq.MQMessageHandle, []byte, error) {
+	replyQ, replyQMgr := bridge.natsReplyTo(replyTo)
+
+	mqMsg, err := message.DecodeHeaders(data, header)
 
 	if err != nil {
 		return nil, EmptyHandle, nil, err
 	}
 
-	mqmd := mapHeaderToMQMD(&mqMsg.Header)
-
-	if replyQ != "" {
-		mqmd.ReplyToQ = replyQ
-		mqmd.ReplyToQMgr = replyQMgr
-	}
-
-	return mqmd, handle, mqMsg.Body, nil
+	return bridge.bridgeMessageToMQ(mqMsg, replyQ, replyQMgr, qmgr, opts.RFH2)
 }
@@ -173,14 +173,16 @@ func TestMQMDToNATSTranslation(t *testing.T) {
 
 	require.Equal(t, expected.OriginalLength, mqmd.OriginalLength)
 
+	// the expiry is the remaining life, which can't be more than the original
+	require.True(t, mqmd.Expiry > 0 && mqmd.Expiry <= expected.Expiry)
+
 	/* Some fields aren't copied, we will test some of these on 1 way
 	require.Equal(t, expected.Version, mqmd.Version)
 	require.Equal(t, expected.MsgType, mqmd.MsgType)
-	require.Equal(t, expected.Expiry, mqmd.Expiry)
 	require.Equal(t, expected.BackoutCount, mqmd.BackoutCount)
-	require.Equal(t, expected.PutDate, mqmd.PutDate)
-	require.Equal(t, expected.PutTime, mqmd.PutTime)
 	*/
+	require.Equal(t, expected.PutDate, mqmd.PutDate) // only used when putting with all context
+	require.Equal(t, expected.PutTime, mqmd.PutTime)
 	require.Equal(t, expected.Persistence, mqmd.Persistence) // only works with the default
 	require.Equal(t, expected.Report, mqmd.Report)
 	require.Equal(t, expected.Feedback, mqmd.Feedback)
@@ -321,9 +323,9 @@ func TestNATSToMQMDTranslation(t *testing.T) {
 	require.Equal(t, expected.MsgType, mqmd.MsgType)
 	require.Equal(t, expected.Expiry, mqmd.Expiry)
 	require.Equal(t, expected.BackoutCount, mqmd.BackoutCount)
-	require.Equal(t, expected.PutDate, mqmd.PutDate)
-	require.Equal(t, expected.PutTime, mqmd.PutTime)
 	*/
+	require.Equal(t, expected.Header.PutDate, decoded.Header.PutDate) // only used when putting with all context
+	require.Equal(t, expected.Header.PutTime, decoded.Header.PutTime)
 	require.Equal(t, expected.Header.Persistence, decoded.Header.Persistence) // only works with the default
 	require.Equal(t, expected.Header.Report, decoded.Header.Report)
 	require.Equal(t, expected.Header.Feedback, decoded.Header.Feedback)
@@ -47,7 +47,7 @@ func (mq *NATS2QueueConnector) Start() error {
 		return fmt.Errorf("%s connector requires nats to be available", mq.String())
 	}
 
-	mq.bridge.Logger().Tracef("starting connection %s", mq.String())
+	mq.Logger().Tracef("starting connection %s", mq.String())
 
 	err := mq.connectToMQ()
 	if err != nil {
@@ -55,7 +55,7 @@ func (mq *NATS2QueueConnector) Start() error {
 	}
 
 	// Create the Object Descriptor that allows us to give the queue name
-	qObject, err := mq.connectToQueue(mq.config.Queue, ibmmq.MQOO_OUTPUT)
+	qObject, err := mq.connectToQueue(mq.config.Queue, mq.outputOptions())
 
 	if err != nil {
 		return err
@@ -63,15 +63,22 @@ func (mq *NATS2QueueConnector) Start() error {
 
 	mq.queue = qObject
 
+	if mq.config.RequestReply {
+		if err := mq.startReplyListener(mq); err != nil {
+			return err
+		}
+	}
+
 	sub, err := mq.subscribeToNATS(mq.config.Subject, mq.config.NatsQueue, mq.queue)
 	if err != nil {
 		return err
 	}
 	mq.sub = sub
 
+	mq.startChunkExpiry()
 	mq.stats.AddConnect()
-	mq.bridge.Logger().Tracef("opened and reading %s", mq.config.Queue)
-	mq.bridge.Logger().Noticef("started connection %s", mq.String())
+	mq.Logger().Tracef("opened and reading %s", mq.config.Queue)
+	mq.Logger().Noticef("started connection %s", mq.String())
 
 	return nil
 }
@@ -81,14 +88,17 @@ func (mq *NATS2QueueConnector) Shutdown() error {
 	mq.Lock()
 	defer mq.Unlock()
 	mq.stats.AddDisconnect()
+	mq.stopChunkExpiry()
 
-	mq.bridge.Logger().Noticef("shutting down connection %s", mq.String())
+	mq.Logger().Noticef("shutting down connection %s", mq.String())
 
 	if mq.sub != nil {
 		mq.sub.Unsubscribe()
 		mq.sub = nil
 	}
 
+	mq.stopReplyListener()
+
 	var err error
 
 	queue := mq.queue
@@ -101,7 +111,7 @@ func (mq *NATS2QueueConnector) Shutdown() error {
 	if mq.qMgr != nil {
 		_ = mq.qMgr.Disc()
 		mq.qMgr = nil
-		mq.bridge.Logger().Tracef("disconnected from queue manager for %s", mq.String())
+		mq.Logger().Tracef("disconnected from queue manager for %s", mq.String())
 	}
 
 	return err // ignore the disconnect error
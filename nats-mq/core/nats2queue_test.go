@@ -17,12 +17,14 @@ package core
 
 import (
 	"bytes"
+	"encoding/hex"
 	"testing"
 	"time"
 
 	"github.com/ibm-messaging/mq-golang/ibmmq"
 	"github.com/nats-io/nats-mq/message"
 	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/require"
 )
 
@@ -211,3 +213,116 @@ func TestSendOnNatsQueueReceiveOnQueue(t *testing.T) {
 	require.Equal(t, int64(0), connStats.Disconnects)
 	require.True(t, connStats.Connected)
 }
+
+func TestSendOnNATSReceiveOnQueueNATSHeaders(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+	msg := "hello world"
+	id := bytes.Repeat([]byte{1}, int(ibmmq.MQ_MSG_ID_LENGTH))
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:        "NATS2Queue",
+			Subject:     subject,
+			Queue:       queue,
+			NATSHeaders: true,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	natsMsg := nats.NewMsg(subject)
+	natsMsg.Data = []byte(msg)
+	natsMsg.Header.Set("MQ-MsgId", hex.EncodeToString(id))
+	natsMsg.Header.Set("MQ-Prop-count", "11")
+	natsMsg.Header.Set("MQ-PropType-count", "int64")
+
+	err = tbs.NC.PublishMsg(natsMsg)
+	require.NoError(t, err)
+
+	mqmd, gmo, data, err := tbs.GetMessageFromQueue(queue, 5000)
+	require.NoError(t, err)
+	require.Equal(t, msg, string(data))
+	require.ElementsMatch(t, id, mqmd.MsgId)
+
+	impo := ibmmq.NewMQIMPO()
+	pd := ibmmq.NewMQPD()
+	impo.Options = ibmmq.MQIMPO_CONVERT_VALUE
+	_, value, err := gmo.MsgHandle.InqMP(impo, pd, "count")
+	require.NoError(t, err)
+	require.Equal(t, int64(11), value.(int64))
+}
+
+func TestSendOnNATSReceiveOnQueueWithRFH2(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+	msg := "hello world"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:        "NATS2Queue",
+			Subject:     subject,
+			Queue:       queue,
+			NATSHeaders: true,
+			RFH2:        true,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	natsMsg := nats.NewMsg(subject)
+	natsMsg.Data = []byte(msg)
+	natsMsg.Header.Set("MQ-Format", "MQSTR")
+	natsMsg.Header.Set("MQ-Prop-JMSCorrelationID", "abc")
+	natsMsg.Header.Set("MQ-Prop-count", "11")
+	natsMsg.Header.Set("MQ-PropType-count", "int32")
+
+	err = tbs.NC.PublishMsg(natsMsg)
+	require.NoError(t, err)
+
+	// the queue manager moves the RFH2 folders into properties when the message is read with a handle
+	_, gmo, data, err := tbs.GetMessageFromQueue(queue, 5000)
+	require.NoError(t, err)
+	require.Equal(t, msg, string(data))
+
+	impo := ibmmq.NewMQIMPO()
+	pd := ibmmq.NewMQPD()
+	impo.Options = ibmmq.MQIMPO_CONVERT_VALUE
+	_, value, err := gmo.MsgHandle.InqMP(impo, pd, "count")
+	require.NoError(t, err)
+	require.Equal(t, int32(11), value.(int32))
+}
+
+func TestConversionFailuresAreCounted(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:    "NATS2Queue",
+			Subject: subject,
+			Queue:   queue,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	// not an encoded bridge message
+	err = tbs.NC.Publish(subject, []byte("hello world"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return tbs.Bridge.SafeStats().Connections[0].ConversionErrors == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	stats := tbs.Bridge.SafeStats().Connections[0]
+	require.NotEmpty(t, stats.LastError)
+	require.NotZero(t, stats.LastErrorTime)
+	require.Equal(t, int64(0), stats.MessagesOut)
+}
@@ -0,0 +1,217 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
+)
+
+// defaultStatsInterval is the time between stats, in ms, if the config doesn't set one
+const defaultStatsInterval = 10000
+
+// Event types published to the events subject
+const (
+	EventConnectorStarted      = "connector_started"
+	EventConnectorStopped      = "connector_stopped"
+	EventConnectorError        = "connector_error"
+	EventConnectorReconnecting = "connector_reconnecting"
+	EventNATSDisconnected      = "nats_disconnected"
+	EventNATSReconnected       = "nats_reconnected"
+	EventStanDisconnected      = "stan_disconnected"
+)
+
+// BridgeEvent is published to the events subject when a connector or connection changes state
+type BridgeEvent struct {
+	Type  string    `json:"type"`
+	Time  time.Time `json:"time"`
+	ID    string    `json:"id,omitempty"`   // the connector's id, for connector events
+	Name  string    `json:"name,omitempty"` // the connector's name, for connector events
+	Error string    `json:"error,omitempty"`
+}
+
+// HealthStatus is the reply to a request on the healthz subject
+type HealthStatus struct {
+	Status string `json:"status"`
+}
+
+// validateNATSMonitoring checks that each kind of monitoring request has its own subject, it is called
+// before the bridge connects so that a bad config doesn't leave connectors running
+func validateNATSMonitoring(config conf.MonitoringConfig) error {
+	subjects := map[string]bool{}
+
+	for _, subject := range []string{config.VarzSubject, config.HealthzSubject, config.ReadyzSubject} {
+		if subject == "" {
+			continue
+		}
+
+		if subjects[subject] {
+			return fmt.Errorf("monitoring subject %q is used for more than one kind of request", subject)
+		}
+		subjects[subject] = true
+	}
+
+	return nil
+}
+
+// startNATSMonitoring subscribes to the request subjects and starts publishing the stats, if they are configured
+// expects the lock to be held
+func (bridge *BridgeServer) startNATSMonitoring() error {
+	config := bridge.config.Monitoring
+	nc := bridge.NATS()
+
+	requests := []struct {
+		subject string
+		handler nats.MsgHandler
+	}{
+		{config.VarzSubject, bridge.handleVarzRequest},
+		{config.HealthzSubject, bridge.handleHealthzRequest},
+		{config.ReadyzSubject, bridge.handleReadyzRequest},
+	}
+
+	bridge.natsMonitorSubs = nil
+
+	for _, request := range requests {
+		subject := request.subject
+		if subject == "" {
+			continue
+		}
+
+		sub, err := nc.Subscribe(subject, request.handler)
+		if err != nil {
+			return err
+		}
+		bridge.natsMonitorSubs = append(bridge.natsMonitorSubs, sub)
+		bridge.logger.Noticef("answering monitoring requests on %s", subject)
+	}
+
+	if config.StatsSubject == "" {
+		return nil
+	}
+
+	interval := config.StatsInterval
+	if interval <= 0 {
+		interval = defaultStatsInterval
+	}
+
+	bridge.natsMonitorDone = make(chan bool)
+	bridge.natsMonitorStopped.Add(1)
+	go bridge.publishStatsEvery(time.Duration(interval)*time.Millisecond, bridge.natsMonitorDone)
+
+	bridge.logger.Noticef("publishing stats to %s every %d milliseconds", config.StatsSubject, interval)
+	return nil
+}
+
+// stopNATSMonitoring unsubscribes from the request subjects and stops the stats - expects the lock to be held
+func (bridge *BridgeServer) stopNATSMonitoring() {
+	for _, sub := range bridge.natsMonitorSubs {
+		if err := sub.Unsubscribe(); err != nil {
+			bridge.logger.Noticef("error unsubscribing from %s, %s", sub.Subject, err.Error())
+		}
+	}
+	bridge.natsMonitorSubs = nil
+
+	if bridge.natsMonitorDone != nil {
+		close(bridge.natsMonitorDone)
+		bridge.natsMonitorStopped.Wait()
+		bridge.natsMonitorDone = nil
+	}
+}
+
+func (bridge *BridgeServer) publishStatsEvery(interval time.Duration, done chan bool) {
+	defer bridge.natsMonitorStopped.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			bridge.publishJSON(bridge.config.Monitoring.StatsSubject, bridge.stats())
+		}
+	}
+}
+
+func (bridge *BridgeServer) handleVarzRequest(m *nats.Msg) {
+	bridge.respondJSON(m, bridge.stats())
+}
+
+func (bridge *BridgeServer) handleHealthzRequest(m *nats.Msg) {
+	bridge.respondJSON(m, HealthStatus{Status: "ok"})
+}
+
+func (bridge *BridgeServer) handleReadyzRequest(m *nats.Msg) {
+	bridge.respondJSON(m, bridge.readiness())
+}
+
+// publishEvent publishes an event for the connector, or for the bridge if the connector is nil, if there is
+// an events subject, the error is optional
+func (bridge *BridgeServer) publishEvent(eventType string, connector Connector, err error) {
+	if bridge.config.Monitoring.EventsSubject == "" {
+		return
+	}
+
+	event := BridgeEvent{
+		Type: eventType,
+		Time: time.Now(),
+	}
+
+	if connector != nil {
+		event.ID = connector.ID()
+		event.Name = connector.String()
+	}
+
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	bridge.publishJSON(bridge.config.Monitoring.EventsSubject, event)
+}
+
+func (bridge *BridgeServer) publishJSON(subject string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		bridge.logger.Noticef("error encoding the message for %s, %s", subject, err.Error())
+		return
+	}
+
+	nc := bridge.NATS()
+	if nc == nil {
+		return
+	}
+
+	if err := nc.Publish(subject, data); err != nil {
+		bridge.logger.Debugf("error publishing to %s, %s", subject, err.Error())
+	}
+}
+
+func (bridge *BridgeServer) respondJSON(m *nats.Msg, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		bridge.logger.Noticef("error encoding the reply for %s, %s", m.Subject, err.Error())
+		return
+	}
+
+	if err := m.Respond(data); err != nil {
+		bridge.logger.Debugf("error replying to a request on %s, %s", m.Subject, err.Error())
+	}
+}
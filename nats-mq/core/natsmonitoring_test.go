@@ -0,0 +1,159 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nst "github.com/nats-io/nats-server/v2/test"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func startNATSMonitoringBridge(t *testing.T, monitoring conf.MonitoringConfig) (*BridgeServer, *nats.Conn, func()) {
+	opts := nst.DefaultTestOptions
+	opts.Port = -1
+	server := nst.RunServer(&opts)
+
+	nc, err := nats.Connect(server.ClientURL())
+	require.NoError(t, err)
+
+	bridge := NewBridgeServer()
+	bridge.nats = nc
+	bridge.config.Monitoring = monitoring
+	bridge.startTime = time.Now()
+
+	mq := &Queue2NATSConnector{}
+	mq.init(bridge, conf.ConnectorConfig{Type: "Queue2NATS", ID: "abc"}, "Queue:DEV.QUEUE.1 to NATS:test")
+	bridge.connectors = []Connector{mq}
+
+	client, err := nats.Connect(server.ClientURL())
+	require.NoError(t, err)
+
+	return bridge, client, func() {
+		bridge.stopNATSMonitoring()
+		client.Close()
+		nc.Close()
+		server.Shutdown()
+	}
+}
+
+func TestMonitoringRequestsOverNATS(t *testing.T) {
+	bridge, client, stop := startNATSMonitoringBridge(t, conf.MonitoringConfig{
+		VarzSubject:    "bridge.varz",
+		HealthzSubject: "bridge.healthz",
+		ReadyzSubject:  "bridge.readyz",
+	})
+	defer stop()
+
+	require.NoError(t, bridge.startNATSMonitoring())
+	require.Len(t, bridge.natsMonitorSubs, 3)
+
+	reply, err := client.Request("bridge.varz", nil, 5*time.Second)
+	require.NoError(t, err)
+	stats := BridgeStats{}
+	require.NoError(t, json.Unmarshal(reply.Data, &stats))
+	require.Len(t, stats.Connections, 1)
+	require.Equal(t, "abc", stats.Connections[0].ID)
+
+	reply, err = client.Request("bridge.healthz", nil, 5*time.Second)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"status":"ok"}`, string(reply.Data))
+
+	reply, err = client.Request("bridge.readyz", nil, 5*time.Second)
+	require.NoError(t, err)
+	ready := Readiness{}
+	require.NoError(t, json.Unmarshal(reply.Data, &ready))
+	require.True(t, ready.Ready)
+
+	bridge.stopNATSMonitoring()
+	require.Empty(t, bridge.natsMonitorSubs)
+	_, err = client.Request("bridge.varz", nil, 250*time.Millisecond)
+	require.Error(t, err)
+}
+
+func TestStatsAndEventsOverNATS(t *testing.T) {
+	bridge, client, stop := startNATSMonitoringBridge(t, conf.MonitoringConfig{
+		StatsSubject:  "bridge.stats",
+		StatsInterval: 50,
+		EventsSubject: "bridge.events",
+	})
+	defer stop()
+
+	statsSub, err := client.SubscribeSync("bridge.stats")
+	require.NoError(t, err)
+	eventsSub, err := client.SubscribeSync("bridge.events")
+	require.NoError(t, err)
+	require.NoError(t, client.Flush())
+
+	require.NoError(t, bridge.startNATSMonitoring())
+
+	msg, err := statsSub.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+	stats := BridgeStats{}
+	require.NoError(t, json.Unmarshal(msg.Data, &stats))
+	require.Equal(t, "abc", stats.Connections[0].ID)
+
+	bridge.publishEvent(EventConnectorError, bridge.connectors[0], fmt.Errorf("queue manager went away"))
+	bridge.publishEvent(EventNATSReconnected, nil, nil)
+
+	msg, err = eventsSub.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+	event := BridgeEvent{}
+	require.NoError(t, json.Unmarshal(msg.Data, &event))
+	require.Equal(t, EventConnectorError, event.Type)
+	require.Equal(t, "abc", event.ID)
+	require.Equal(t, "Queue:DEV.QUEUE.1 to NATS:test", event.Name)
+	require.Equal(t, "queue manager went away", event.Error)
+	require.False(t, event.Time.IsZero())
+
+	msg, err = eventsSub.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+	event = BridgeEvent{}
+	require.NoError(t, json.Unmarshal(msg.Data, &event))
+	require.Equal(t, EventNATSReconnected, event.Type)
+	require.Empty(t, event.ID)
+
+	// stats stop with the monitoring
+	bridge.stopNATSMonitoring()
+	for {
+		if _, err := statsSub.NextMsg(200 * time.Millisecond); err != nil {
+			break
+		}
+	}
+}
+
+func TestNATSMonitoringSubjectsMustBeDifferent(t *testing.T) {
+	monitoring := conf.MonitoringConfig{
+		VarzSubject:    "bridge.monitor",
+		HealthzSubject: "bridge.monitor",
+	}
+	require.Error(t, validateNATSMonitoring(monitoring))
+
+	// the bridge fails before it connects or starts any connectors
+	bridge := NewBridgeServer()
+	bridge.config.Monitoring = monitoring
+	require.Error(t, bridge.Start())
+	require.False(t, bridge.running)
+	require.Empty(t, bridge.connectors)
+
+	monitoring.HealthzSubject = "bridge.health"
+	require.NoError(t, validateNATSMonitoring(monitoring))
+}
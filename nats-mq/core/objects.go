@@ -0,0 +1,212 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/nats-io/nats-mq/message"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+)
+
+const (
+	// DefaultObjectStoreBucket is used when a connector offloads bodies without naming a bucket
+	DefaultObjectStoreBucket = "nats-mq"
+
+	// DefaultObjectStoreThreshold is the payload size, in bytes, above which bodies are offloaded
+	DefaultObjectStoreThreshold = 1024 * 1024
+
+	// DefaultObjectStoreTTL is the time, in ms, objects are kept in a bucket created by the bridge
+	DefaultObjectStoreTTL = 24 * 60 * 60 * 1000
+)
+
+var validBucketName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// validateObjectStore checks the object store limits and bucket name
+func validateObjectStore(config conf.ConnectorConfig) error {
+	if config.ObjectStoreThreshold < 0 || config.ObjectStoreTTL < 0 {
+		return fmt.Errorf("object store threshold and TTL can't be negative")
+	}
+
+	if config.ObjectStoreBucket != "" && !validBucketName.MatchString(config.ObjectStoreBucket) {
+		return fmt.Errorf("invalid object store bucket name %q", config.ObjectStoreBucket)
+	}
+
+	return nil
+}
+
+// objectStoreBucket returns the configured bucket or the default
+func (mq *BridgeConnector) objectStoreBucket() string {
+	if mq.config.ObjectStoreBucket != "" {
+		return mq.config.ObjectStoreBucket
+	}
+	return DefaultObjectStoreBucket
+}
+
+// objectStore returns the store for a bucket, creating the bucket with the connector's
+// retention if create is true and it doesn't exist - expects the lock to be held
+func (mq *BridgeConnector) objectStore(bucket string, create bool) (nats.ObjectStore, error) {
+	if store, ok := mq.objectStores[bucket]; ok {
+		return store, nil
+	}
+
+	js, err := mq.bridge.NATS().JetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := js.ObjectStore(bucket)
+
+	if errors.Is(err, nats.ErrStreamNotFound) && create {
+		ttl := mq.config.ObjectStoreTTL
+		if ttl == 0 {
+			ttl = DefaultObjectStoreTTL
+		}
+
+		mq.Logger().Noticef("creating object store bucket %s for %s", bucket, mq.String())
+		store, err = js.CreateObjectStore(&nats.ObjectStoreConfig{
+			Bucket: bucket,
+			TTL:    time.Duration(ttl) * time.Millisecond,
+		})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if mq.objectStores == nil {
+		mq.objectStores = map[string]nats.ObjectStore{}
+	}
+	mq.objectStores[bucket] = store
+	return store, nil
+}
+
+// offloadPayload stores payloads above the threshold in the object store and returns an
+// encoded reference in their place, smaller payloads are returned as is. Stored objects are
+// deleted if the unit of work they belong to is backed out - expects the lock to be held
+func (mq *BridgeConnector) offloadPayload(natsMsg []byte) ([]byte, error) {
+	threshold := mq.config.ObjectStoreThreshold
+	if threshold == 0 {
+		threshold = DefaultObjectStoreThreshold
+	}
+
+	if !mq.config.ObjectStore || len(natsMsg) <= threshold {
+		return natsMsg, nil
+	}
+
+	bucket := mq.objectStoreBucket()
+	store, err := mq.objectStore(bucket, true)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := store.PutBytes(nuid.Next(), natsMsg)
+	if err != nil {
+		delete(mq.objectStores, bucket)
+		return nil, err
+	}
+
+	mq.Logger().Tracef("%s stored payload of %d bytes as %s in %s", mq.String(), len(natsMsg), info.Name, bucket)
+
+	ref := &message.ObjectReference{
+		Bucket: bucket,
+		Name:   info.Name,
+		Size:   info.Size,
+		Digest: info.Digest,
+	}
+	mq.offloaded = append(mq.offloaded, ref)
+	return ref.Encode()
+}
+
+// commitOffloaded keeps the objects stored in the unit of work that was committed - expects the lock to be held
+func (mq *BridgeConnector) commitOffloaded() {
+	mq.offloaded = nil
+}
+
+// backoutOffloaded deletes the objects stored in a unit of work that was, or will be, backed out, the
+// messages are read and stored again - expects the lock to be held
+func (mq *BridgeConnector) backoutOffloaded() {
+	for _, ref := range mq.offloaded {
+		mq.deleteObject(ref)
+	}
+	mq.offloaded = nil
+}
+
+// deleteObject removes a stored payload, failures are logged since the bucket's TTL is the fallback
+func (mq *BridgeConnector) deleteObject(ref *message.ObjectReference) {
+	store, err := mq.objectStore(ref.Bucket, false)
+	if err == nil {
+		err = store.Delete(ref.Name)
+	}
+
+	if err != nil {
+		mq.Logger().Noticef("failed to delete object %s from %s for %s, %s", ref.Name, ref.Bucket, mq.String(), err.Error())
+		return
+	}
+
+	mq.Logger().Tracef("%s deleted object %s from %s", mq.String(), ref.Name, ref.Bucket)
+}
+
+// consumeReference deletes the object a reference points to, once the message that carried it
+// has been put to MQ or dropped as expired, other data is ignored - expects the lock to be held
+func (mq *BridgeConnector) consumeReference(data []byte) {
+	if !mq.config.ObjectStore || !message.IsObjectReference(data) {
+		return
+	}
+
+	ref, err := message.DecodeObjectReference(data)
+	if err != nil || ref.Bucket != mq.objectStoreBucket() {
+		return
+	}
+
+	mq.deleteObject(ref)
+}
+
+// resolvePayload replaces an object reference with the stored payload, other data is returned as is
+// only references to the connector's bucket are resolved
+func (mq *BridgeConnector) resolvePayload(data []byte) ([]byte, error) {
+	if !mq.config.ObjectStore || !message.IsObjectReference(data) {
+		return data, nil
+	}
+
+	ref, err := message.DecodeObjectReference(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if ref.Bucket != mq.objectStoreBucket() {
+		return nil, fmt.Errorf("object reference to bucket %s, expected %s", ref.Bucket, mq.objectStoreBucket())
+	}
+
+	store, err := mq.objectStore(ref.Bucket, false)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := ref.Get(store)
+	if err != nil {
+		delete(mq.objectStores, ref.Bucket)
+		return nil, err
+	}
+
+	mq.Logger().Tracef("%s resolved %s in %s to a payload of %d bytes", mq.String(), ref.Name, ref.Bucket, len(payload))
+	return payload, nil
+}
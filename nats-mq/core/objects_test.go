@@ -0,0 +1,228 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/message"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nst "github.com/nats-io/nats-server/v2/test"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffloadAndResolvePayload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "core-js")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	opts := nst.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = dir
+	server := nst.RunServer(&opts)
+	defer server.Shutdown()
+
+	nc, err := nats.Connect(server.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+
+	bridge := NewBridgeServer()
+	bridge.nats = nc
+
+	mq := &BridgeConnector{}
+	mq.init(bridge, conf.ConnectorConfig{
+		ObjectStore:          true,
+		ObjectStoreThreshold: 100,
+		ObjectStoreBucket:    "offload",
+		ObjectStoreTTL:       60000,
+	}, "test")
+
+	small, err := mq.offloadPayload([]byte("hello world"))
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(small))
+
+	payload := bytes.Repeat([]byte("0123456789"), 1000)
+	ref, err := mq.offloadPayload(payload)
+	require.NoError(t, err)
+	require.True(t, message.IsObjectReference(ref))
+	require.True(t, len(ref) < 200)
+
+	js, err := nc.JetStream()
+	require.NoError(t, err)
+	status, err := js.ObjectStore("offload")
+	require.NoError(t, err)
+	s, err := status.Status()
+	require.NoError(t, err)
+	require.Equal(t, 60*time.Second, s.TTL())
+
+	resolved, err := mq.resolvePayload(ref)
+	require.NoError(t, err)
+	require.Equal(t, payload, resolved)
+
+	// the message package helper resolves the same reference
+	resolved, err = message.ResolveObjectReference(js, ref)
+	require.NoError(t, err)
+	require.Equal(t, payload, resolved)
+
+	// connectors without the object store leave references alone
+	other := &BridgeConnector{}
+	other.init(bridge, conf.ConnectorConfig{}, "other")
+	resolved, err = other.resolvePayload(ref)
+	require.NoError(t, err)
+	require.Equal(t, ref, resolved)
+
+	// references to other buckets aren't resolved
+	other.init(bridge, conf.ConnectorConfig{ObjectStore: true, ObjectStoreThreshold: 100}, "other")
+	_, err = other.resolvePayload(ref)
+	require.Error(t, err)
+
+	// buckets are created with a default TTL
+	_, err = other.offloadPayload(payload)
+	require.NoError(t, err)
+	status, err = js.ObjectStore(DefaultObjectStoreBucket)
+	require.NoError(t, err)
+	s, err = status.Status()
+	require.NoError(t, err)
+	require.Equal(t, 24*time.Hour, s.TTL())
+
+	// the object is deleted once the reference is consumed
+	mq.commitOffloaded()
+	mq.consumeReference(ref)
+	_, err = mq.resolvePayload(ref)
+	require.Error(t, err)
+
+	// and when the unit of work is backed out
+	ref, err = mq.offloadPayload(payload)
+	require.NoError(t, err)
+	mq.backoutOffloaded()
+	_, err = mq.resolvePayload(ref)
+	require.Error(t, err)
+	require.Empty(t, mq.offloaded)
+}
+
+func TestObjectStoreConfigErrors(t *testing.T) {
+	config := conf.ConnectorConfig{
+		Type:              "Queue2NATS",
+		Subject:           "test",
+		Queue:             "DEV.QUEUE.1",
+		ObjectStore:       true,
+		ObjectStoreBucket: "bad.name",
+	}
+
+	_, err := CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+
+	config.ObjectStoreBucket = ""
+	config.ObjectStoreThreshold = -1
+	_, err = CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+}
+
+func TestSendOnQueueReceiveReferenceOnNats(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+	msg := bytes.Repeat([]byte("0123456789"), 300)
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:                 "Queue2NATS",
+			Subject:              subject,
+			Queue:                queue,
+			ExcludeHeaders:       true,
+			ObjectStore:          true,
+			ObjectStoreThreshold: 1024,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	done := make(chan []byte)
+
+	sub, err := tbs.NC.Subscribe(subject, func(m *nats.Msg) {
+		done <- m.Data
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	err = tbs.PutMessageOnQueue(queue, ibmmq.NewMQMD(), msg)
+	require.NoError(t, err)
+
+	var received []byte
+	select {
+	case received = <-done:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timed out waiting for the reference")
+	}
+
+	require.True(t, message.IsObjectReference(received))
+
+	js, err := tbs.NC.JetStream()
+	require.NoError(t, err)
+	resolved, err := message.ResolveObjectReference(js, received)
+	require.NoError(t, err)
+	require.Equal(t, msg, resolved)
+}
+
+func TestSendReferenceOnNATSReceiveOnQueue(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+	msg := bytes.Repeat([]byte("0123456789"), 300)
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:           "NATS2Queue",
+			Subject:        subject,
+			Queue:          queue,
+			ExcludeHeaders: true,
+			ObjectStore:    true,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	js, err := tbs.NC.JetStream()
+	require.NoError(t, err)
+	store, err := js.CreateObjectStore(&nats.ObjectStoreConfig{Bucket: DefaultObjectStoreBucket})
+	require.NoError(t, err)
+	info, err := store.PutBytes("payload", msg)
+	require.NoError(t, err)
+
+	ref := message.ObjectReference{
+		Bucket: DefaultObjectStoreBucket,
+		Name:   info.Name,
+		Size:   info.Size,
+	}
+	encoded, err := ref.Encode()
+	require.NoError(t, err)
+
+	err = tbs.NC.Publish(subject, encoded)
+	require.NoError(t, err)
+
+	_, _, data, err := tbs.GetMessageFromQueue(queue, 5000)
+	require.NoError(t, err)
+	require.Equal(t, msg, data)
+}
@@ -46,7 +46,7 @@ func (mq *Queue2NATSConnector) Start() error {
 		return fmt.Errorf("%s connector requires nats to be available", mq.String())
 	}
 
-	mq.bridge.Logger().Tracef("starting connection %s", mq.String())
+	mq.Logger().Tracef("starting connection %s", mq.String())
 
 	err := mq.connectToMQ()
 	if err != nil {
@@ -61,15 +61,23 @@ func (mq *Queue2NATSConnector) Start() error {
 
 	mq.queue = qObject
 
-	cb, err := mq.setUpListener(mq.queue, mq.natsMessageHandler, mq)
+	var cb ShutdownCallback
+
+	if mq.config.Service {
+		cb, err = mq.setUpMQListener(mq.qMgr, mq.queue, mq.createServiceCallback(mq))
+	} else {
+		cb, err = mq.setUpListener(mq.queue, mq.natsMessageHandler, mq)
+	}
+
 	if err != nil {
 		return err
 	}
 	mq.shutdownCB = cb
 
+	mq.startBacklogMonitor()
 	mq.stats.AddConnect()
-	mq.bridge.Logger().Tracef("opened and reading %s", mq.config.Queue)
-	mq.bridge.Logger().Noticef("started connection %s", mq.String())
+	mq.Logger().Tracef("opened and reading %s", mq.config.Queue)
+	mq.Logger().Noticef("started connection %s", mq.String())
 
 	return nil
 }
@@ -79,12 +87,13 @@ func (mq *Queue2NATSConnector) Shutdown() error {
 	mq.Lock()
 	defer mq.Unlock()
 	mq.stats.AddDisconnect()
+	mq.stopBacklogMonitor()
 
-	mq.bridge.Logger().Noticef("shutting down connection %s", mq.String())
+	mq.Logger().Noticef("shutting down connection %s", mq.String())
 
 	if mq.shutdownCB != nil {
 		if err := mq.shutdownCB(); err != nil {
-			mq.bridge.Logger().Noticef("error stopping listener for %s, %s", mq.String(), err.Error())
+			mq.Logger().Noticef("error stopping listener for %s, %s", mq.String(), err.Error())
 		}
 		mq.shutdownCB = nil
 	}
@@ -94,16 +103,16 @@ func (mq *Queue2NATSConnector) Shutdown() error {
 
 	if queue != nil {
 		if err := queue.Close(0); err != nil {
-			mq.bridge.Logger().Noticef("error closing queue for %s, %s", mq.String(), err.Error())
+			mq.Logger().Noticef("error closing queue for %s, %s", mq.String(), err.Error())
 		}
 	}
 
 	if mq.qMgr != nil {
 		if err := mq.qMgr.Disc(); err != nil {
-			mq.bridge.Logger().Noticef("error disconnecting from queue manager for %s, %s", mq.String(), err.Error())
+			mq.Logger().Noticef("error disconnecting from queue manager for %s, %s", mq.String(), err.Error())
 		}
 		mq.qMgr = nil
-		mq.bridge.Logger().Tracef("disconnected from queue manager for %s", mq.String())
+		mq.Logger().Tracef("disconnected from queue manager for %s", mq.String())
 	}
 
 	return nil // ignore the disconnect error
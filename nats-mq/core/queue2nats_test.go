@@ -17,6 +17,7 @@ package core
 
 import (
 	"bytes"
+	"encoding/hex"
 	"testing"
 	"time"
 
@@ -231,3 +232,105 @@ func TestSimpleSendOnQueueReceiveOnNatsPolling(t *testing.T) {
 	require.Equal(t, int64(0), connStats.Disconnects)
 	require.True(t, connStats.Connected)
 }
+
+func TestSendOnQueueReceiveOnNatsJSON(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+	msg := "hello world"
+	id := bytes.Repeat([]byte{1}, int(ibmmq.MQ_MSG_ID_LENGTH))
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:     "Queue2NATS",
+			Subject:  subject,
+			Queue:    queue,
+			Encoding: message.EncodingJSON,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	done := make(chan []byte)
+
+	sub, err := tbs.NC.Subscribe(subject, func(msg *nats.Msg) {
+		done <- msg.Data
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	mqmd := ibmmq.NewMQMD()
+	mqmd.MsgId = id
+	err = tbs.PutMessageOnQueue(queue, mqmd, []byte(msg))
+	require.NoError(t, err)
+
+	// don't wait forever
+	timer := time.NewTimer(3 * time.Second)
+	go func() {
+		<-timer.C
+		done <- []byte{}
+	}()
+
+	received := <-done
+
+	require.True(t, len(received) > 0)
+
+	_, err = message.DecodeBridgeMessage(received)
+	require.Error(t, err)
+
+	bridgeMessage, err := message.DecodeJSONBridgeMessage(received)
+	require.NoError(t, err)
+
+	require.Equal(t, msg, string(bridgeMessage.Body))
+	require.ElementsMatch(t, id, bridgeMessage.Header.MsgID)
+}
+
+func TestSendOnQueueReceiveOnNatsNATSHeaders(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+	msg := "hello world"
+	id := bytes.Repeat([]byte{1}, int(ibmmq.MQ_MSG_ID_LENGTH))
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:        "Queue2NATS",
+			Subject:     subject,
+			Queue:       queue,
+			NATSHeaders: true,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	done := make(chan *nats.Msg)
+
+	sub, err := tbs.NC.Subscribe(subject, func(msg *nats.Msg) {
+		done <- msg
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	mqmd := ibmmq.NewMQMD()
+	mqmd.MsgId = id
+	err = tbs.PutMessageOnQueue(queue, mqmd, []byte(msg))
+	require.NoError(t, err)
+
+	var received *nats.Msg
+
+	select {
+	case received = <-done:
+	case <-time.After(3 * time.Second):
+	}
+
+	require.NotNil(t, received)
+	require.Equal(t, msg, string(received.Data))
+	require.Equal(t, hex.EncodeToString(id), received.Header.Get("MQ-MsgId"))
+	require.NotEmpty(t, received.Header.Get("MQ-PutDate"))
+
+	bridgeMessage, err := message.DecodeHeaders(received.Data, received.Header)
+	require.NoError(t, err)
+	require.ElementsMatch(t, id, bridgeMessage.Header.MsgID)
+}
@@ -46,7 +46,7 @@ func (mq *Queue2STANConnector) Start() error {
 		return fmt.Errorf("%s connector requires nats streaming to be available", mq.String())
 	}
 
-	mq.bridge.Logger().Tracef("starting connection %s", mq.String())
+	mq.Logger().Tracef("starting connection %s", mq.String())
 
 	err := mq.connectToMQ()
 	if err != nil {
@@ -67,9 +67,10 @@ func (mq *Queue2STANConnector) Start() error {
 	}
 	mq.shutdownCB = cb
 
+	mq.startBacklogMonitor()
 	mq.stats.AddConnect()
-	mq.bridge.Logger().Tracef("opened and reading %s", mq.config.Queue)
-	mq.bridge.Logger().Noticef("started connection %s", mq.String())
+	mq.Logger().Tracef("opened and reading %s", mq.config.Queue)
+	mq.Logger().Noticef("started connection %s", mq.String())
 	return nil
 }
 
@@ -78,12 +79,13 @@ func (mq *Queue2STANConnector) Shutdown() error {
 	mq.Lock()
 	defer mq.Unlock()
 	mq.stats.AddDisconnect()
+	mq.stopBacklogMonitor()
 
-	mq.bridge.Logger().Noticef("shutting down connection %s", mq.String())
+	mq.Logger().Noticef("shutting down connection %s", mq.String())
 
 	if mq.shutdownCB != nil {
 		if err := mq.shutdownCB(); err != nil {
-			mq.bridge.Logger().Noticef("error stopping listener for %s, %s", mq.String(), err.Error())
+			mq.Logger().Noticef("error stopping listener for %s, %s", mq.String(), err.Error())
 		}
 		mq.shutdownCB = nil
 	}
@@ -92,19 +94,19 @@ func (mq *Queue2STANConnector) Shutdown() error {
 	mq.queue = nil
 
 	if queue != nil {
-		mq.bridge.Logger().Noticef("shutting down queue")
+		mq.Logger().Noticef("shutting down queue")
 		if err := queue.Close(0); err != nil {
-			mq.bridge.Logger().Noticef("error closing queue for %s, %s", mq.String(), err.Error())
+			mq.Logger().Noticef("error closing queue for %s, %s", mq.String(), err.Error())
 		}
 	}
 
 	if mq.qMgr != nil {
-		mq.bridge.Logger().Noticef("shutting down qmgr")
+		mq.Logger().Noticef("shutting down qmgr")
 		if err := mq.qMgr.Disc(); err != nil {
-			mq.bridge.Logger().Noticef("error disconnecting from queue manager for %s, %s", mq.String(), err.Error())
+			mq.Logger().Noticef("error disconnecting from queue manager for %s, %s", mq.String(), err.Error())
 		}
 		mq.qMgr = nil
-		mq.bridge.Logger().Tracef("disconnected from queue manager for %s", mq.String())
+		mq.Logger().Tracef("disconnected from queue manager for %s", mq.String())
 	}
 
 	return nil
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+)
+
+// reportDataLength is the number of bytes from the message included in a report that asks for data, as in MQ
+const reportDataLength = 100
+
+// reportType describes one kind of report in the MQMD report options
+type reportType struct {
+	name         string
+	option       int32
+	withData     int32
+	withFullData int32
+	feedback     int32
+}
+
+var (
+	reportCOA = reportType{"COA", ibmmq.MQRO_COA, ibmmq.MQRO_COA_WITH_DATA, ibmmq.MQRO_COA_WITH_FULL_DATA, ibmmq.MQFB_COA}
+	reportCOD = reportType{"COD", ibmmq.MQRO_COD, ibmmq.MQRO_COD_WITH_DATA, ibmmq.MQRO_COD_WITH_FULL_DATA, ibmmq.MQFB_COD}
+
+	reportException = reportType{"exception", ibmmq.MQRO_EXCEPTION, ibmmq.MQRO_EXCEPTION_WITH_DATA,
+		ibmmq.MQRO_EXCEPTION_WITH_FULL_DATA, ibmmq.MQFB_NOT_DELIVERED}
+)
+
+// validateReports checks that reports are only used when getting from MQ, groups are committed
+// or backed out as a unit so they can't be reported on, or discarded, one message at a time
+func validateReports(config conf.ConnectorConfig) error {
+	if config.Reports {
+		switch config.Type {
+		case conf.Queue2NATS, conf.Queue2Stan, conf.Topic2NATS, conf.Topic2Stan:
+		default:
+			return fmt.Errorf("reports can only be used by connectors that get messages from MQ")
+		}
+
+		if config.MessageGroups != "" {
+			return fmt.Errorf("reports can't be used with message groups")
+		}
+	}
+
+	return nil
+}
+
+// requested returns true if the report options ask for this kind of report
+func (r reportType) requested(report int32) bool {
+	return report&r.option != 0
+}
+
+// data returns the part of the body the report options ask to include in this kind of report
+func (r reportType) data(report int32, body []byte) []byte {
+	if report&r.withFullData == r.withFullData {
+		return body
+	}
+
+	if report&r.withData == r.withData {
+		if len(body) > reportDataLength {
+			return body[:reportDataLength]
+		}
+		return body
+	}
+
+	return nil
+}
+
+// putReport puts a report for the message to its reply queue, under syncpoint, so the report is committed
+// or backed out with the get - expects the lock to be held
+func (mq *BridgeConnector) putReport(md *ibmmq.MQMD, kind reportType, body []byte) error {
+	report := ibmmq.NewMQMD()
+	report.MsgType = ibmmq.MQMT_REPORT
+	report.Feedback = kind.feedback
+	report.Format = md.Format
+	report.CodedCharSetId = md.CodedCharSetId
+	report.Encoding = md.Encoding
+	report.Priority = md.Priority
+	report.Persistence = md.Persistence
+
+	mq.Logger().Tracef("%s putting %s report for %x to %s", mq.String(), kind.name, md.MsgId, md.ReplyToQ)
+
+	return mq.putToReplyQueue(md, report, EmptyHandle, kind.data(md.Report, body))
+}
+
+// sendDeliveryReports puts the COA and COD reports the message asks for, after it was published, a failure
+// is logged but doesn't stop the message - expects the lock to be held
+func (mq *BridgeConnector) sendDeliveryReports(md *ibmmq.MQMD, body []byte) {
+	if !mq.config.Reports || md.ReplyToQ == "" {
+		return
+	}
+
+	for _, kind := range []reportType{reportCOA, reportCOD} {
+		if !kind.requested(md.Report) {
+			continue
+		}
+
+		if err := mq.putReport(md, kind, body); err != nil {
+			mq.Logger().Noticef("%s report failure for %s, %s", kind.name, mq.String(), err.Error())
+		}
+	}
+}
+
+// handleUndelivered deals with a message that couldn't be converted or published, if reports are on and the
+// message asks to be discarded it is removed, with an exception report if one is requested, otherwise the
+// unit of work is backed out so the message is read again, without a report - expects the lock to be held
+func (mq *BridgeConnector) handleUndelivered(conn Connector, md *ibmmq.MQMD, body []byte) {
+	if !mq.config.Reports || md.Report&ibmmq.MQRO_DISCARD_MSG == 0 {
+		mq.qMgr.Back()
+		mq.stats.AddBackout()
+		return
+	}
+
+	if reportException.requested(md.Report) && md.ReplyToQ != "" {
+		if err := mq.putReport(md, reportException, body); err != nil {
+			mq.Logger().Noticef("exception report failure for %s, %s", mq.String(), err.Error())
+			mq.qMgr.Back()
+			mq.stats.AddBackout()
+			return
+		}
+	}
+
+	mq.Logger().Noticef("%s discarding message %x, as its report options ask", mq.String(), md.MsgId)
+
+	if err := mq.qMgr.Cmit(); err != nil {
+		mq.Logger().Noticef("failed to commit, %s", err.Error())
+		mq.stats.AddCommitError(err)
+		go mq.bridge.ConnectorError(conn, err) // run in a go routine so we can finish this method and unlock
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportTypeData(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 200)
+
+	require.True(t, reportCOA.requested(ibmmq.MQRO_COA))
+	require.True(t, reportCOA.requested(ibmmq.MQRO_COA_WITH_FULL_DATA))
+	require.False(t, reportCOA.requested(ibmmq.MQRO_COD))
+	require.True(t, reportException.requested(ibmmq.MQRO_EXCEPTION_WITH_DATA|ibmmq.MQRO_DISCARD_MSG))
+
+	require.Nil(t, reportCOA.data(ibmmq.MQRO_COA, body))
+	require.Equal(t, body[:reportDataLength], reportCOA.data(ibmmq.MQRO_COA_WITH_DATA, body))
+	require.Equal(t, body, reportCOA.data(ibmmq.MQRO_COA_WITH_FULL_DATA, body))
+	require.Equal(t, []byte("short"), reportCOD.data(ibmmq.MQRO_COD_WITH_DATA, []byte("short")))
+	require.Nil(t, reportCOD.data(ibmmq.MQRO_COA_WITH_FULL_DATA, body))
+}
+
+func TestUndeliverableMessageIsDiscardedWithExceptionReport(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+	replyQueue := "DEV.QUEUE.2"
+	id := bytes.Repeat([]byte{1}, int(ibmmq.MQ_MSG_ID_LENGTH))
+
+	// larger than the NATS max payload, so the publish fails
+	msg := bytes.Repeat([]byte("0123456789"), 200*1024)
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:           "Queue2NATS",
+			Subject:        subject,
+			Queue:          queue,
+			ExcludeHeaders: true,
+			Reports:        true,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	mqmd := ibmmq.NewMQMD()
+	mqmd.MsgId = id
+	mqmd.ReplyToQ = replyQueue
+	mqmd.Report = ibmmq.MQRO_EXCEPTION_WITH_DATA | ibmmq.MQRO_DISCARD_MSG
+	err = tbs.PutMessageOnQueue(queue, mqmd, msg)
+	require.NoError(t, err)
+
+	reportMD, _, data, err := tbs.GetMessageFromQueue(replyQueue, 5000)
+	require.NoError(t, err)
+	require.Equal(t, ibmmq.MQMT_REPORT, reportMD.MsgType)
+	require.Equal(t, ibmmq.MQFB_NOT_DELIVERED, reportMD.Feedback)
+	require.Equal(t, id, reportMD.CorrelId)
+	require.Equal(t, msg[:reportDataLength], data)
+
+	_, _, _, err = tbs.GetMessageFromQueue(queue, 500)
+	require.Error(t, err)
+}
+
+func TestReportsConfigIsValidated(t *testing.T) {
+	config := conf.ConnectorConfig{
+		Type:    "NATS2Queue",
+		Subject: "test",
+		Queue:   "DEV.QUEUE.1",
+		Reports: true,
+	}
+
+	_, err := CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+
+	config.Type = "Queue2NATS"
+	config.MessageGroups = "batch"
+	_, err = CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+}
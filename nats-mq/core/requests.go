@@ -0,0 +1,316 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
+)
+
+const (
+	// DefaultRequestTimeout is the time, in milliseconds, a request waits for an MQ reply if no timeout is configured
+	DefaultRequestTimeout = 30000
+
+	// DefaultReplyModelQueue is the model queue used to create a dynamic reply queue if no reply queue is configured
+	DefaultReplyModelQueue = "SYSTEM.DEFAULT.MODEL.QUEUE"
+)
+
+// pendingRequest is a NATS request that was put to MQ and is waiting for a reply
+type pendingRequest struct {
+	inbox string
+	keys  []string
+	timer *time.Timer
+}
+
+// requestState holds the reply queue and the requests in flight for a request/reply connector
+// The reply queue uses its own queue manager connection so that replies don't wait on puts
+type requestState struct {
+	qMgr       *ibmmq.MQQueueManager
+	queue      *ibmmq.MQObject
+	dynamic    bool
+	shutdownCB ShutdownCallback
+	pending    map[string]*pendingRequest // by MsgId and CorrelId
+}
+
+// validateRequestReply checks that request/reply is on a NATS to queue connector with one kind of reply queue
+func validateRequestReply(config conf.ConnectorConfig) error {
+	if !config.RequestReply {
+		return nil
+	}
+
+	if config.Type != conf.NATS2Queue {
+		return fmt.Errorf("request/reply is only supported by NATS to queue connectors")
+	}
+
+	if config.ReplyQueue != "" && config.ReplyModelQueue != "" {
+		return fmt.Errorf("can't use a reply queue and a reply model queue on the same connector")
+	}
+
+	if config.RequestTimeout < 0 {
+		return fmt.Errorf("request timeout can't be negative")
+	}
+
+	return nil
+}
+
+// startReplyListener connects to MQ, opens the reply queue and starts listening for replies
+// expects the lock to be held
+func (mq *BridgeConnector) startReplyListener(conn Connector) error {
+	qMgr, err := ConnectToQueueManager(mq.config.MQ)
+	if err != nil {
+		return err
+	}
+
+	requests := &requestState{
+		qMgr:    qMgr,
+		pending: map[string]*pendingRequest{},
+	}
+	mq.requests = requests
+
+	mqod := ibmmq.NewMQOD()
+	mqod.ObjectType = ibmmq.MQOT_Q
+	mqod.ObjectName = mq.config.ReplyQueue
+
+	if mq.config.ReplyQueue == "" {
+		mqod.ObjectName = mq.config.ReplyModelQueue
+		if mqod.ObjectName == "" {
+			mqod.ObjectName = DefaultReplyModelQueue
+		}
+		requests.dynamic = true
+	}
+
+	queue, err := qMgr.Open(mqod, ibmmq.MQOO_INPUT_SHARED)
+	if err != nil {
+		return err
+	}
+	requests.queue = &queue
+
+	mq.Logger().Tracef("%s reading replies from %s", mq.String(), queue.Name)
+
+	cb, err := mq.setUpMQListener(qMgr, requests.queue, mq.createReplyCallback(conn))
+	if err != nil {
+		return err
+	}
+	requests.shutdownCB = cb
+
+	return nil
+}
+
+// stopReplyListener stops listening for replies, closes the reply queue, deleting it if it is dynamic,
+// and drops the pending requests - expects the lock to be held
+func (mq *BridgeConnector) stopReplyListener() {
+	requests := mq.requests
+	mq.requests = nil
+
+	if requests == nil {
+		return
+	}
+
+	if requests.shutdownCB != nil {
+		if err := requests.shutdownCB(); err != nil {
+			mq.Logger().Noticef("error stopping reply listener for %s, %s", mq.String(), err.Error())
+		}
+	}
+
+	if requests.queue != nil {
+		closeOptions := int32(ibmmq.MQCO_NONE)
+		if requests.dynamic {
+			closeOptions = ibmmq.MQCO_DELETE_PURGE
+		}
+		if err := requests.queue.Close(closeOptions); err != nil {
+			mq.Logger().Noticef("error closing reply queue for %s, %s", mq.String(), err.Error())
+		}
+	}
+
+	for _, request := range requests.pending {
+		request.timer.Stop()
+	}
+
+	if err := requests.qMgr.Disc(); err != nil {
+		mq.Logger().Noticef("error disconnecting reply queue manager for %s, %s", mq.String(), err.Error())
+	}
+}
+
+// isRequest returns true if a NATS message should be put to MQ as a request
+func (mq *BridgeConnector) isRequest(replyTo string) bool {
+	return mq.requests != nil && replyTo != ""
+}
+
+// prepareRequest marks the MQMD as a request, with the reply queue - expects the lock to be held
+func (mq *BridgeConnector) prepareRequest(mqmd *ibmmq.MQMD) {
+	mqmd.MsgType = ibmmq.MQMT_REQUEST
+	mqmd.ReplyToQ = mq.requests.queue.Name
+	mqmd.ReplyToQMgr = "" // filled in by the queue manager
+}
+
+// trackRequest records the MsgId and CorrelId of a request that was put to MQ against the NATS inbox
+// the request is dropped if no reply arrives before the timeout - expects the lock to be held
+func (mq *BridgeConnector) trackRequest(mqmd *ibmmq.MQMD, inbox string) {
+	request := &pendingRequest{
+		inbox: inbox,
+		keys:  []string{string(mqmd.MsgId)},
+	}
+
+	if !isEmptyID(mqmd.CorrelId) && !bytes.Equal(mqmd.CorrelId, mqmd.MsgId) {
+		request.keys = append(request.keys, string(mqmd.CorrelId))
+	}
+
+	for _, key := range request.keys {
+		mq.requests.pending[key] = request
+	}
+
+	timeout := mq.config.RequestTimeout
+	if timeout == 0 {
+		timeout = DefaultRequestTimeout
+	}
+
+	request.timer = time.AfterFunc(time.Duration(timeout)*time.Millisecond, func() {
+		mq.Lock()
+		defer mq.Unlock()
+
+		if mq.requests == nil || mq.requests.pending[request.keys[0]] != request {
+			return
+		}
+
+		mq.removeRequest(request)
+		mq.stats.AddRequestTimeout()
+		mq.Logger().Tracef("%s request to %s timed out", mq.String(), request.inbox)
+	})
+}
+
+// takeRequest finds and removes the request that a reply is for, replies carry the request's MsgId
+// in their CorrelId by default, or the request's CorrelId or MsgId if the request asked for it
+// expects the lock to be held
+func (mq *BridgeConnector) takeRequest(mqmd *ibmmq.MQMD) *pendingRequest {
+	for _, id := range [][]byte{mqmd.CorrelId, mqmd.MsgId} {
+		request, ok := mq.requests.pending[string(id)]
+
+		if ok {
+			request.timer.Stop()
+			mq.removeRequest(request)
+			return request
+		}
+	}
+	return nil
+}
+
+// removeRequest drops a pending request - expects the lock to be held
+func (mq *BridgeConnector) removeRequest(request *pendingRequest) {
+	for _, key := range request.keys {
+		delete(mq.requests.pending, key)
+	}
+}
+
+// createReplyCallback returns the MQ callback for the reply queue, replies are published to the
+// inbox of the matching request, replies that don't match a request are counted and removed
+func (mq *BridgeConnector) createReplyCallback(conn Connector) ibmmq.MQCB_FUNCTION {
+	return func(qMgr *ibmmq.MQQueueManager, hObj *ibmmq.MQObject, md *ibmmq.MQMD, gmo *ibmmq.MQGMO, buffer []byte, cbc *ibmmq.MQCBC, mqErr *ibmmq.MQReturn) {
+		mq.Lock()
+		defer mq.Unlock()
+		start := time.Now()
+
+		if mqErr != nil && mqErr.MQCC != ibmmq.MQCC_OK {
+			if mqErr.MQRC == ibmmq.MQRC_NO_MSG_AVAILABLE {
+				return
+			}
+			go mq.bridge.ConnectorError(conn, fmt.Errorf("mq error in reply callback %s", mqErr.Error()))
+			return
+		}
+
+		// ignore event calls, and replies that arrive after shutdown
+		if (cbc != nil && cbc.CallType == ibmmq.MQCBCT_EVENT_CALL) || mq.requests == nil {
+			return
+		}
+
+		bufferLen := len(buffer)
+		mq.stats.AddMessageIn(int64(bufferLen))
+
+		request := mq.takeRequest(md)
+
+		if request == nil {
+			mq.stats.AddOrphanedReply()
+			mq.Logger().Noticef("%s removing reply with correlation id %x, it doesn't match a pending request", mq.String(), md.CorrelId)
+			mq.commitReply(qMgr, conn)
+			return
+		}
+
+		qmgrFlag := qMgr
+
+		if mq.config.ExcludeHeaders {
+			qmgrFlag = nil
+		}
+
+		var natsMsg []byte
+		var header nats.Header
+		var err error
+
+		if mq.config.NATSHeaders {
+			natsMsg, header, _, err = mq.bridge.MQToNATSHeaders(md, gmo.MsgHandle, buffer, bufferLen, mq.messageOptions())
+		} else {
+			natsMsg, _, err = mq.bridge.MQToNATSMessageWithOptions(md, gmo.MsgHandle, buffer, bufferLen, qmgrFlag, mq.messageOptions())
+		}
+
+		if err == nil {
+			err = mq.publishPayload(func(natsMsg []byte, header nats.Header, replyTo string) error {
+				return mq.bridge.NATS().PublishMsg(&nats.Msg{
+					Subject: request.inbox,
+					Header:  header,
+					Data:    natsMsg,
+				})
+			}, natsMsg, header, "")
+		}
+
+		// the request is gone either way, so the reply is removed even if it can't be delivered
+		if err != nil {
+			mq.Logger().Noticef("reply failure for %s, %s", mq.String(), err.Error())
+		}
+
+		if !mq.commitReply(qMgr, conn) || err != nil {
+			return
+		}
+
+		mq.stats.AddMessageOut(int64(len(natsMsg)))
+		mq.stats.AddRequestTime(time.Since(start))
+	}
+}
+
+// commitReply commits the get from the reply queue, returns false if the connector has to restart
+func (mq *BridgeConnector) commitReply(qMgr *ibmmq.MQQueueManager, conn Connector) bool {
+	if err := qMgr.Cmit(); err != nil {
+		mq.Logger().Noticef("failed to commit, %s", err.Error())
+		mq.stats.AddCommitError(err)
+		mq.backoutOffloaded()
+		go mq.bridge.ConnectorError(conn, err) // run in a go routine so we can finish this method and unlock
+		return false
+	}
+	mq.commitOffloaded()
+	return true
+}
+
+// isEmptyID returns true if a MsgId or CorrelId is all zeros
+func isEmptyID(id []byte) bool {
+	for _, b := range id {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	"github.com/stretchr/testify/require"
+)
+
+func testNATSRequestToMQ(t *testing.T, replyQueue string) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+	msg := "hello world"
+	response := "goodbye"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:           "NATS2Queue",
+			Subject:        subject,
+			Queue:          queue,
+			ExcludeHeaders: true,
+			RequestReply:   true,
+			ReplyQueue:     replyQueue,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	go func() {
+		mqmd, _, data, err := tbs.GetMessageFromQueue(queue, 5000)
+		if err != nil || string(data) != msg || mqmd.MsgType != ibmmq.MQMT_REQUEST {
+			return
+		}
+		reply := ibmmq.NewMQMD()
+		reply.MsgType = ibmmq.MQMT_REPLY
+		reply.CorrelId = mqmd.MsgId
+		tbs.PutMessageOnQueue(mqmd.ReplyToQ, reply, []byte(response))
+	}()
+
+	reply, err := tbs.NC.Request(subject, []byte(msg), 5*time.Second)
+	require.NoError(t, err)
+	require.Equal(t, response, string(reply.Data))
+
+	stats := tbs.Bridge.SafeStats()
+	connStats := stats.Connections[0]
+	require.Equal(t, int64(2), connStats.MessagesIn)
+	require.Equal(t, int64(2), connStats.MessagesOut)
+	require.Equal(t, int64(0), connStats.RequestTimeouts)
+	require.Equal(t, int64(0), connStats.OrphanedReplies)
+}
+
+func TestNATSRequestToMQWithDynamicReplyQueue(t *testing.T) {
+	testNATSRequestToMQ(t, "")
+}
+
+func TestNATSRequestToMQWithSharedReplyQueue(t *testing.T) {
+	testNATSRequestToMQ(t, "DEV.QUEUE.2")
+}
+
+func TestNATSRequestToMQTimeoutAndOrphanedReply(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+	replyQueue := "DEV.QUEUE.2"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:           "NATS2Queue",
+			Subject:        subject,
+			Queue:          queue,
+			ExcludeHeaders: true,
+			RequestReply:   true,
+			ReplyQueue:     replyQueue,
+			RequestTimeout: 100,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	_, err = tbs.NC.Request(subject, []byte("hello"), 500*time.Millisecond)
+	require.Error(t, err)
+
+	mqmd, _, _, err := tbs.GetMessageFromQueue(queue, 5000)
+	require.NoError(t, err)
+
+	// the request has timed out, so the reply doesn't match anything
+	reply := ibmmq.NewMQMD()
+	reply.CorrelId = mqmd.MsgId
+	err = tbs.PutMessageOnQueue(replyQueue, reply, []byte("late"))
+	require.NoError(t, err)
+
+	reply = ibmmq.NewMQMD()
+	reply.CorrelId = bytes.Repeat([]byte{7}, int(ibmmq.MQ_CORREL_ID_LENGTH))
+	err = tbs.PutMessageOnQueue(replyQueue, reply, []byte("unknown"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return tbs.Bridge.SafeStats().Connections[0].OrphanedReplies == 2
+	}, 5*time.Second, 50*time.Millisecond)
+
+	stats := tbs.Bridge.SafeStats()
+	require.Equal(t, int64(1), stats.Connections[0].RequestTimeouts)
+}
+
+func TestRequestReplyConfigIsValidated(t *testing.T) {
+	config := conf.ConnectorConfig{
+		Type:         "Queue2NATS",
+		Subject:      "test",
+		Queue:        "DEV.QUEUE.1",
+		RequestReply: true,
+	}
+
+	_, err := CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+
+	config = conf.ConnectorConfig{
+		Type:            "NATS2Queue",
+		Subject:         "test",
+		Queue:           "DEV.QUEUE.1",
+		RequestReply:    true,
+		ReplyQueue:      "DEV.QUEUE.2",
+		ReplyModelQueue: DefaultReplyModelQueue,
+	}
+
+	_, err = CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+}
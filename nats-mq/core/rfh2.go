@@ -0,0 +1,532 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/message"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+)
+
+const (
+	rfh2StrucID = "RFH "
+
+	rfh2FolderMCD = "mcd"
+	rfh2FolderJMS = "jms"
+	rfh2FolderUSR = "usr"
+)
+
+// rfh2JMSFields maps the elements in the jms folder to JMS header names
+var rfh2JMSFields = map[string]string{
+	"Dst": "JMSDestination",
+	"Rto": "JMSReplyTo",
+	"Tms": "JMSTimestamp",
+	"Exp": "JMSExpiration",
+	"Pri": "JMSPriority",
+	"Dlv": "JMSDeliveryMode",
+	"Cid": "JMSCorrelationID",
+	"Gid": "JMSXGroupID",
+	"Seq": "JMSXGroupSeq",
+}
+
+// rfh2MCDFields maps the elements in the mcd folder to JMS header names
+var rfh2MCDFields = map[string]string{
+	"Type": "JMSType",
+}
+
+// rfh2Header is an MQRFH2 header, the integers in the fixed part use the encoding from the MQMD
+// Encoding, CodedCharSetID and Format describe the payload that follows the header
+type rfh2Header struct {
+	Encoding       int32
+	CodedCharSetID int32
+	Format         string
+	Flags          int32
+	NameValueCCSID int32
+	Folders        []string
+}
+
+// validateRFH2 checks that connectors that read from MQ can see the RFH2 header they should remove
+func validateRFH2(config conf.ConnectorConfig) error {
+	if !config.RFH2 {
+		return nil
+	}
+
+	switch config.Type {
+	case conf.Queue2NATS, conf.Queue2Stan, conf.Topic2NATS, conf.Topic2Stan:
+		if config.ExcludeHeaders {
+			return fmt.Errorf("RFH2 headers can't be removed when headers are excluded")
+		}
+	}
+
+	return nil
+}
+
+// isRFH2Format returns true if the format names an MQRFH2 header
+func isRFH2Format(format string) bool {
+	return strings.TrimSpace(format) == strings.TrimSpace(ibmmq.MQFMT_RF_HEADER_2)
+}
+
+// rfh2ByteOrder returns the byte order for integers written with the MQ encoding
+func rfh2ByteOrder(encoding int32) binary.ByteOrder {
+	if encoding&ibmmq.MQENC_INTEGER_MASK == ibmmq.MQENC_INTEGER_REVERSED {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// parseRFH2 reads an MQRFH2 header from the start of data, returning the header and the payload
+func parseRFH2(data []byte, encoding int32) (*rfh2Header, []byte, error) {
+	fixedLength := int(ibmmq.MQRFH_STRUC_LENGTH_FIXED_2)
+
+	if len(data) < fixedLength || string(data[0:4]) != rfh2StrucID {
+		return nil, nil, fmt.Errorf("message does not start with an RFH2 header")
+	}
+
+	order := rfh2ByteOrder(encoding)
+
+	version := int32(order.Uint32(data[4:8]))
+	if version != ibmmq.MQRFH_VERSION_2 {
+		return nil, nil, fmt.Errorf("unsupported RFH version %d", version)
+	}
+
+	strucLength := int(int32(order.Uint32(data[8:12])))
+	if strucLength < fixedLength || strucLength > len(data) {
+		return nil, nil, fmt.Errorf("invalid RFH2 length %d", strucLength)
+	}
+
+	header := &rfh2Header{
+		Encoding:       int32(order.Uint32(data[12:16])),
+		CodedCharSetID: int32(order.Uint32(data[16:20])),
+		Format:         strings.TrimRight(string(data[20:28]), " \x00"),
+		Flags:          int32(order.Uint32(data[28:32])),
+		NameValueCCSID: int32(order.Uint32(data[32:36])),
+	}
+
+	if header.NameValueCCSID != CCSIDUTF8 {
+		return nil, nil, fmt.Errorf("unsupported RFH2 name value CCSID %d", header.NameValueCCSID)
+	}
+
+	for offset := fixedLength; offset < strucLength; {
+		if offset+4 > strucLength {
+			return nil, nil, fmt.Errorf("truncated RFH2 folder length")
+		}
+
+		length := int(int32(order.Uint32(data[offset : offset+4])))
+		offset += 4
+
+		if length < 0 || offset+length > strucLength {
+			return nil, nil, fmt.Errorf("invalid RFH2 folder length %d", length)
+		}
+
+		folder := strings.TrimRight(string(data[offset:offset+length]), " \x00")
+		if folder != "" {
+			header.Folders = append(header.Folders, folder)
+		}
+		offset += length
+	}
+
+	return header, data[strucLength:], nil
+}
+
+// Bytes writes the header, with the folders padded to a multiple of 4 bytes
+func (h *rfh2Header) Bytes(encoding int32) []byte {
+	order := rfh2ByteOrder(encoding)
+	folders := make([][]byte, 0, len(h.Folders))
+	strucLength := int(ibmmq.MQRFH_STRUC_LENGTH_FIXED_2)
+
+	for _, folder := range h.Folders {
+		padded := []byte(folder)
+		if r := len(padded) % 4; r != 0 {
+			padded = append(padded, bytes.Repeat([]byte(" "), 4-r)...)
+		}
+		folders = append(folders, padded)
+		strucLength += 4 + len(padded)
+	}
+
+	buf := make([]byte, strucLength)
+	copy(buf[0:4], rfh2StrucID)
+	order.PutUint32(buf[4:8], uint32(ibmmq.MQRFH_VERSION_2))
+	order.PutUint32(buf[8:12], uint32(strucLength))
+	order.PutUint32(buf[12:16], uint32(h.Encoding))
+	order.PutUint32(buf[16:20], uint32(h.CodedCharSetID))
+	copy(buf[20:28], fmt.Sprintf("%-8s", h.Format))
+	order.PutUint32(buf[28:32], uint32(h.Flags))
+	order.PutUint32(buf[32:36], uint32(h.NameValueCCSID))
+
+	offset := int(ibmmq.MQRFH_STRUC_LENGTH_FIXED_2)
+	for _, folder := range folders {
+		order.PutUint32(buf[offset:offset+4], uint32(len(folder)))
+		offset += 4
+		copy(buf[offset:], folder)
+		offset += len(folder)
+	}
+
+	return buf
+}
+
+// rfh2Element is a leaf element from a folder, the path doesn't include the folder name
+type rfh2Element struct {
+	path     string
+	dataType string
+	null     bool
+	value    string
+}
+
+// parseRFH2Folder returns the folder name and the leaf elements it contains
+func parseRFH2Folder(folder string) (string, []rfh2Element, error) {
+	type frame struct {
+		name        string
+		dataType    string
+		null        bool
+		text        strings.Builder
+		hasChildren bool
+	}
+
+	decoder := xml.NewDecoder(strings.NewReader(folder))
+	stack := []*frame{}
+	elements := []rfh2Element{}
+	name := ""
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid RFH2 folder, %s", err.Error())
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			f := &frame{name: t.Name.Local}
+			for _, attr := range t.Attr {
+				switch attr.Name.Local {
+				case "dt":
+					f.dataType = attr.Value
+				case "nil":
+					f.null = attr.Value == "true" || attr.Value == "1"
+				}
+			}
+			if len(stack) == 0 {
+				name = f.name
+			} else {
+				stack[len(stack)-1].hasChildren = true
+			}
+			stack = append(stack, f)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		case xml.EndElement:
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			if len(stack) > 0 && !f.hasChildren {
+				path := []string{}
+				for _, parent := range stack[1:] {
+					path = append(path, parent.name)
+				}
+				path = append(path, f.name)
+				elements = append(elements, rfh2Element{
+					path:     strings.Join(path, "."),
+					dataType: f.dataType,
+					null:     f.null,
+					value:    f.text.String(),
+				})
+			}
+		}
+	}
+
+	if name == "" {
+		return "", nil, fmt.Errorf("invalid RFH2 folder, no root element")
+	}
+
+	return name, elements, nil
+}
+
+// parseRFH2Value returns the go value for an element, based on the dt attribute
+func parseRFH2Value(element rfh2Element) (interface{}, error) {
+	if element.null {
+		return nil, nil
+	}
+
+	switch element.dataType {
+	case "", "string":
+		return element.value, nil
+	case "boolean":
+		return strconv.ParseBool(element.value)
+	case "bin.hex":
+		return hex.DecodeString(element.value)
+	case "i1":
+		v, err := strconv.ParseInt(element.value, 10, 8)
+		return int8(v), err
+	case "i2":
+		v, err := strconv.ParseInt(element.value, 10, 16)
+		return int16(v), err
+	case "i4", "int":
+		v, err := strconv.ParseInt(element.value, 10, 32)
+		return int32(v), err
+	case "i8":
+		return strconv.ParseInt(element.value, 10, 64)
+	case "r4":
+		v, err := strconv.ParseFloat(element.value, 32)
+		return float32(v), err
+	case "r8":
+		return strconv.ParseFloat(element.value, 64)
+	default:
+		return nil, fmt.Errorf("unknown RFH2 data type %q", element.dataType)
+	}
+}
+
+// parseJMSValue returns the go value for the numeric JMS fields, other fields are strings
+func parseJMSValue(name string, value string) (interface{}, error) {
+	switch name {
+	case "JMSTimestamp", "JMSExpiration":
+		return strconv.ParseInt(value, 10, 64)
+	case "JMSPriority", "JMSDeliveryMode", "JMSXGroupSeq":
+		v, err := strconv.ParseInt(value, 10, 32)
+		return int32(v), err
+	default:
+		return value, nil
+	}
+}
+
+// copyRFH2Folders sets properties on the message from the RFH2 folders
+// jms and mcd elements use JMS names, like JMSCorrelationID and JMSType, when there is one
+// and <folder>.<element> otherwise, usr elements use the element name and the dt attribute
+// elements in any other folder are copied as <folder>.<element> strings
+func copyRFH2Folders(folders []string, msg *message.BridgeMessage) error {
+	for _, folder := range folders {
+		folderName, elements, err := parseRFH2Folder(folder)
+		if err != nil {
+			return err
+		}
+
+		for _, element := range elements {
+			var name string
+			var value interface{}
+
+			switch folderName {
+			case rfh2FolderUSR:
+				name = element.path
+				value, err = parseRFH2Value(element)
+			case rfh2FolderJMS, rfh2FolderMCD:
+				fields := rfh2JMSFields
+				if folderName == rfh2FolderMCD {
+					fields = rfh2MCDFields
+				}
+
+				jmsName, ok := fields[element.path]
+				if ok {
+					name = jmsName
+					value, err = parseJMSValue(jmsName, element.value)
+				} else {
+					name = folderName + "." + element.path
+					value = element.value
+				}
+			default:
+				name = folderName + "." + element.path
+				value = element.value
+			}
+
+			if err != nil {
+				return fmt.Errorf("error reading RFH2 element %s in folder %s, %s", element.path, folderName, err.Error())
+			}
+
+			if err := msg.SetProperty(name, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// formatRFH2Element writes one element, adding the dt attribute for usr properties
+func formatRFH2Element(buf *bytes.Buffer, name string, value interface{}, typed bool) {
+	dataType := ""
+	text := ""
+
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("<" + name + " xsi:nil=\"true\"></" + name + ">")
+		return
+	case string:
+		text = v
+	case bool:
+		dataType = "boolean"
+		text = strconv.FormatBool(v)
+	case []byte:
+		dataType = "bin.hex"
+		text = strings.ToUpper(hex.EncodeToString(v))
+	case int8:
+		dataType = "i1"
+		text = strconv.FormatInt(int64(v), 10)
+	case int16:
+		dataType = "i2"
+		text = strconv.FormatInt(int64(v), 10)
+	case int32:
+		dataType = "i4"
+		text = strconv.FormatInt(int64(v), 10)
+	case int64:
+		dataType = "i8"
+		text = strconv.FormatInt(v, 10)
+	case float32:
+		dataType = "r4"
+		text = strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		dataType = "r8"
+		text = strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		text = fmt.Sprintf("%v", v)
+	}
+
+	buf.WriteString("<" + name)
+	if typed && dataType != "" {
+		buf.WriteString(" dt=\"" + dataType + "\"")
+	}
+	buf.WriteString(">")
+	xml.EscapeText(buf, []byte(text))
+	buf.WriteString("</" + name + ">")
+}
+
+// buildRFH2Folders is the reverse of copyRFH2Folders, JMS names and mcd./jms. properties go into
+// the mcd and jms folders and everything else goes into the usr folder
+// the mcd folder always has a message domain, jms_text for MQSTR payloads and jms_bytes otherwise
+func buildRFH2Folders(msg *message.BridgeMessage) ([]string, error) {
+	reverse := map[string]string{}
+	for element, name := range rfh2JMSFields {
+		reverse[name] = rfh2FolderJMS + "." + element
+	}
+	for element, name := range rfh2MCDFields {
+		reverse[name] = rfh2FolderMCD + "." + element
+	}
+
+	names := make([]string, 0, len(msg.Properties))
+	for name := range msg.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mcd := &bytes.Buffer{}
+	jms := &bytes.Buffer{}
+	usr := &bytes.Buffer{}
+
+	if _, ok := msg.Properties["mcd.Msd"]; !ok {
+		domain := "jms_bytes"
+		if strings.TrimSpace(msg.Header.Format) == ibmmq.MQFMT_STRING {
+			domain = "jms_text"
+		}
+		formatRFH2Element(mcd, "Msd", domain, false)
+	}
+
+	for _, name := range names {
+		value, ok := msg.GetTypedProperty(name)
+		if !ok {
+			return nil, fmt.Errorf("broken message property %s", name)
+		}
+
+		target := name
+		if mapped, ok := reverse[name]; ok {
+			target = mapped
+		}
+
+		switch {
+		case strings.HasPrefix(target, rfh2FolderMCD+"."):
+			formatRFH2Element(mcd, strings.TrimPrefix(target, rfh2FolderMCD+"."), value, false)
+		case strings.HasPrefix(target, rfh2FolderJMS+"."):
+			formatRFH2Element(jms, strings.TrimPrefix(target, rfh2FolderJMS+"."), value, false)
+		default:
+			formatRFH2Element(usr, name, value, true)
+		}
+	}
+
+	folders := []string{"<mcd>" + mcd.String() + "</mcd>"}
+	if jms.Len() > 0 {
+		folders = append(folders, "<jms>"+jms.String()+"</jms>")
+	}
+	if usr.Len() > 0 {
+		folders = append(folders, "<usr>"+usr.String()+"</usr>")
+	}
+	return folders, nil
+}
+
+// stripRFH2 replaces an RFH2 body with the payload that follows the header, copying the folders
+// into the message properties and the payload encoding, CCSID and format into the message header
+func stripRFH2(msg *message.BridgeMessage) error {
+	if !isRFH2Format(msg.Header.Format) {
+		return nil
+	}
+
+	header, payload, err := parseRFH2(msg.Body, msg.Header.Encoding)
+	if err != nil {
+		return err
+	}
+
+	if err := copyRFH2Folders(header.Folders, msg); err != nil {
+		return err
+	}
+
+	msg.Body = payload
+	msg.Header.Encoding = header.Encoding
+	msg.Header.Format = header.Format
+	if header.CodedCharSetID != ibmmq.MQCCSI_INHERIT {
+		msg.Header.CodedCharSetID = header.CodedCharSetID
+	}
+	return nil
+}
+
+// wrapRFH2 builds an RFH2 header from the message properties and returns it followed by the body
+// the MQMD is updated to describe the RFH2, the header describes the body
+func wrapRFH2(msg *message.BridgeMessage, mqmd *ibmmq.MQMD) ([]byte, error) {
+	folders, err := buildRFH2Folders(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	header := rfh2Header{
+		Encoding:       mqmd.Encoding,
+		CodedCharSetID: ibmmq.MQCCSI_INHERIT,
+		Format:         mqmd.Format,
+		Flags:          ibmmq.MQRFH_NONE,
+		NameValueCCSID: CCSIDUTF8,
+		Folders:        folders,
+	}
+
+	if header.Encoding == 0 {
+		header.Encoding = ibmmq.MQENC_NATIVE
+	}
+
+	// the header's strings are UTF-8, the body keeps its own CCSID in the header
+	if mqmd.CodedCharSetId > 0 {
+		header.CodedCharSetID = mqmd.CodedCharSetId
+		mqmd.CodedCharSetId = CCSIDUTF8
+	}
+
+	mqmd.Encoding = ibmmq.MQENC_NATIVE
+	mqmd.Format = ibmmq.MQFMT_RF_HEADER_2
+
+	return append(header.Bytes(mqmd.Encoding), msg.Body...), nil
+}
@@ -0,0 +1,266 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/message"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTestRFH2 writes a big endian RFH2 the way a JMS client on another platform would
+func buildTestRFH2(folders []string, payload string) []byte {
+	buf := &bytes.Buffer{}
+	body := &bytes.Buffer{}
+
+	for _, folder := range folders {
+		for len(folder)%4 != 0 {
+			folder += " "
+		}
+		binary.Write(body, binary.BigEndian, int32(len(folder)))
+		body.WriteString(folder)
+	}
+
+	buf.WriteString("RFH ")
+	binary.Write(buf, binary.BigEndian, int32(2))
+	binary.Write(buf, binary.BigEndian, int32(36+body.Len()))
+	binary.Write(buf, binary.BigEndian, int32(273))
+	binary.Write(buf, binary.BigEndian, int32(1208))
+	buf.WriteString("MQSTR   ")
+	binary.Write(buf, binary.BigEndian, int32(0))
+	binary.Write(buf, binary.BigEndian, int32(1208))
+	buf.Write(body.Bytes())
+	buf.WriteString(payload)
+	return buf.Bytes()
+}
+
+func TestStripRFH2(t *testing.T) {
+	folders := []string{
+		"<mcd><Msd>jms_text</Msd><Type>order</Type></mcd>",
+		"<jms><Dst>queue:///DEV.QUEUE.1</Dst><Tms>1560000000000</Tms><Cid>abc</Cid><Dlv>2</Dlv></jms>",
+		"<usr><count dt='i4'>11</count><name>bob &amp; alice</name><flag dt='boolean'>1</flag><missing xsi:nil='true'></missing></usr>",
+		"<other><a><b>c</b></a></other>",
+	}
+
+	msg := message.NewBridgeMessage(buildTestRFH2(folders, "hello world"))
+	msg.Header.Format = "MQHRF2"
+	msg.Header.Encoding = 273
+	msg.Header.CodedCharSetID = 1208
+
+	err := stripRFH2(msg)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(msg.Body))
+	require.Equal(t, "MQSTR", msg.Header.Format)
+	require.Equal(t, int32(273), msg.Header.Encoding)
+
+	expected := map[string]interface{}{
+		"mcd.Msd":          "jms_text",
+		"JMSType":          "order",
+		"JMSDestination":   "queue:///DEV.QUEUE.1",
+		"JMSTimestamp":     int64(1560000000000),
+		"JMSCorrelationID": "abc",
+		"JMSDeliveryMode":  int32(2),
+		"count":            int32(11),
+		"name":             "bob & alice",
+		"flag":             true,
+		"missing":          nil,
+		"other.a.b":        "c",
+	}
+
+	for k, v := range expected {
+		actual, ok := msg.GetTypedProperty(k)
+		require.True(t, ok, k)
+		require.Equal(t, v, actual, k)
+	}
+	require.Len(t, msg.Properties, len(expected))
+}
+
+func TestStripRFH2IgnoresOtherFormats(t *testing.T) {
+	msg := message.NewBridgeMessage([]byte("RFH hello world"))
+	msg.Header.Format = "MQSTR"
+
+	err := stripRFH2(msg)
+	require.NoError(t, err)
+	require.Equal(t, "RFH hello world", string(msg.Body))
+}
+
+func TestWrapAndStripRFH2(t *testing.T) {
+	msg := message.NewBridgeMessage([]byte("hello world"))
+	msg.Header.Format = "MQSTR"
+
+	expected := map[string]interface{}{
+		"JMSType":          "order",
+		"JMSCorrelationID": "abc",
+		"JMSPriority":      int32(4),
+		"string":           "a <b> & c",
+		"int8":             int8(9),
+		"int16":            int16(259),
+		"int32":            int32(222222222),
+		"int64":            int64(222222222222222222),
+		"float32":          float32(3.14),
+		"float64":          float64(6.4999),
+		"bool":             true,
+		"bytes":            []byte("one two three four"),
+		"null":             nil,
+	}
+
+	for k, v := range expected {
+		err := msg.SetProperty(k, v)
+		require.NoError(t, err)
+	}
+
+	mqmd := &ibmmq.MQMD{Format: "MQSTR"}
+	body, err := wrapRFH2(msg, mqmd)
+	require.NoError(t, err)
+	require.Equal(t, ibmmq.MQFMT_RF_HEADER_2, mqmd.Format)
+	require.Equal(t, ibmmq.MQENC_NATIVE, mqmd.Encoding)
+
+	header, payload, err := parseRFH2(body, mqmd.Encoding)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(payload))
+	require.Equal(t, "MQSTR", header.Format)
+	require.Equal(t, ibmmq.MQCCSI_INHERIT, header.CodedCharSetID)
+	require.Equal(t, "<mcd><Msd>jms_text</Msd><Type>order</Type></mcd>", header.Folders[0])
+	require.Equal(t, "<jms><Cid>abc</Cid><Pri>4</Pri></jms>", header.Folders[1])
+
+	copy := message.NewBridgeMessage(body)
+	copy.Header.Format = mqmd.Format
+	copy.Header.Encoding = mqmd.Encoding
+
+	err = stripRFH2(copy)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(copy.Body))
+
+	for k, v := range expected {
+		actual, ok := copy.GetTypedProperty(k)
+		require.True(t, ok, k)
+		require.Equal(t, v, actual, k)
+	}
+	require.Len(t, copy.Properties, len(expected)+1) // mcd.Msd is added
+}
+
+func TestBadRFH2(t *testing.T) {
+	_, _, err := parseRFH2([]byte("hello world"), ibmmq.MQENC_NATIVE)
+	require.Error(t, err)
+
+	good := buildTestRFH2([]string{"<usr><a>b</a></usr>"}, "")
+
+	bad := append([]byte{}, good...)
+	binary.BigEndian.PutUint32(bad[8:12], uint32(len(good)+4))
+	_, _, err = parseRFH2(bad, 273)
+	require.Error(t, err)
+
+	bad = append([]byte{}, good...)
+	binary.BigEndian.PutUint32(bad[36:40], 400)
+	_, _, err = parseRFH2(bad, 273)
+	require.Error(t, err)
+
+	bad = append([]byte{}, good...)
+	binary.BigEndian.PutUint32(bad[32:36], 1200)
+	_, _, err = parseRFH2(bad, 273)
+	require.Error(t, err)
+
+	msg := message.NewBridgeMessage(buildTestRFH2([]string{"<usr><a dt='i4'>b</a></usr>"}, ""))
+	msg.Header.Format = "MQHRF2"
+	msg.Header.Encoding = 273
+	require.Error(t, stripRFH2(msg))
+
+	msg = message.NewBridgeMessage(buildTestRFH2([]string{"<usr><a>b</usr>"}, ""))
+	msg.Header.Format = "MQHRF2"
+	msg.Header.Encoding = 273
+	require.Error(t, stripRFH2(msg))
+}
+
+func TestConvertRFH2ForPut(t *testing.T) {
+	mq := &BridgeConnector{
+		config: conf.ConnectorConfig{
+			CCSID: 500,
+		},
+	}
+
+	msg := message.NewBridgeMessage([]byte("[!]"))
+	mqmd := &ibmmq.MQMD{CodedCharSetId: 1208}
+	body, err := wrapRFH2(msg, mqmd)
+	require.NoError(t, err)
+
+	converted, err := mq.convertForPut(mqmd, body)
+	require.NoError(t, err)
+	require.Equal(t, ibmmq.MQFMT_RF_HEADER_2, mqmd.Format)
+	require.Equal(t, int32(1208), mqmd.CodedCharSetId)
+	require.True(t, bytes.HasPrefix(converted, []byte(rfh2StrucID)))
+
+	header, payload, err := parseRFH2(converted, mqmd.Encoding)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x4A, 0x4F, 0x5A}, payload)
+	require.Equal(t, int32(500), header.CodedCharSetID)
+	require.Equal(t, ibmmq.MQFMT_STRING, header.Format)
+	require.Equal(t, "<mcd><Msd>jms_text</Msd></mcd>", header.Folders[0])
+}
+
+func TestWrapRFH2MovesTheBodyCCSID(t *testing.T) {
+	msg := message.NewBridgeMessage([]byte("hello"))
+	mqmd := &ibmmq.MQMD{CodedCharSetId: 819, Format: "MQSTR"}
+	body, err := wrapRFH2(msg, mqmd)
+	require.NoError(t, err)
+	require.Equal(t, int32(CCSIDUTF8), mqmd.CodedCharSetId)
+
+	header, _, err := parseRFH2(body, mqmd.Encoding)
+	require.NoError(t, err)
+	require.Equal(t, int32(819), header.CodedCharSetID)
+}
+
+func TestRFH2IsOnlyRemovedWhenConfigured(t *testing.T) {
+	bridge := NewBridgeServer()
+	body := buildTestRFH2([]string{"<usr><name>bob</name></usr>"}, "hello world")
+	mqmd := &ibmmq.MQMD{Format: "MQHRF2", Encoding: 273, CodedCharSetId: 1208}
+
+	msg, err := bridge.mqToBridgeMessage(mqmd, EmptyHandle, body, "", MessageOptions{})
+	require.NoError(t, err)
+	require.Equal(t, body, msg.Body)
+	require.Empty(t, msg.Properties)
+
+	msg, err = bridge.mqToBridgeMessage(mqmd, EmptyHandle, body, "", MessageOptions{RFH2: true})
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(msg.Body))
+	name, ok := msg.GetTypedProperty("name")
+	require.True(t, ok)
+	require.Equal(t, "bob", name)
+
+	// a header the bridge can't parse is passed on instead of failing the message
+	bad := append([]byte{}, body...)
+	binary.BigEndian.PutUint32(bad[32:36], 819)
+	msg, err = bridge.mqToBridgeMessage(mqmd, EmptyHandle, bad, "", MessageOptions{RFH2: true})
+	require.NoError(t, err)
+	require.Equal(t, bad, msg.Body)
+}
+
+func TestRFH2ConfigErrors(t *testing.T) {
+	config := conf.ConnectorConfig{
+		Type:           "Queue2NATS",
+		Subject:        "test",
+		Queue:          "DEV.QUEUE.1",
+		RFH2:           true,
+		ExcludeHeaders: true,
+	}
+
+	_, err := CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+}
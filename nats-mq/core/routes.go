@@ -0,0 +1,232 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
+)
+
+// anyPersistence matches messages with any persistence in a route
+const anyPersistence int32 = -1
+
+// route is a parsed route config
+type route struct {
+	minPriority int32
+	maxPriority int32
+	persistence int32
+	config      conf.RouteConfig
+}
+
+// validateRoutes checks the routes, used when getting from MQ, and the priority and persistence
+// headers, used when putting messages from NATS
+func validateRoutes(config conf.ConnectorConfig) error {
+	if len(config.Routes) > 0 {
+		switch config.Type {
+		case conf.Queue2NATS, conf.Queue2Stan, conf.Topic2NATS, conf.Topic2Stan:
+		default:
+			return fmt.Errorf("routes can only be used by connectors that get messages from MQ")
+		}
+
+		if config.Service {
+			return fmt.Errorf("routes can't be used in service mode")
+		}
+
+		for _, rc := range config.Routes {
+			if _, err := parseRoute(rc); err != nil {
+				return err
+			}
+
+			if rc.Channel != "" && config.NATSHeaders {
+				return fmt.Errorf("routes to streaming channels can't be used with NATS headers")
+			}
+		}
+	}
+
+	if config.PriorityHeader != "" || config.PersistenceHeader != "" {
+		if config.Type != conf.NATS2Queue && config.Type != conf.NATS2Topic {
+			return fmt.Errorf("priority and persistence headers are only supported by NATS to MQ connectors")
+		}
+	}
+
+	return nil
+}
+
+// parsePriority parses an MQ priority, 0-9, or a range of priorities, like 5-9
+func parsePriority(value string) (int32, int32, error) {
+	parts := strings.SplitN(value, "-", 2)
+	min, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid priority %q", value)
+	}
+
+	max := min
+	if len(parts) == 2 {
+		max, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid priority %q", value)
+		}
+	}
+
+	if min < 0 || max > 9 || min > max {
+		return 0, 0, fmt.Errorf("invalid priority %q, priorities are 0 to 9", value)
+	}
+
+	return int32(min), int32(max), nil
+}
+
+// parsePersistence parses "persistent" or "nonpersistent", "true" and "false" are also accepted
+func parsePersistence(value string) (int32, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case conf.PersistencePersistent, "true":
+		return ibmmq.MQPER_PERSISTENT, nil
+	case conf.PersistenceNonPersistent, "false":
+		return ibmmq.MQPER_NOT_PERSISTENT, nil
+	default:
+		return 0, fmt.Errorf("invalid persistence %q", value)
+	}
+}
+
+// parseRoute checks a route config and parses its priority and persistence
+func parseRoute(config conf.RouteConfig) (route, error) {
+	r := route{
+		minPriority: 0,
+		maxPriority: 9,
+		persistence: anyPersistence,
+		config:      config,
+	}
+
+	var err error
+
+	if config.Priority != "" {
+		r.minPriority, r.maxPriority, err = parsePriority(config.Priority)
+		if err != nil {
+			return r, err
+		}
+	}
+
+	if config.Persistence != "" {
+		r.persistence, err = parsePersistence(config.Persistence)
+		if err != nil {
+			return r, err
+		}
+	}
+
+	if (config.Subject == "") == (config.Channel == "") {
+		return r, fmt.Errorf("a route needs a subject or a channel")
+	}
+
+	if config.JetStream && config.Subject == "" {
+		return r, fmt.Errorf("a JetStream route needs a subject")
+	}
+
+	return r, nil
+}
+
+// matches returns true if the message has a priority and persistence the route is for
+func (r *route) matches(md *ibmmq.MQMD) bool {
+	if md.Priority < r.minPriority || md.Priority > r.maxPriority {
+		return false
+	}
+	return r.persistence == anyPersistence || md.Persistence == r.persistence
+}
+
+// parseRoutes parses the connector's routes, they are checked when the connector is created
+func (mq *BridgeConnector) parseRoutes() {
+	for _, config := range mq.config.Routes {
+		if r, err := parseRoute(config); err == nil {
+			mq.routes = append(mq.routes, r)
+		}
+	}
+}
+
+// routeCallback returns the callback for the first route that matches the message, or
+// the connector's callback if none do
+func (mq *BridgeConnector) routeCallback(cb NATSCallback, md *ibmmq.MQMD) NATSCallback {
+	for i := range mq.routes {
+		r := &mq.routes[i]
+		if r.matches(md) {
+			return func(natsMsg []byte, header nats.Header, replyTo string) error {
+				return mq.publishToRoute(r, natsMsg, header, replyTo)
+			}
+		}
+	}
+	return cb
+}
+
+// publishToRoute publishes a message to the route's subject or channel, JetStream publishes use the reply
+// subject for the ack so a reply subject from MQ is dropped, and logged, for JetStream routes
+func (mq *BridgeConnector) publishToRoute(r *route, natsMsg []byte, header nats.Header, replyTo string) error {
+	if r.config.Channel != "" {
+		if mq.bridge.Stan() == nil {
+			return fmt.Errorf("bridge not configured to use NATS streaming")
+		}
+		return mq.bridge.Stan().Publish(r.config.Channel, natsMsg)
+	}
+
+	msg := &nats.Msg{
+		Subject: r.config.Subject,
+		Header:  header,
+		Data:    natsMsg,
+	}
+
+	if !r.config.JetStream {
+		msg.Reply = replyTo
+		return mq.bridge.NATS().PublishMsg(msg)
+	}
+
+	if replyTo != "" {
+		mq.Logger().Noticef("%s dropping reply subject %s, JetStream route %s can't carry one", mq.String(), replyTo, r.config.Subject)
+	}
+
+	js, err := mq.bridge.NATS().JetStream()
+	if err != nil {
+		return err
+	}
+	_, err = js.PublishMsg(msg)
+	return err
+}
+
+// applyPriorityAndPersistence sets the MQ priority and persistence from the NATS headers the connector
+// is configured to use, invalid values are logged and ignored
+func (mq *BridgeConnector) applyPriorityAndPersistence(mqmd *ibmmq.MQMD, header nats.Header) {
+	if mq.config.PriorityHeader != "" {
+		if value := header.Get(mq.config.PriorityHeader); value != "" {
+			priority, _, err := parsePriority(value)
+			if err != nil || strings.Contains(value, "-") {
+				mq.Logger().Noticef("ignoring priority header %q for %s", value, mq.String())
+			} else {
+				mqmd.Priority = priority
+			}
+		}
+	}
+
+	if mq.config.PersistenceHeader != "" {
+		if value := header.Get(mq.config.PersistenceHeader); value != "" {
+			persistence, err := parsePersistence(value)
+			if err != nil {
+				mq.Logger().Noticef("ignoring persistence header %q for %s", value, mq.String())
+			} else {
+				mqmd.Persistence = persistence
+			}
+		}
+	}
+}
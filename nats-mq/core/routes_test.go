@@ -0,0 +1,231 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nst "github.com/nats-io/nats-server/v2/test"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePriority(t *testing.T) {
+	min, max, err := parsePriority("7")
+	require.NoError(t, err)
+	require.Equal(t, int32(7), min)
+	require.Equal(t, int32(7), max)
+
+	min, max, err = parsePriority("5-9")
+	require.NoError(t, err)
+	require.Equal(t, int32(5), min)
+	require.Equal(t, int32(9), max)
+
+	for _, bad := range []string{"", "high", "10", "-1", "9-5", "3-x"} {
+		_, _, err = parsePriority(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+func TestRouteMatches(t *testing.T) {
+	r, err := parseRoute(conf.RouteConfig{Priority: "5-9", Persistence: "persistent", Subject: "urgent"})
+	require.NoError(t, err)
+
+	require.True(t, r.matches(&ibmmq.MQMD{Priority: 5, Persistence: ibmmq.MQPER_PERSISTENT}))
+	require.False(t, r.matches(&ibmmq.MQMD{Priority: 4, Persistence: ibmmq.MQPER_PERSISTENT}))
+	require.False(t, r.matches(&ibmmq.MQMD{Priority: 9, Persistence: ibmmq.MQPER_NOT_PERSISTENT}))
+
+	r, err = parseRoute(conf.RouteConfig{Channel: "all"})
+	require.NoError(t, err)
+	require.True(t, r.matches(&ibmmq.MQMD{Priority: 0, Persistence: ibmmq.MQPER_NOT_PERSISTENT}))
+}
+
+func TestRouteCallbackPicksTheFirstMatch(t *testing.T) {
+	mq := &BridgeConnector{}
+	mq.init(NewBridgeServer(), conf.ConnectorConfig{
+		Routes: []conf.RouteConfig{
+			{Priority: "9", Subject: "first"},
+			{Priority: "5-9", Subject: "second"},
+		},
+	}, "test")
+	require.Len(t, mq.routes, 2)
+
+	called := false
+	cb := func(natsMsg []byte, header nats.Header, replyTo string) error {
+		called = true
+		return nil
+	}
+
+	// messages that don't match a route use the connector's callback
+	err := mq.routeCallback(cb, &ibmmq.MQMD{Priority: 1})(nil, nil, "")
+	require.NoError(t, err)
+	require.True(t, called)
+}
+
+func TestJetStreamRoutesDropTheReplySubject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "core-js")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	opts := nst.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = dir
+	server := nst.RunServer(&opts)
+	defer server.Shutdown()
+
+	nc, err := nats.Connect(server.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+
+	js, err := nc.JetStream()
+	require.NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "routed", Subjects: []string{"routed"}})
+	require.NoError(t, err)
+
+	bridge := NewBridgeServer()
+	bridge.nats = nc
+
+	mq := &BridgeConnector{}
+	mq.init(bridge, conf.ConnectorConfig{
+		Routes: []conf.RouteConfig{
+			{Subject: "routed", JetStream: true},
+		},
+	}, "test")
+
+	sub, err := nc.SubscribeSync("routed")
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	err = mq.routeCallback(nil, &ibmmq.MQMD{})([]byte("hello"), nil, "reply")
+	require.NoError(t, err)
+
+	received, err := sub.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(received.Data))
+	require.NotEqual(t, "reply", received.Reply)
+
+	info, err := js.StreamInfo("routed")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), info.State.Msgs)
+}
+
+func TestRouteConfigIsValidated(t *testing.T) {
+	configs := []conf.ConnectorConfig{
+		{Type: "NATS2Queue", Subject: "test", Queue: "DEV.QUEUE.1", Routes: []conf.RouteConfig{{Subject: "a"}}},
+		{Type: "Queue2NATS", Subject: "test", Queue: "DEV.QUEUE.1", Routes: []conf.RouteConfig{{Priority: "high", Subject: "a"}}},
+		{Type: "Queue2NATS", Subject: "test", Queue: "DEV.QUEUE.1", Routes: []conf.RouteConfig{{Persistence: "maybe", Subject: "a"}}},
+		{Type: "Queue2NATS", Subject: "test", Queue: "DEV.QUEUE.1", Routes: []conf.RouteConfig{{Subject: "a", Channel: "b"}}},
+		{Type: "Queue2NATS", Subject: "test", Queue: "DEV.QUEUE.1", Routes: []conf.RouteConfig{{Channel: "b", JetStream: true}}},
+		{Type: "Queue2NATS", Subject: "test", Queue: "DEV.QUEUE.1", NATSHeaders: true, Routes: []conf.RouteConfig{{Channel: "b"}}},
+		{Type: "Queue2NATS", Subject: "test", Queue: "DEV.QUEUE.1", PriorityHeader: "priority"},
+	}
+
+	for _, config := range configs {
+		_, err := CreateConnector(config, &BridgeServer{})
+		require.Error(t, err)
+	}
+}
+
+func TestHighPriorityMessagesAreRouted(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:           "Queue2NATS",
+			Subject:        subject,
+			Queue:          queue,
+			ExcludeHeaders: true,
+			Routes: []conf.RouteConfig{
+				{Priority: "7-9", Subject: "urgent"},
+			},
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	received := make(chan *nats.Msg, 2)
+
+	sub, err := tbs.NC.Subscribe(">", func(m *nats.Msg) {
+		received <- m
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	mqmd := ibmmq.NewMQMD()
+	mqmd.Priority = 9
+	err = tbs.PutMessageOnQueue(queue, mqmd, []byte("urgent"))
+	require.NoError(t, err)
+
+	mqmd = ibmmq.NewMQMD()
+	mqmd.Priority = 1
+	err = tbs.PutMessageOnQueue(queue, mqmd, []byte("normal"))
+	require.NoError(t, err)
+
+	subjects := map[string]string{}
+	for i := 0; i < 2; i++ {
+		select {
+		case m := <-received:
+			subjects[string(m.Data)] = m.Subject
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for the messages")
+		}
+	}
+
+	require.Equal(t, "urgent", subjects["urgent"])
+	require.Equal(t, subject, subjects["normal"])
+}
+
+func TestPriorityAndPersistenceFromNATSHeaders(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:              "NATS2Queue",
+			Subject:           subject,
+			Queue:             queue,
+			ExcludeHeaders:    true,
+			PriorityHeader:    "Priority",
+			PersistenceHeader: "Persistence",
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	msg := nats.NewMsg(subject)
+	msg.Data = []byte("hello")
+	msg.Header.Set("Priority", "8")
+	msg.Header.Set("Persistence", "persistent")
+	err = tbs.NC.PublishMsg(msg)
+	require.NoError(t, err)
+
+	mqmd, _, data, err := tbs.GetMessageFromQueue(queue, 5000)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+	require.Equal(t, int32(8), mqmd.Priority)
+	require.Equal(t, ibmmq.MQPER_PERSISTENT, mqmd.Persistence)
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
+)
+
+// DefaultServiceTimeout is the time, in milliseconds, to wait for a NATS service response if no timeout is configured
+const DefaultServiceTimeout = 30000
+
+// validateService checks that service mode is on a queue to NATS connector that publishes whole messages
+func validateService(config conf.ConnectorConfig) error {
+	if !config.Service {
+		return nil
+	}
+
+	if config.Type != conf.Queue2NATS {
+		return fmt.Errorf("service mode is only supported by queue to NATS connectors")
+	}
+
+	if config.MessageGroups != "" || config.Chunking || config.ObjectStore {
+		return fmt.Errorf("service mode can't be used with message groups, chunking or an object store")
+	}
+
+	if config.ServiceTimeout < 0 {
+		return fmt.Errorf("service timeout can't be negative")
+	}
+
+	return nil
+}
+
+// createServiceCallback returns the MQ callback for queue to NATS connectors in service mode, each MQ message
+// is sent as a NATS request and the response is put to the message's reply queue in the same unit of work
+func (mq *BridgeConnector) createServiceCallback(conn Connector) ibmmq.MQCB_FUNCTION {
+	return func(qMgr *ibmmq.MQQueueManager, hObj *ibmmq.MQObject, md *ibmmq.MQMD, gmo *ibmmq.MQGMO, buffer []byte, cbc *ibmmq.MQCBC, mqErr *ibmmq.MQReturn) {
+		mq.Lock()
+		defer mq.Unlock()
+		start := time.Now()
+
+		if !mq.checkMQCallback(conn, hObj, md, cbc, mqErr) {
+			return
+		}
+
+		bufferLen := len(buffer)
+		mq.stats.AddMessageIn(int64(bufferLen))
+		mq.recordMQLatency(md, gmo, start)
+
+		span := mq.startMQSpan(&gmo.MsgHandle, start)
+		defer span.End()
+
+		qmgrFlag := mq.qMgr
+
+		if mq.config.ExcludeHeaders {
+			qmgrFlag = nil
+		}
+
+		var natsMsg []byte
+		var header nats.Header
+		var err error
+
+		convertStart := time.Now()
+
+		if mq.config.NATSHeaders {
+			natsMsg, header, _, err = mq.bridge.MQToNATSHeaders(md, gmo.MsgHandle, buffer, bufferLen, mq.messageOptions())
+		} else {
+			natsMsg, _, err = mq.bridge.MQToNATSMessageWithOptions(md, gmo.MsgHandle, buffer, bufferLen, qmgrFlag, mq.messageOptions())
+		}
+
+		span.Step("convert", convertStart, err)
+
+		if err != nil {
+			mq.messageLogger(bufferLen, err).Noticef("message conversion failure %s, %s", mq.String(), err.Error())
+			mq.stats.AddConversionError(err)
+			mq.handleUndelivered(conn, md, buffer)
+			return
+		}
+
+		request := &nats.Msg{
+			Subject: mq.config.Subject,
+			Header:  withTraceContext(header, span.Context()),
+			Data:    natsMsg,
+		}
+
+		requestStart := time.Now()
+
+		// without a reply queue there is no one to answer, so the message is published
+		if md.ReplyToQ == "" {
+			err = mq.bridge.NATS().PublishMsg(request)
+			span.Step("publish", requestStart, err)
+		} else {
+			err = mq.callService(request, md)
+			span.Step("request", requestStart, err)
+		}
+
+		if err != nil {
+			mq.messageLogger(bufferLen, err).Noticef("service call failure for %s, %s", mq.String(), err.Error())
+			mq.stats.AddPublishError(err)
+			mq.handleUndelivered(conn, md, buffer)
+			return
+		}
+
+		mq.sendDeliveryReports(md, buffer)
+
+		commitStart := time.Now()
+		err = mq.qMgr.Cmit()
+		span.Step("commit", commitStart, err)
+
+		if err != nil {
+			mq.messageLogger(bufferLen, err).Noticef("failed to commit, %s", err.Error())
+			mq.stats.AddCommitError(err)
+			go mq.bridge.ConnectorError(conn, err) // run in a go routine so we can finish this method and unlock
+			return
+		}
+
+		mq.stats.AddMessageOut(int64(len(natsMsg)))
+		mq.stats.AddRequestTime(time.Since(start))
+	}
+}
+
+// callService sends the request to NATS and puts the response, or the timeout reply, to the request's reply queue
+// an error is returned if the message should be backed out - expects the lock to be held
+func (mq *BridgeConnector) callService(request *nats.Msg, md *ibmmq.MQMD) error {
+	timeout := mq.config.ServiceTimeout
+	if timeout == 0 {
+		timeout = DefaultServiceTimeout
+	}
+
+	response, err := mq.bridge.NATS().RequestMsg(request, time.Duration(timeout)*time.Millisecond)
+
+	if err == nats.ErrTimeout || err == nats.ErrNoResponders {
+		if mq.config.ServiceTimeoutReply == "" {
+			return err
+		}
+		mq.Logger().Tracef("%s putting the timeout reply for %x, %s", mq.String(), md.MsgId, err.Error())
+		replyMD := ibmmq.NewMQMD()
+		replyMD.Format = ibmmq.MQFMT_STRING
+		return mq.putReply(md, replyMD, EmptyHandle, []byte(mq.config.ServiceTimeoutReply))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	qmgrFlag := mq.qMgr
+
+	if mq.config.ExcludeHeaders {
+		qmgrFlag = nil
+	}
+
+	var replyMD *ibmmq.MQMD
+	var handle ibmmq.MQMessageHandle
+	var body []byte
+
+	if mq.config.NATSHeaders {
+		replyMD, handle, body, err = mq.bridge.NATSHeadersToMQMessage(response.Data, response.Header, "", mq.qMgr, MessageOptions{})
+	} else {
+		replyMD, handle, body, err = mq.bridge.NATSToMQMessageWithOptions(response.Data, "", qmgrFlag, MessageOptions{Encoding: mq.config.Encoding})
+	}
+
+	if err != nil {
+		return fmt.Errorf("response conversion failure, %s", err.Error())
+	}
+
+	return mq.putReply(md, replyMD, handle, body)
+}
+
+// putReply puts a reply to the request's reply queue, under syncpoint - expects the lock to be held
+func (mq *BridgeConnector) putReply(request *ibmmq.MQMD, reply *ibmmq.MQMD, handle ibmmq.MQMessageHandle, body []byte) error {
+	reply.MsgType = ibmmq.MQMT_REPLY
+	reply.Persistence = ibmmq.MQPER_PERSISTENCE_AS_Q_DEF // the response header's persistence isn't used
+	return mq.putToReplyQueue(request, reply, handle, body)
+}
+
+// putToReplyQueue puts a reply or report to the original message's reply queue, under syncpoint, the MsgId
+// and CorrelId follow the original message's report options, by default the CorrelId is its MsgId
+// expects the lock to be held
+func (mq *BridgeConnector) putToReplyQueue(original *ibmmq.MQMD, reply *ibmmq.MQMD, handle ibmmq.MQMessageHandle, body []byte) error {
+	reply.CorrelId = original.MsgId
+
+	if original.Report&ibmmq.MQRO_PASS_CORREL_ID != 0 {
+		reply.CorrelId = original.CorrelId
+	}
+
+	if original.Report&ibmmq.MQRO_PASS_MSG_ID != 0 {
+		reply.MsgId = original.MsgId
+	}
+
+	mqod := ibmmq.NewMQOD()
+	mqod.ObjectType = ibmmq.MQOT_Q
+	mqod.ObjectName = original.ReplyToQ
+	mqod.ObjectQMgrName = original.ReplyToQMgr
+
+	pmo := ibmmq.NewMQPMO()
+	pmo.Options = ibmmq.MQPMO_SYNCPOINT
+	pmo.Options |= ibmmq.MQPMO_FAIL_IF_QUIESCING
+	pmo.OriginalMsgHandle = handle
+
+	return mq.qMgr.Put1(mqod, reply, pmo, body)
+}
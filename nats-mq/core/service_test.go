@@ -0,0 +1,136 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMQRequestToNATSService(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+	replyQueue := "DEV.QUEUE.2"
+	msg := "hello world"
+	response := "goodbye"
+	id := bytes.Repeat([]byte{1}, int(ibmmq.MQ_MSG_ID_LENGTH))
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:           "Queue2NATS",
+			Subject:        subject,
+			Queue:          queue,
+			ExcludeHeaders: true,
+			Service:        true,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	sub, err := tbs.NC.Subscribe(subject, func(m *nats.Msg) {
+		if string(m.Data) == msg {
+			m.Respond([]byte(response))
+		}
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	mqmd := ibmmq.NewMQMD()
+	mqmd.MsgType = ibmmq.MQMT_REQUEST
+	mqmd.MsgId = id
+	mqmd.ReplyToQ = replyQueue
+	err = tbs.PutMessageOnQueue(queue, mqmd, []byte(msg))
+	require.NoError(t, err)
+
+	replyMD, _, data, err := tbs.GetMessageFromQueue(replyQueue, 5000)
+	require.NoError(t, err)
+	require.Equal(t, response, string(data))
+	require.Equal(t, id, replyMD.CorrelId)
+	require.Equal(t, ibmmq.MQMT_REPLY, replyMD.MsgType)
+
+	stats := tbs.Bridge.SafeStats()
+	connStats := stats.Connections[0]
+	require.Equal(t, int64(1), connStats.MessagesIn)
+	require.Equal(t, int64(1), connStats.MessagesOut)
+}
+
+func TestMQRequestToNATSServiceTimeoutReply(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+	replyQueue := "DEV.QUEUE.2"
+	id := bytes.Repeat([]byte{1}, int(ibmmq.MQ_MSG_ID_LENGTH))
+	corr := bytes.Repeat([]byte{2}, int(ibmmq.MQ_CORREL_ID_LENGTH))
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:                "Queue2NATS",
+			Subject:             subject,
+			Queue:               queue,
+			ExcludeHeaders:      true,
+			Service:             true,
+			ServiceTimeout:      100,
+			ServiceTimeoutReply: "timeout",
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	mqmd := ibmmq.NewMQMD()
+	mqmd.MsgType = ibmmq.MQMT_REQUEST
+	mqmd.MsgId = id
+	mqmd.CorrelId = corr
+	mqmd.Report = ibmmq.MQRO_PASS_CORREL_ID
+	mqmd.ReplyToQ = replyQueue
+	err = tbs.PutMessageOnQueue(queue, mqmd, []byte("hello"))
+	require.NoError(t, err)
+
+	replyMD, _, data, err := tbs.GetMessageFromQueue(replyQueue, 5000)
+	require.NoError(t, err)
+	require.Equal(t, "timeout", string(data))
+	require.Equal(t, corr, replyMD.CorrelId)
+}
+
+func TestServiceConfigIsValidated(t *testing.T) {
+	config := conf.ConnectorConfig{
+		Type:    "NATS2Queue",
+		Subject: "test",
+		Queue:   "DEV.QUEUE.1",
+		Service: true,
+	}
+
+	_, err := CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+
+	config = conf.ConnectorConfig{
+		Type:     "Queue2NATS",
+		Subject:  "test",
+		Queue:    "DEV.QUEUE.1",
+		Service:  true,
+		Chunking: true,
+	}
+
+	_, err = CreateConnector(config, &BridgeServer{})
+	require.Error(t, err)
+}
@@ -48,7 +48,7 @@ func (mq *Stan2QueueConnector) Start() error {
 		return fmt.Errorf("%s connector requires nats streaming to be available", mq.String())
 	}
 
-	mq.bridge.Logger().Tracef("starting connection %s", mq.String())
+	mq.Logger().Tracef("starting connection %s", mq.String())
 
 	err := mq.connectToMQ()
 	if err != nil {
@@ -56,7 +56,7 @@ func (mq *Stan2QueueConnector) Start() error {
 	}
 
 	// Create the Object Descriptor that allows us to give the queue name
-	qObject, err := mq.connectToQueue(mq.config.Queue, ibmmq.MQOO_OUTPUT)
+	qObject, err := mq.connectToQueue(mq.config.Queue, mq.outputOptions())
 	if err != nil {
 		return err
 	}
@@ -69,9 +69,11 @@ func (mq *Stan2QueueConnector) Start() error {
 	}
 	mq.sub = sub
 
+	mq.startBacklogMonitor()
+	mq.startChunkExpiry()
 	mq.stats.AddConnect()
-	mq.bridge.Logger().Tracef("opened and reading %s", mq.config.Queue)
-	mq.bridge.Logger().Noticef("started connection %s", mq.String())
+	mq.Logger().Tracef("opened and reading %s", mq.config.Queue)
+	mq.Logger().Noticef("started connection %s", mq.String())
 
 	return nil
 }
@@ -81,8 +83,10 @@ func (mq *Stan2QueueConnector) Shutdown() error {
 	mq.Lock()
 	defer mq.Unlock()
 	mq.stats.AddDisconnect()
+	mq.stopBacklogMonitor()
+	mq.stopChunkExpiry()
 
-	mq.bridge.Logger().Noticef("shutting down connection %s", mq.String())
+	mq.Logger().Noticef("shutting down connection %s", mq.String())
 
 	if mq.sub != nil && mq.config.DurableName == "" { // Don't unsubscribe from durables
 		mq.sub.Unsubscribe()
@@ -101,7 +105,7 @@ func (mq *Stan2QueueConnector) Shutdown() error {
 	if mq.qMgr != nil {
 		_ = mq.qMgr.Disc()
 		mq.qMgr = nil
-		mq.bridge.Logger().Tracef("disconnected from queue manager for %s", mq.String())
+		mq.Logger().Tracef("disconnected from queue manager for %s", mq.String())
 	}
 	return err // ignore the disconnect error
 }
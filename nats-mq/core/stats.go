@@ -31,28 +31,69 @@ type BridgeStats struct {
 
 // ConnectorStats captures the statistics for a single connector
 type ConnectorStats struct {
-	Name          string  `json:"name"`
-	ID            string  `json:"id"`
-	Connected     bool    `json:"connected"`
-	Connects      int64   `json:"connects"`
-	Disconnects   int64   `json:"disconnects"`
-	BytesIn       int64   `json:"bytes_in"`
-	BytesOut      int64   `json:"bytes_out"`
-	MessagesIn    int64   `json:"msg_in"`
-	MessagesOut   int64   `json:"msg_out"`
-	RequestCount  int64   `json:"count"`
-	MovingAverage float64 `json:"rma"`
-	Quintile50    float64 `json:"q50"`
-	Quintile75    float64 `json:"q75"`
-	Quintile90    float64 `json:"q90"`
-	Quintile95    float64 `json:"q95"`
-	histogram     *Histogram
+	Name             string  `json:"name"`
+	ID               string  `json:"id"`
+	Type             string  `json:"type"`
+	Connected        bool    `json:"connected"`
+	Connects         int64   `json:"connects"`
+	Disconnects      int64   `json:"disconnects"`
+	BytesIn          int64   `json:"bytes_in"`
+	BytesOut         int64   `json:"bytes_out"`
+	MessagesIn       int64   `json:"msg_in"`
+	MessagesOut      int64   `json:"msg_out"`
+	RequestTimeouts  int64   `json:"request_timeouts"`
+	OrphanedReplies  int64   `json:"orphaned_replies"`
+	Expired          int64   `json:"expired"`
+	Duplicates       int64   `json:"duplicates"`
+	ConversionErrors int64   `json:"conversion_errors"`
+	PublishErrors    int64   `json:"publish_errors"`
+	PutErrors        int64   `json:"put_errors"`
+	CommitErrors     int64   `json:"commit_errors"`
+	Backouts         int64   `json:"backouts"`
+	LastError        string  `json:"last_error,omitempty"`
+	LastErrorTime    int64   `json:"last_error_time,omitempty"`
+	QueueDepth       int64   `json:"queue_depth"`
+	OldestMessageAge int64   `json:"oldest_msg_age"` // milliseconds
+	ChannelSequence  uint64  `json:"channel_sequence"`
+	AckedSequence    uint64  `json:"acked_sequence"`
+	ChannelLag       int64   `json:"channel_lag"`
+	BacklogWarning   string  `json:"backlog_warning,omitempty"`
+	RequestCount     int64   `json:"count"`
+	MovingAverage    float64 `json:"rma"`
+	Quintile50       float64 `json:"q50"`
+	Quintile75       float64 `json:"q75"`
+	Quintile90       float64 `json:"q90"`
+	Quintile95       float64 `json:"q95"`
+	histogram        *Histogram
+
+	// source latency is the time from the MQ put, or the streaming publish, to the arrival at the bridge
+	LatencyCount      int64   `json:"latency_count"`
+	LatencyQuintile50 float64 `json:"latency_q50"`
+	LatencyQuintile75 float64 `json:"latency_q75"`
+	LatencyQuintile90 float64 `json:"latency_q90"`
+	LatencyQuintile95 float64 `json:"latency_q95"`
+	latencyHistogram  *Histogram
+	latencyBuckets    [len(LatencyBuckets)]int64 // latency counts by bucket, not cumulative
+	latencySeconds    float64                    // the sum of the latencies
+
+	Windows []WindowStats `json:"windows"` // rates and quantiles over the StatsWindows, the fields above cover the whole uptime
+	window  *slidingWindow
+
+	requestBuckets [len(RequestTimeBuckets)]int64 // request counts by bucket, not cumulative
+	requestSeconds float64                        // the sum of the request times
+
+	monitorsBacklog bool // true if the backlog fields are updated
 }
 
+// RequestTimeBuckets are the upper bounds, in seconds, of the request time histogram published for Prometheus
+var RequestTimeBuckets = [...]float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
 // NewConnectorStats creates an empty stats, and initializes the request time histogram
 func NewConnectorStats() ConnectorStats {
 	return ConnectorStats{
-		histogram: NewHistogram(60),
+		histogram:        NewHistogram(60),
+		latencyHistogram: NewHistogram(60),
+		window:           newSlidingWindow(time.Now()),
 	}
 }
 
@@ -60,12 +101,87 @@ func NewConnectorStats() ConnectorStats {
 func (stats *ConnectorStats) AddMessageIn(bytes int64) {
 	stats.MessagesIn++
 	stats.BytesIn += bytes
+	if stats.window != nil {
+		stats.window.addMessageIn(bytes, time.Now())
+	}
 }
 
 // AddMessageOut updates the messages out and bytes out fields
 func (stats *ConnectorStats) AddMessageOut(bytes int64) {
 	stats.MessagesOut++
 	stats.BytesOut += bytes
+	if stats.window != nil {
+		stats.window.addMessageOut(bytes, time.Now())
+	}
+}
+
+// AddRequestTimeout updates the request timeouts field, for requests that didn't get an MQ reply in time
+func (stats *ConnectorStats) AddRequestTimeout() {
+	stats.RequestTimeouts++
+}
+
+// AddOrphanedReply updates the orphaned replies field, for MQ replies that don't match a pending request
+func (stats *ConnectorStats) AddOrphanedReply() {
+	stats.OrphanedReplies++
+}
+
+// AddExpired updates the expired field, for messages that expired before they could be put to MQ
+func (stats *ConnectorStats) AddExpired() {
+	stats.Expired++
+}
+
+// AddDuplicate updates the duplicates field, for messages dropped because they were already put to MQ
+func (stats *ConnectorStats) AddDuplicate() {
+	stats.Duplicates++
+}
+
+// AddConversionError updates the conversion errors field, for messages that couldn't be converted for the destination
+func (stats *ConnectorStats) AddConversionError(err error) {
+	stats.ConversionErrors++
+	stats.setLastError(err)
+}
+
+// AddPublishError updates the publish errors field, for messages from MQ that couldn't be published to NATS or stan
+func (stats *ConnectorStats) AddPublishError(err error) {
+	stats.PublishErrors++
+	stats.setLastError(err)
+}
+
+// AddPutError updates the put errors field, for messages from NATS or stan that couldn't be put to MQ
+func (stats *ConnectorStats) AddPutError(err error) {
+	stats.PutErrors++
+	stats.setLastError(err)
+}
+
+// AddCommitError updates the commit errors field, for MQ units of work that couldn't be committed
+func (stats *ConnectorStats) AddCommitError(err error) {
+	stats.CommitErrors++
+	stats.setLastError(err)
+}
+
+// AddBackout updates the backouts field, for MQ units of work that were backed out so the messages are read again
+func (stats *ConnectorStats) AddBackout() {
+	stats.Backouts++
+}
+
+// setLastError records the error and the time, as Unix seconds, it happened
+func (stats *ConnectorStats) setLastError(err error) {
+	if err == nil {
+		return
+	}
+	stats.LastError = err.Error()
+	stats.LastErrorTime = time.Now().Unix()
+}
+
+// setBacklog updates the backlog fields from a check of the source, the lag is the messages on the channel after the last ack
+func (stats *ConnectorStats) setBacklog(current backlog) {
+	stats.QueueDepth = current.queueDepth
+	stats.OldestMessageAge = current.oldestMessageAge
+	stats.ChannelSequence = current.channelSequence
+	stats.ChannelLag = 0
+	if stats.ChannelSequence > stats.AckedSequence {
+		stats.ChannelLag = int64(stats.ChannelSequence - stats.AckedSequence)
+	}
 }
 
 // AddDisconnect updates the disconnects field
@@ -87,6 +203,34 @@ func (stats *ConnectorStats) AddRequestTime(reqTime time.Duration) {
 	stats.RequestCount++
 	stats.MovingAverage = ((float64(stats.RequestCount-1) * stats.MovingAverage) + reqns) / float64(stats.RequestCount)
 	stats.histogram.Add(reqns)
+
+	seconds := reqTime.Seconds()
+	stats.requestSeconds += seconds
+	for i, bound := range RequestTimeBuckets {
+		if seconds <= bound {
+			stats.requestBuckets[i]++
+			break
+		}
+	}
+
+	if stats.window != nil {
+		stats.window.addRequestTime(seconds, time.Now())
+	}
+}
+
+// AddSourceLatency registers the time from the MQ put, or streaming publish, to the arrival of a message
+func (stats *ConnectorStats) AddSourceLatency(latency time.Duration) {
+	stats.LatencyCount++
+	stats.latencyHistogram.Add(float64(latency.Nanoseconds()))
+
+	seconds := latency.Seconds()
+	stats.latencySeconds += seconds
+	for i, bound := range LatencyBuckets {
+		if seconds <= bound {
+			stats.latencyBuckets[i]++
+			break
+		}
+	}
 }
 
 // UpdateQuintiles updates the quantile fields, these are not updated on each request
@@ -96,4 +240,19 @@ func (stats *ConnectorStats) UpdateQuintiles() {
 	stats.Quintile75 = stats.histogram.Quantile(0.75)
 	stats.Quintile90 = stats.histogram.Quantile(0.9)
 	stats.Quintile95 = stats.histogram.Quantile(0.95)
+
+	if stats.LatencyCount > 0 {
+		stats.LatencyQuintile50 = stats.latencyHistogram.Quantile(0.5)
+		stats.LatencyQuintile75 = stats.latencyHistogram.Quantile(0.75)
+		stats.LatencyQuintile90 = stats.latencyHistogram.Quantile(0.9)
+		stats.LatencyQuintile95 = stats.latencyHistogram.Quantile(0.95)
+	}
+}
+
+// UpdateWindows updates the windows field from the sliding window, like the quantiles these are not
+// updated on each request
+func (stats *ConnectorStats) UpdateWindows(now time.Time) {
+	if stats.window != nil {
+		stats.Windows = stats.window.summarize(now)
+	}
 }
@@ -17,6 +17,7 @@
 package core
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -68,3 +69,23 @@ func TestRequestTimes(t *testing.T) {
 	require.Equal(t, float64(dur.Nanoseconds()), stats.MovingAverage)
 	require.Equal(t, int64(1), stats.RequestCount)
 }
+
+func TestErrorCounts(t *testing.T) {
+	stats := NewConnectorStats()
+	start := time.Now().Unix()
+
+	stats.AddConversionError(fmt.Errorf("bad message"))
+	stats.AddPublishError(fmt.Errorf("no nats"))
+	stats.AddPutError(fmt.Errorf("queue full"))
+	stats.AddPutError(fmt.Errorf("queue still full"))
+	stats.AddCommitError(fmt.Errorf("no mq"))
+	stats.AddBackout()
+
+	require.Equal(t, int64(1), stats.ConversionErrors)
+	require.Equal(t, int64(1), stats.PublishErrors)
+	require.Equal(t, int64(2), stats.PutErrors)
+	require.Equal(t, int64(1), stats.CommitErrors)
+	require.Equal(t, int64(1), stats.Backouts)
+	require.Equal(t, "no mq", stats.LastError)
+	require.True(t, stats.LastErrorTime >= start)
+}
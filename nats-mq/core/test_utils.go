@@ -54,6 +54,7 @@ type TestEnv struct {
 	clusterName    string
 	clientID       string // we keep this so we stay the same on reconnect
 	bridgeClientID string
+	jetStreamDir   string
 
 	Bridge *BridgeServer
 	Config *conf.BridgeConfig
@@ -194,6 +195,15 @@ func (tbs *TestEnv) StartNATSandStan(useTLS bool, port int, clusterID string, cl
 	var err error
 	opts := nst.DefaultTestOptions
 	opts.Port = port
+	opts.JetStream = true
+
+	if tbs.jetStreamDir == "" {
+		tbs.jetStreamDir, err = ioutil.TempDir("", "nats-mq-js")
+		if err != nil {
+			return err
+		}
+	}
+	opts.StoreDir = tbs.jetStreamDir
 
 	if useTLS {
 		opts.TLSCert = "../../resources/certs/server-cert.pem"
@@ -393,6 +403,39 @@ func (tbs *TestEnv) PutMessageOnQueue(qName string, mqmd *ibmmq.MQMD, msgData []
 	return tbs.QMgr.Put1(mqod, mqmd, pmo, buffer)
 }
 
+// PutGroupOnQueue puts the bodies on the queue as a single message group, in logical order, in one unit of work
+func (tbs *TestEnv) PutGroupOnQueue(qName string, bodies [][]byte) error {
+	mqod := ibmmq.NewMQOD()
+	mqod.ObjectType = ibmmq.MQOT_Q
+	mqod.ObjectName = qName
+
+	qObject, err := tbs.QMgr.Open(mqod, ibmmq.MQOO_OUTPUT)
+	if err != nil {
+		return err
+	}
+	defer qObject.Close(0)
+
+	for i, body := range bodies {
+		mqmd := ibmmq.NewMQMD()
+		mqmd.Version = ibmmq.MQMD_VERSION_2
+		mqmd.Format = ibmmq.MQFMT_STRING
+		mqmd.MsgFlags = ibmmq.MQMF_MSG_IN_GROUP
+		if i == len(bodies)-1 {
+			mqmd.MsgFlags = ibmmq.MQMF_LAST_MSG_IN_GROUP
+		}
+
+		pmo := ibmmq.NewMQPMO()
+		pmo.Options = ibmmq.MQPMO_SYNCPOINT | ibmmq.MQPMO_LOGICAL_ORDER
+
+		if err := qObject.Put(mqmd, pmo, body); err != nil {
+			tbs.QMgr.Back()
+			return err
+		}
+	}
+
+	return tbs.QMgr.Cmit()
+}
+
 // PutMessageOnTopic uses the test environments extra connection to talk to the topic, bypassing the bridge's connection
 func (tbs *TestEnv) PutMessageOnTopic(topicName string, mqmd *ibmmq.MQMD, msgData []byte) error {
 	mqod := ibmmq.NewMQOD()
@@ -435,6 +478,10 @@ func (tbs *TestEnv) Close() {
 	if tbs.GNATSD != nil {
 		tbs.GNATSD.Shutdown()
 	}
+
+	if tbs.jetStreamDir != "" {
+		os.RemoveAll(tbs.jetStreamDir)
+	}
 }
 
 // MQTestServer is based on - https://ericchiang.github.io/post/testing-dbs-with-docker/
@@ -48,7 +48,7 @@ func (mq *Topic2StanConnector) Start() error {
 		return fmt.Errorf("%s connector requires nats streaming to be available", mq.String())
 	}
 
-	mq.bridge.Logger().Tracef("starting connection %s", mq.String())
+	mq.Logger().Tracef("starting connection %s", mq.String())
 
 	err := mq.connectToMQ()
 	if err != nil {
@@ -63,7 +63,7 @@ func (mq *Topic2StanConnector) Start() error {
 	mq.topic = topic
 	mq.sub = sub
 
-	mq.bridge.Logger().Tracef("subscribed to %s", mq.config.Topic)
+	mq.Logger().Tracef("subscribed to %s", mq.config.Topic)
 
 	cb, err := mq.setUpListener(mq.topic, mq.stanMessageHandler, mq)
 	if err != nil {
@@ -72,8 +72,8 @@ func (mq *Topic2StanConnector) Start() error {
 	mq.shutdownCB = cb
 
 	mq.stats.AddConnect()
-	mq.bridge.Logger().Tracef("opened and subscribed to %s", mq.config.Topic)
-	mq.bridge.Logger().Noticef("started connection %s", mq.String())
+	mq.Logger().Tracef("opened and subscribed to %s", mq.config.Topic)
+	mq.Logger().Noticef("started connection %s", mq.String())
 
 	return nil
 }
@@ -89,7 +89,7 @@ func (mq *Topic2StanConnector) Shutdown() error {
 		return nil
 	}
 
-	mq.bridge.Logger().Noticef("shutting down connection %s", mq.String())
+	mq.Logger().Noticef("shutting down connection %s", mq.String())
 
 	sub := mq.sub
 	topic := mq.topic
@@ -98,30 +98,30 @@ func (mq *Topic2StanConnector) Shutdown() error {
 
 	if mq.shutdownCB != nil {
 		if err := mq.shutdownCB(); err != nil {
-			mq.bridge.Logger().Noticef("error stopping listener for %s, %s", mq.String(), err.Error())
+			mq.Logger().Noticef("error stopping listener for %s, %s", mq.String(), err.Error())
 		}
 		mq.shutdownCB = nil
 	}
 
 	if sub != nil {
 		if err := sub.Close(0); err != nil {
-			mq.bridge.Logger().Noticef("error closing subscription for %s", mq.String())
+			mq.Logger().Noticef("error closing subscription for %s", mq.String())
 		}
 	}
 
 	if topic != nil {
 		if err := topic.Close(0); err != nil {
-			mq.bridge.Logger().Noticef("error closing topic for %s", mq.String())
+			mq.Logger().Noticef("error closing topic for %s", mq.String())
 		}
 	}
 
 	if mq.qMgr != nil {
-		mq.bridge.Logger().Noticef("shutting down qmgr")
+		mq.Logger().Noticef("shutting down qmgr")
 		if err := mq.qMgr.Disc(); err != nil {
-			mq.bridge.Logger().Noticef("error disconnecting from queue manager for %s, %s", mq.String(), err.Error())
+			mq.Logger().Noticef("error disconnecting from queue manager for %s, %s", mq.String(), err.Error())
 		}
 		mq.qMgr = nil
-		mq.bridge.Logger().Tracef("disconnected from queue manager for %s", mq.String())
+		mq.Logger().Tracef("disconnected from queue manager for %s", mq.String())
 	}
 
 	return nil
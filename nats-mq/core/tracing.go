@@ -0,0 +1,142 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"time"
+
+	"github.com/ibm-messaging/mq-golang/ibmmq"
+	"github.com/nats-io/nats-mq/nats-mq/tracing"
+	nats "github.com/nats-io/nats.go"
+)
+
+// startMQSpan starts the span for a message from MQ, with the trace context in its properties as the parent,
+// the span's context replaces the properties so it is the parent of the NATS message - expects the lock to be held
+func (mq *BridgeConnector) startMQSpan(handle *ibmmq.MQMessageHandle, start time.Time) *tracing.Span {
+	span := mq.bridge.tracer.Start(mq.String(), tracing.SpanKindConsumer, traceFromHandle(*handle), start)
+
+	if span.IsRecording() {
+		mq.setSpanAttributes(span)
+		if err := traceToHandle(handle, span.Context()); err != nil {
+			mq.Logger().Noticef("failed to set the trace context for %s, %s", mq.String(), err.Error())
+		}
+	}
+
+	return span
+}
+
+// startNATSSpan starts the span for a message from NATS or streaming, the parent is the trace context in the
+// NATS headers, or in the properties of the converted message - expects the lock to be held
+func (mq *BridgeConnector) startNATSSpan(header nats.Header, handle ibmmq.MQMessageHandle, start time.Time) *tracing.Span {
+	parent := traceFromHeader(header)
+	if !parent.IsValid() {
+		parent = traceFromHandle(handle)
+	}
+
+	span := mq.bridge.tracer.Start(mq.String(), tracing.SpanKindConsumer, parent, start)
+	if span.IsRecording() {
+		mq.setSpanAttributes(span)
+	}
+	return span
+}
+
+// traceHandle puts the span's context in the properties of the message for MQ, a handle is created if there
+// isn't one, the properties of messages with an RFH2 header are in the body so they are left alone
+func (mq *BridgeConnector) traceHandle(handle ibmmq.MQMessageHandle, span *tracing.Span) ibmmq.MQMessageHandle {
+	if !span.Context().IsValid() || mq.config.RFH2 {
+		return handle
+	}
+
+	if handle == EmptyHandle {
+		var err error
+		handle, err = mq.qMgr.CrtMH(ibmmq.NewMQCMHO())
+		if err != nil {
+			mq.Logger().Noticef("failed to set the trace context for %s, %s", mq.String(), err.Error())
+			return EmptyHandle
+		}
+	}
+
+	if err := traceToHandle(&handle, span.Context()); err != nil {
+		mq.Logger().Noticef("failed to set the trace context for %s, %s", mq.String(), err.Error())
+	}
+
+	return handle
+}
+
+func (mq *BridgeConnector) setSpanAttributes(span *tracing.Span) {
+	span.SetAttribute("nats_mq.connector.id", mq.ID())
+	span.SetAttribute("nats_mq.connector.type", mq.config.Type)
+}
+
+// traceFromHeader reads the trace context from the traceparent and tracestate NATS headers
+func traceFromHeader(header nats.Header) tracing.SpanContext {
+	sc, _ := tracing.ParseTraceParent(header.Get(tracing.TraceParent), header.Get(tracing.TraceState))
+	return sc
+}
+
+// withTraceContext adds the traceparent and tracestate headers, creating the header if it is nil
+func withTraceContext(header nats.Header, sc tracing.SpanContext) nats.Header {
+	if !sc.IsValid() {
+		return header
+	}
+	if header == nil {
+		header = nats.Header{}
+	}
+	header.Set(tracing.TraceParent, sc.TraceParent())
+	if sc.State != "" {
+		header.Set(tracing.TraceState, sc.State)
+	}
+	return header
+}
+
+// traceFromHandle reads the trace context from the traceparent and tracestate properties of an MQ message
+func traceFromHandle(handle ibmmq.MQMessageHandle) tracing.SpanContext {
+	if handle == EmptyHandle {
+		return tracing.SpanContext{}
+	}
+	sc, _ := tracing.ParseTraceParent(stringProperty(handle, tracing.TraceParent), stringProperty(handle, tracing.TraceState))
+	return sc
+}
+
+// traceToHandle sets the traceparent and tracestate properties, replacing the existing values
+func traceToHandle(handle *ibmmq.MQMessageHandle, sc tracing.SpanContext) error {
+	smpo := ibmmq.NewMQSMPO()
+	pd := ibmmq.NewMQPD()
+
+	if err := handle.SetMP(smpo, tracing.TraceParent, pd, sc.TraceParent()); err != nil {
+		return err
+	}
+
+	if sc.State == "" {
+		return nil
+	}
+
+	return handle.SetMP(smpo, tracing.TraceState, pd, sc.State)
+}
+
+// stringProperty returns the value of a property, or "" if the message doesn't have it
+func stringProperty(handle ibmmq.MQMessageHandle, name string) string {
+	impo := ibmmq.NewMQIMPO()
+	impo.Options = ibmmq.MQIMPO_CONVERT_VALUE | ibmmq.MQIMPO_INQ_FIRST
+
+	_, value, err := handle.InqMP(impo, ibmmq.NewMQPD(), name)
+	if err != nil {
+		return ""
+	}
+
+	s, _ := value.(string)
+	return s
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-mq/nats-mq/conf"
+	"github.com/nats-io/nats-mq/nats-mq/logging"
+	"github.com/nats-io/nats-mq/nats-mq/tracing"
+	nats "github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTraceContextHeaders(t *testing.T) {
+	require.False(t, traceFromHeader(nil).IsValid())
+	require.Nil(t, withTraceContext(nil, tracing.SpanContext{}))
+
+	sc, ok := tracing.ParseTraceParent(testTraceParent, "congo=t61rcWkgMzE")
+	require.True(t, ok)
+
+	header := withTraceContext(nil, sc)
+	require.Equal(t, testTraceParent, header.Get(tracing.TraceParent))
+	require.Equal(t, "congo=t61rcWkgMzE", header.Get(tracing.TraceState))
+	require.Equal(t, sc, traceFromHeader(header))
+
+	header = nats.Header{}
+	header.Set(tracing.TraceParent, "not a traceparent")
+	require.False(t, traceFromHeader(header).IsValid())
+}
+
+func TestNATSSpanIsAChildOfTheHeader(t *testing.T) {
+	var exported int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&exported, 1)
+	}))
+	defer server.Close()
+
+	tracer, err := tracing.NewTracer(tracing.Config{Endpoint: server.URL}, logging.NewNATSLogger(logging.Config{}))
+	require.NoError(t, err)
+
+	mq := &BridgeConnector{
+		config: conf.ConnectorConfig{Type: "NATS2Queue", ID: "tracing"},
+		bridge: &BridgeServer{tracer: tracer},
+		stats:  NewConnectorStats(),
+	}
+
+	header := nats.Header{}
+	header.Set(tracing.TraceParent, testTraceParent)
+	parent := traceFromHeader(header)
+
+	span := mq.startNATSSpan(header, EmptyHandle, time.Now())
+	require.True(t, span.IsRecording())
+	require.Equal(t, parent.TraceID, span.Context().TraceID)
+	require.NotEqual(t, parent.SpanID, span.Context().SpanID)
+	span.End()
+
+	tracer.Close()
+	require.Equal(t, int32(1), atomic.LoadInt32(&exported))
+}
+
+func TestTraceContextPassesThroughWithoutTracing(t *testing.T) {
+	subject := "test"
+	queue := "DEV.QUEUE.1"
+
+	connect := []conf.ConnectorConfig{
+		{
+			Type:        "NATS2Queue",
+			Subject:     subject,
+			Queue:       queue,
+			NATSHeaders: true,
+		},
+	}
+
+	tbs, err := StartTestEnvironment(connect)
+	require.NoError(t, err)
+	defer tbs.Close()
+
+	natsMsg := nats.NewMsg(subject)
+	natsMsg.Data = []byte("hello world")
+	natsMsg.Header.Set(tracing.TraceParent, testTraceParent)
+	natsMsg.Header.Set(tracing.TraceState, "congo=t61rcWkgMzE")
+
+	err = tbs.NC.PublishMsg(natsMsg)
+	require.NoError(t, err)
+
+	_, gmo, _, err := tbs.GetMessageFromQueue(queue, 5000)
+	require.NoError(t, err)
+	require.Equal(t, testTraceParent, stringProperty(gmo.MsgHandle, tracing.TraceParent))
+	require.Equal(t, "congo=t61rcWkgMzE", stringProperty(gmo.MsgHandle, tracing.TraceState))
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// windowSlotLength is the time covered by each slot in a sliding window
+const windowSlotLength = 10 * time.Second
+
+// windowSlotCount is enough slots for the longest window, plus the slot that is being filled
+const windowSlotCount = 91
+
+// StatsWindows are the windows reported in the connector stats, the longest has to fit in the slots
+var StatsWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// WindowStats are the rates and request time quantiles for a connector over a recent window
+type WindowStats struct {
+	Window          string  `json:"window"`
+	MessagesInRate  float64 `json:"msg_in_rate"` // per second
+	MessagesOutRate float64 `json:"msg_out_rate"`
+	BytesInRate     float64 `json:"bytes_in_rate"`
+	BytesOutRate    float64 `json:"bytes_out_rate"`
+	RequestCount    int64   `json:"count"`
+	Quintile50      float64 `json:"q50"`
+	Quintile75      float64 `json:"q75"`
+	Quintile90      float64 `json:"q90"`
+	Quintile95      float64 `json:"q95"`
+}
+
+// windowSlot holds the counts for one slot, the request times are counted in the RequestTimeBuckets
+// with an extra bucket for the requests that took longer
+type windowSlot struct {
+	number   int64 // the time the slot started, divided by the slot length
+	msgsIn   int64
+	msgsOut  int64
+	bytesIn  int64
+	bytesOut int64
+	requests [len(RequestTimeBuckets) + 1]int64
+}
+
+// slidingWindow is a ring of slots, stale slots are reset when they are reused so recording is constant time
+// The window is not thread safe
+type slidingWindow struct {
+	start time.Time
+	slots [windowSlotCount]windowSlot
+}
+
+func newSlidingWindow(now time.Time) *slidingWindow {
+	return &slidingWindow{
+		start: now,
+	}
+}
+
+// slot returns the slot for the time, resetting it if it holds an older slot
+func (w *slidingWindow) slot(now time.Time) *windowSlot {
+	number := now.UnixNano() / int64(windowSlotLength)
+	s := &w.slots[number%windowSlotCount]
+	if s.number != number {
+		*s = windowSlot{number: number}
+	}
+	return s
+}
+
+func (w *slidingWindow) addMessageIn(bytes int64, now time.Time) {
+	s := w.slot(now)
+	s.msgsIn++
+	s.bytesIn += bytes
+}
+
+func (w *slidingWindow) addMessageOut(bytes int64, now time.Time) {
+	s := w.slot(now)
+	s.msgsOut++
+	s.bytesOut += bytes
+}
+
+func (w *slidingWindow) addRequestTime(seconds float64, now time.Time) {
+	s := w.slot(now)
+	for i, bound := range RequestTimeBuckets {
+		if seconds <= bound {
+			s.requests[i]++
+			return
+		}
+	}
+	s.requests[len(RequestTimeBuckets)]++
+}
+
+// summarize adds up the slots in each of the StatsWindows, windows that are longer than
+// the time since the window started use the shorter time for the rates
+func (w *slidingWindow) summarize(now time.Time) []WindowStats {
+	current := now.UnixNano() / int64(windowSlotLength)
+	summaries := make([]WindowStats, 0, len(StatsWindows))
+
+	for _, length := range StatsWindows {
+		total := windowSlot{}
+		count := int64(length / windowSlotLength)
+
+		for number := current - count; number <= current; number++ {
+			s := &w.slots[number%windowSlotCount]
+			if s.number != number {
+				continue
+			}
+			total.msgsIn += s.msgsIn
+			total.msgsOut += s.msgsOut
+			total.bytesIn += s.bytesIn
+			total.bytesOut += s.bytesOut
+			for i := range s.requests {
+				total.requests[i] += s.requests[i]
+			}
+		}
+
+		// the current slot is partly filled, so the window covers the full slots before it and part of this one
+		elapsed := time.Duration(count)*windowSlotLength + time.Duration(now.UnixNano()-current*int64(windowSlotLength))
+		if age := now.Sub(w.start); age < elapsed {
+			elapsed = age
+		}
+
+		summary := WindowStats{
+			Window: fmt.Sprintf("%dm", int(length/time.Minute)),
+		}
+
+		for _, c := range total.requests {
+			summary.RequestCount += c
+		}
+
+		if seconds := elapsed.Seconds(); seconds > 0 {
+			summary.MessagesInRate = float64(total.msgsIn) / seconds
+			summary.MessagesOutRate = float64(total.msgsOut) / seconds
+			summary.BytesInRate = float64(total.bytesIn) / seconds
+			summary.BytesOutRate = float64(total.bytesOut) / seconds
+		}
+
+		summary.Quintile50 = bucketQuantile(total.requests, summary.RequestCount, 0.5)
+		summary.Quintile75 = bucketQuantile(total.requests, summary.RequestCount, 0.75)
+		summary.Quintile90 = bucketQuantile(total.requests, summary.RequestCount, 0.9)
+		summary.Quintile95 = bucketQuantile(total.requests, summary.RequestCount, 0.95)
+
+		summaries = append(summaries, summary)
+	}
+
+	return summaries
+}
+
+// bucketQuantile estimates a quantile, in nanoseconds, from request time bucket counts by interpolating
+// inside the bucket that holds it, requests over the largest bucket are reported as the largest bound
+func bucketQuantile(buckets [len(RequestTimeBuckets) + 1]int64, total int64, q float64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	rank := q * float64(total)
+	cumulative := 0.0
+	lower := 0.0
+
+	for i, bound := range RequestTimeBuckets {
+		count := float64(buckets[i])
+		if count > 0 && cumulative+count >= rank {
+			seconds := lower + (bound-lower)*(rank-cumulative)/count
+			return seconds * float64(time.Second)
+		}
+		cumulative += count
+		lower = bound
+	}
+
+	return RequestTimeBuckets[len(RequestTimeBuckets)-1] * float64(time.Second)
+}
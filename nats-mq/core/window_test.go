@@ -0,0 +1,117 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindowRates(t *testing.T) {
+	start := time.Unix(1000000, 0) // on a slot boundary
+	w := newSlidingWindow(start.Add(-time.Hour))
+
+	// 10 messages a second for 15 minutes
+	for s := 0; s < 15*60; s++ {
+		now := start.Add(time.Duration(s) * time.Second)
+		for i := 0; i < 10; i++ {
+			w.addMessageIn(100, now)
+			w.addMessageOut(50, now)
+		}
+	}
+
+	// then nothing for 2 minutes
+	summaries := w.summarize(start.Add(17 * time.Minute))
+	require.Len(t, summaries, 3)
+
+	require.Equal(t, "1m", summaries[0].Window)
+	require.Equal(t, 0.0, summaries[0].MessagesInRate)
+
+	require.Equal(t, "5m", summaries[1].Window)
+	require.InDelta(t, 10*3.0/5.0, summaries[1].MessagesInRate, 0.01)
+	require.InDelta(t, 1000*3.0/5.0, summaries[1].BytesInRate, 0.01)
+	require.InDelta(t, 500*3.0/5.0, summaries[1].BytesOutRate, 0.01)
+
+	require.Equal(t, "15m", summaries[2].Window)
+	require.InDelta(t, 10*13.0/15.0, summaries[2].MessagesOutRate, 0.01)
+}
+
+func TestWindowRatesAfterStart(t *testing.T) {
+	start := time.Unix(1000000, 0)
+	w := newSlidingWindow(start)
+
+	for s := 0; s < 30; s++ {
+		w.addMessageIn(1, start.Add(time.Duration(s)*time.Second))
+	}
+
+	// the window is younger than a minute, so the rate uses its age
+	summaries := w.summarize(start.Add(30 * time.Second))
+	require.InDelta(t, 1.0, summaries[0].MessagesInRate, 0.01)
+	require.InDelta(t, 1.0, summaries[2].MessagesInRate, 0.01)
+}
+
+func TestWindowQuantiles(t *testing.T) {
+	start := time.Unix(1000000, 0)
+	w := newSlidingWindow(start.Add(-time.Hour))
+
+	// slow requests a while ago
+	for i := 0; i < 100; i++ {
+		w.addRequestTime(2, start)
+	}
+
+	// fast requests in the last minute
+	now := start.Add(10 * time.Minute)
+	for i := 0; i < 100; i++ {
+		w.addRequestTime(0.0002, now)
+	}
+
+	summaries := w.summarize(now)
+
+	require.Equal(t, int64(100), summaries[0].RequestCount)
+	require.True(t, summaries[0].Quintile95 <= float64(500*time.Microsecond))
+
+	require.Equal(t, int64(100), summaries[1].RequestCount)
+
+	require.Equal(t, int64(200), summaries[2].RequestCount)
+	require.True(t, summaries[2].Quintile50 <= float64(500*time.Microsecond))
+	require.True(t, summaries[2].Quintile95 > float64(time.Second))
+	require.True(t, summaries[2].Quintile95 <= float64(2500*time.Millisecond))
+}
+
+func TestBucketQuantile(t *testing.T) {
+	buckets := [len(RequestTimeBuckets) + 1]int64{}
+	require.Equal(t, 0.0, bucketQuantile(buckets, 0, 0.5))
+
+	buckets[1] = 10 // between 0.5ms and 1ms
+	require.InDelta(t, float64(750*time.Microsecond), bucketQuantile(buckets, 10, 0.5), 1)
+
+	buckets[len(RequestTimeBuckets)] = 90 // over 10s
+	require.Equal(t, float64(10*time.Second), bucketQuantile(buckets, 100, 0.5))
+}
+
+func TestConnectorStatsWindows(t *testing.T) {
+	stats := NewConnectorStats()
+	stats.AddMessageIn(10)
+	stats.AddMessageOut(20)
+	stats.AddRequestTime(time.Millisecond)
+
+	stats.UpdateWindows(time.Now())
+	require.Len(t, stats.Windows, len(StatsWindows))
+	require.Equal(t, int64(1), stats.Windows[0].RequestCount)
+	require.True(t, stats.Windows[0].MessagesInRate > 0)
+}
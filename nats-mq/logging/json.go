@@ -0,0 +1,193 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JSON log levels
+const (
+	levelDebug = "debug"
+	levelTrace = "trace"
+	levelInfo  = "info"
+	levelWarn  = "warn"
+	levelError = "error"
+	levelFatal = "fatal"
+)
+
+// The standard JSON fields, they can't be replaced by a logger's fields
+const (
+	fieldTime    = "time"
+	fieldLevel   = "level"
+	fieldMessage = "msg"
+	fieldPID     = "pid"
+)
+
+// NewJSONLogger creates a logger that writes a JSON object per line, the writer is closed
+// with the logger if it is an io.Closer
+func NewJSONLogger(conf Config, out io.Writer) Logger {
+	return &JSONLogger{
+		out:   &jsonOutput{writer: out},
+		time:  conf.Time,
+		debug: conf.Debug,
+		trace: conf.Trace,
+		pid:   conf.PID,
+	}
+}
+
+// jsonOutput is shared by a logger and the loggers created with WithFields
+type jsonOutput struct {
+	sync.Mutex
+	writer io.Writer
+}
+
+// JSONLogger writes log statements as JSON lines, with the time, level, message and the logger's fields
+type JSONLogger struct {
+	out    *jsonOutput
+	time   bool
+	debug  bool
+	trace  bool
+	pid    bool
+	fields Fields
+}
+
+// WithFields returns a logger that adds the fields, and this logger's fields, to each statement
+func (logger *JSONLogger) WithFields(fields Fields) Logger {
+	merged := make(Fields, len(logger.fields)+len(fields))
+	for k, v := range logger.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	withFields := *logger
+	withFields.fields = merged
+	return &withFields
+}
+
+// Close closes the writer if it is an io.Closer
+func (logger *JSONLogger) Close() error {
+	if closer, ok := logger.out.writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Debugf writes a debug statement if debug is on
+func (logger *JSONLogger) Debugf(format string, v ...interface{}) {
+	if logger.debug {
+		logger.write(levelDebug, format, v...)
+	}
+}
+
+// Errorf writes an error statement
+func (logger *JSONLogger) Errorf(format string, v ...interface{}) {
+	logger.write(levelError, format, v...)
+}
+
+// Fatalf writes a fatal statement and exits
+func (logger *JSONLogger) Fatalf(format string, v ...interface{}) {
+	logger.write(levelFatal, format, v...)
+	os.Exit(1)
+}
+
+// Noticef writes an info statement
+func (logger *JSONLogger) Noticef(format string, v ...interface{}) {
+	logger.write(levelInfo, format, v...)
+}
+
+// Tracef writes a trace statement if trace is on
+func (logger *JSONLogger) Tracef(format string, v ...interface{}) {
+	if logger.trace {
+		logger.write(levelTrace, format, v...)
+	}
+}
+
+// Warnf writes a warning statement
+func (logger *JSONLogger) Warnf(format string, v ...interface{}) {
+	logger.write(levelWarn, format, v...)
+}
+
+func (logger *JSONLogger) write(level string, format string, v ...interface{}) {
+	line := logger.encode(time.Now(), level, fmt.Sprintf(format, v...))
+
+	logger.out.Lock()
+	defer logger.out.Unlock()
+	logger.out.writer.Write(line)
+}
+
+// encode builds the JSON line, the time, level and message come first, then the fields sorted by name,
+// fields that can't be encoded are written as strings
+func (logger *JSONLogger) encode(now time.Time, level string, msg string) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	if logger.time {
+		writeField(&buf, fieldTime, now.Format(time.RFC3339Nano))
+	}
+	writeField(&buf, fieldLevel, level)
+	writeField(&buf, fieldMessage, msg)
+	if logger.pid {
+		writeField(&buf, fieldPID, os.Getpid())
+	}
+
+	keys := make([]string, 0, len(logger.fields))
+	for k := range logger.fields {
+		switch k {
+		case fieldTime, fieldLevel, fieldMessage, fieldPID:
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		writeField(&buf, k, logger.fields[k])
+	}
+
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+func writeField(buf *bytes.Buffer, key string, value interface{}) {
+	if buf.Len() > 1 {
+		buf.WriteByte(',')
+	}
+
+	encodedKey, _ := json.Marshal(key)
+	buf.Write(encodedKey)
+	buf.WriteByte(':')
+
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(encoded)
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	lines := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestJSONLevels(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := NewJSONLogger(Config{Time: true}, buf)
+
+	logger.Debugf("debug")
+	logger.Tracef("trace")
+	logger.Noticef("notice %d", 1)
+	logger.Warnf("warn")
+	logger.Errorf("error")
+
+	lines := readLines(t, buf)
+	require.Len(t, lines, 3)
+	require.Equal(t, "info", lines[0]["level"])
+	require.Equal(t, "notice 1", lines[0]["msg"])
+	require.Equal(t, "warn", lines[1]["level"])
+	require.Equal(t, "error", lines[2]["level"])
+
+	_, err := time.Parse(time.RFC3339Nano, lines[0]["time"].(string))
+	require.NoError(t, err)
+
+	buf.Reset()
+	logger = NewJSONLogger(Config{Debug: true, Trace: true}, buf)
+	logger.Debugf("debug")
+	logger.Tracef("trace")
+
+	lines = readLines(t, buf)
+	require.Len(t, lines, 2)
+	require.Equal(t, "debug", lines[0]["level"])
+	require.Equal(t, "trace", lines[1]["level"])
+	require.NotContains(t, lines[0], "time")
+	require.NoError(t, logger.Close())
+}
+
+func TestJSONFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := NewJSONLogger(Config{}, buf)
+
+	connector := logger.WithFields(Fields{"connector_id": "abc", "connector": "Queue2NATS:DEV.QUEUE.1"})
+	connector.WithFields(Fields{"size": 11, "mq_rc": int32(2033), "msg": "replaced", "err": fmt.Errorf("failed")}).Noticef("failure")
+	connector.Noticef("no message fields")
+	logger.Noticef("no fields")
+
+	lines := readLines(t, buf)
+	require.Len(t, lines, 3)
+
+	require.Equal(t, "failure", lines[0]["msg"])
+	require.Equal(t, "abc", lines[0]["connector_id"])
+	require.Equal(t, float64(11), lines[0]["size"])
+	require.Equal(t, float64(2033), lines[0]["mq_rc"])
+	require.Equal(t, "failed", lines[0]["err"])
+
+	require.Equal(t, "abc", lines[1]["connector_id"])
+	require.NotContains(t, lines[1], "size")
+	require.NotContains(t, lines[2], "connector_id")
+
+	// the standard fields come first
+	require.True(t, strings.HasPrefix(buf.String(), `{"level":"info","msg":"failure","connector":`))
+}
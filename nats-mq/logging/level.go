@@ -0,0 +1,163 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is the most verbose kind of statement a LevelLogger writes, errors and fatal statements are always written
+type Level int32
+
+// Log levels, from the least to the most verbose
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+	LevelTrace
+)
+
+var levelNames = map[Level]string{
+	LevelError: "error",
+	LevelWarn:  "warn",
+	LevelInfo:  "info",
+	LevelDebug: "debug",
+	LevelTrace: "trace",
+}
+
+// ParseLevel returns the level for a name, error, warn, info, debug or trace
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for level, n := range levelNames {
+		if n == name {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, expected error, warn, info, debug or trace", name)
+}
+
+// String returns the name of the level
+func (level Level) String() string {
+	if name, ok := levelNames[level]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int32(level))
+}
+
+// ConfigLevel returns the level for the debug and trace flags, trace includes debug
+func ConfigLevel(conf Config) Level {
+	switch {
+	case conf.Trace:
+		return LevelTrace
+	case conf.Debug:
+		return LevelDebug
+	default:
+		return LevelInfo
+	}
+}
+
+// LevelLogger filters statements by level, and prefixes them, before passing them on to a logger
+// The level can be changed while the logger is in use
+type LevelLogger struct {
+	logger Logger
+	prefix string
+	level  *int32 // shared with the loggers created by WithFields
+}
+
+// NewLevelLogger wraps a logger, which should write every level, with a level and prefix
+func NewLevelLogger(logger Logger, prefix string, level Level) *LevelLogger {
+	l := int32(level)
+	return &LevelLogger{
+		logger: logger,
+		prefix: strings.Replace(prefix, "%", "%%", -1), // the prefix is added to the format
+		level:  &l,
+	}
+}
+
+// WithLevel returns a logger with its own prefix and level that writes to the same logger as this one,
+// a nil logger returns nil
+func (logger *LevelLogger) WithLevel(prefix string, level Level) *LevelLogger {
+	if logger == nil {
+		return nil
+	}
+	return NewLevelLogger(logger.logger, prefix, level)
+}
+
+// Level returns the current level
+func (logger *LevelLogger) Level() Level {
+	return Level(atomic.LoadInt32(logger.level))
+}
+
+// SetLevel changes the level
+func (logger *LevelLogger) SetLevel(level Level) {
+	atomic.StoreInt32(logger.level, int32(level))
+}
+
+// WithFields returns a logger with the fields that shares this logger's prefix and level
+func (logger *LevelLogger) WithFields(fields Fields) Logger {
+	return &LevelLogger{
+		logger: logger.logger.WithFields(fields),
+		prefix: logger.prefix,
+		level:  logger.level,
+	}
+}
+
+// Close closes the wrapped logger
+func (logger *LevelLogger) Close() error {
+	return logger.logger.Close()
+}
+
+// Debugf forwards to the wrapped logger if the level is debug or trace
+func (logger *LevelLogger) Debugf(format string, v ...interface{}) {
+	if logger.Level() >= LevelDebug {
+		logger.logger.Debugf(logger.prefix+format, v...)
+	}
+}
+
+// Errorf forwards to the wrapped logger
+func (logger *LevelLogger) Errorf(format string, v ...interface{}) {
+	logger.logger.Errorf(logger.prefix+format, v...)
+}
+
+// Fatalf forwards to the wrapped logger
+func (logger *LevelLogger) Fatalf(format string, v ...interface{}) {
+	logger.logger.Fatalf(logger.prefix+format, v...)
+}
+
+// Noticef forwards to the wrapped logger if the level is info or more verbose
+func (logger *LevelLogger) Noticef(format string, v ...interface{}) {
+	if logger.Level() >= LevelInfo {
+		logger.logger.Noticef(logger.prefix+format, v...)
+	}
+}
+
+// Tracef forwards to the wrapped logger if the level is trace
+func (logger *LevelLogger) Tracef(format string, v ...interface{}) {
+	if logger.Level() >= LevelTrace {
+		logger.logger.Tracef(logger.prefix+format, v...)
+	}
+}
+
+// Warnf forwards to the wrapped logger if the level is warn or more verbose
+func (logger *LevelLogger) Warnf(format string, v ...interface{}) {
+	if logger.Level() >= LevelWarn {
+		logger.logger.Warnf(logger.prefix+format, v...)
+	}
+}
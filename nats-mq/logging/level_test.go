@@ -0,0 +1,69 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logging
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevel(t *testing.T) {
+	for _, level := range []Level{LevelError, LevelWarn, LevelInfo, LevelDebug, LevelTrace} {
+		parsed, err := ParseLevel(level.String())
+		require.NoError(t, err)
+		require.Equal(t, level, parsed)
+	}
+
+	level, err := ParseLevel(" Trace ")
+	require.NoError(t, err)
+	require.Equal(t, LevelTrace, level)
+
+	_, err = ParseLevel("loud")
+	require.Error(t, err)
+
+	require.Equal(t, LevelInfo, ConfigLevel(Config{}))
+	require.Equal(t, LevelDebug, ConfigLevel(Config{Debug: true}))
+	require.Equal(t, LevelTrace, ConfigLevel(Config{Trace: true}))
+}
+
+func TestLevelLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	bridge := NewLevelLogger(NewTextLogger(Config{Debug: true, Trace: true}, buf), "", LevelWarn)
+	connector := bridge.WithLevel("[100%] ", LevelTrace)
+
+	bridge.Noticef("bridge notice")
+	bridge.Warnf("bridge warning")
+	bridge.Errorf("bridge error")
+	connector.WithFields(Fields{"size": 1}).Tracef("connector trace %d", 1)
+
+	require.NotContains(t, buf.String(), "bridge notice")
+	require.Contains(t, buf.String(), "[WRN] bridge warning")
+	require.Contains(t, buf.String(), "[ERR] bridge error")
+	require.Contains(t, buf.String(), "[TRC] [100%] connector trace 1")
+
+	// loggers with fields share the level
+	withFields := connector.WithFields(Fields{"size": 1})
+	connector.SetLevel(LevelError)
+	buf.Reset()
+	withFields.Warnf("connector warning")
+	require.Empty(t, buf.String())
+
+	var nilLogger *LevelLogger
+	require.Nil(t, nilLogger.WithLevel("", LevelInfo))
+}
@@ -16,15 +16,30 @@
 
 package logging
 
-// Config defines logging flags for the NATS logger
+import (
+	"fmt"
+	"os"
+)
+
+// Config defines logging flags for the NATS logger, and the format and destination of the log
 type Config struct {
 	Time   bool
 	Debug  bool
 	Trace  bool
 	Colors bool
 	PID    bool
+
+	JSON         bool   // write JSON lines instead of text
+	File         string // write to the file instead of stderr
+	MaxSize      int64  // megabytes, the file is rotated when it grows past this size, 0 turns rotation off
+	MaxBackups   int    // rotated files to keep, 0 keeps all of them
+	Syslog       bool   // write to the local syslog
+	RemoteSyslog string // write to a remote syslog, for example udp://localhost:514
 }
 
+// Fields are structured data added to log statements, only the JSON logger writes them
+type Fields map[string]interface{}
+
 // Logger interface
 type Logger interface {
 	Debugf(format string, v ...interface{})
@@ -34,5 +49,66 @@ type Logger interface {
 	Tracef(format string, v ...interface{})
 	Warnf(format string, v ...interface{})
 
+	WithFields(fields Fields) Logger
+
 	Close() error
 }
+
+// NewLogger creates the logger for the configuration, syslog, or JSON or text to a file or stderr
+func NewLogger(conf Config) (Logger, error) {
+	if err := validateConfig(conf); err != nil {
+		return nil, err
+	}
+
+	if conf.Syslog || conf.RemoteSyslog != "" {
+		return NewSysLogger(conf), nil
+	}
+
+	if conf.File == "" {
+		if conf.JSON {
+			return NewJSONLogger(conf, stderr{}), nil
+		}
+		return NewNATSLogger(conf), nil
+	}
+
+	file, err := openRotatingFile(conf.File, conf.MaxSize*megabyte, conf.MaxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.JSON {
+		return NewJSONLogger(conf, file), nil
+	}
+	return NewTextLogger(conf, file), nil
+}
+
+func validateConfig(conf Config) error {
+	if conf.Syslog && conf.RemoteSyslog != "" {
+		return fmt.Errorf("logging can use syslog or remotesyslog, not both")
+	}
+
+	if conf.File != "" && (conf.Syslog || conf.RemoteSyslog != "") {
+		return fmt.Errorf("logging can write to a file or to syslog, not both")
+	}
+
+	if conf.JSON && (conf.Syslog || conf.RemoteSyslog != "") {
+		return fmt.Errorf("syslog logging is text only, json can't be set")
+	}
+
+	if conf.MaxSize < 0 || conf.MaxBackups < 0 {
+		return fmt.Errorf("logging maxsize and maxbackups can't be negative")
+	}
+
+	if conf.File == "" && (conf.MaxSize > 0 || conf.MaxBackups > 0) {
+		return fmt.Errorf("logging maxsize and maxbackups require a file")
+	}
+
+	return nil
+}
+
+// stderr is a writer for stderr that isn't closed with the logger
+type stderr struct{}
+
+func (stderr) Write(b []byte) (int, error) {
+	return os.Stderr.Write(b)
+}
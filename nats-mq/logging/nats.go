@@ -17,6 +17,8 @@
 package logging
 
 import (
+	"io"
+
 	"github.com/nats-io/nats-server/v2/logger"
 )
 
@@ -28,14 +30,46 @@ func NewNATSLogger(conf Config) Logger {
 	}
 }
 
+// NewSysLogger creates a new logger that uses the nats-server/v2 syslog code, for the local
+// syslog or the remote one in the config
+func NewSysLogger(conf Config) Logger {
+	var l *logger.SysLogger
+	if conf.RemoteSyslog != "" {
+		l = logger.NewRemoteSysLogger(conf.RemoteSyslog, conf.Debug, conf.Trace)
+	} else {
+		l = logger.NewSysLogger(conf.Debug, conf.Trace)
+	}
+	return &NATSLogger{
+		logger: l,
+	}
+}
+
+// natsLogger is the logging interface shared by the nats std, file and sys loggers
+type natsLogger interface {
+	Debugf(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+	Fatalf(format string, v ...interface{})
+	Noticef(format string, v ...interface{})
+	Tracef(format string, v ...interface{})
+	Warnf(format string, v ...interface{})
+}
+
 // NATSLogger - uses the nats-server/v2 logging code
 type NATSLogger struct {
-	logger *logger.Logger
+	logger natsLogger
 }
 
-// Close forwards to the nats logger
+// Close forwards to the nats logger, if it can be closed
 func (logger *NATSLogger) Close() error {
-	return logger.logger.Close()
+	if closer, ok := logger.logger.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// WithFields returns the logger, the nats logger doesn't write fields
+func (logger *NATSLogger) WithFields(fields Fields) Logger {
+	return logger
 }
 
 // Debugf forwards to the nats logger
@@ -0,0 +1,185 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const megabyte = 1024 * 1024
+
+// backupTimeFormat is added to the name of rotated files, it sorts in time order
+const backupTimeFormat = "2006-01-02T15-04-05.000000000"
+
+// rotatingFile is a log file that is renamed, with the time added to its name, when it grows past the limit
+type rotatingFile struct {
+	sync.Mutex
+
+	name    string
+	file    *os.File
+	size    int64
+	limit   int64 // bytes, 0 turns rotation off
+	backups int   // rotated files to keep, 0 keeps all of them
+}
+
+func openRotatingFile(name string, limit int64, backups int) (*rotatingFile, error) {
+	rf := &rotatingFile{
+		name:    name,
+		limit:   limit,
+		backups: backups,
+	}
+
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// open opens the file for appending - expects the lock to be held
+func (rf *rotatingFile) open() error {
+	file, err := os.OpenFile(rf.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	rf.file = file
+	rf.size = info.Size()
+	return nil
+}
+
+// Write writes a log statement, the file is rotated first if the statement would take it past the limit,
+// if the rotation fails the statement is appended to the current file and the rotation is tried again
+// on the next write
+func (rf *rotatingFile) Write(b []byte) (int, error) {
+	rf.Lock()
+	defer rf.Unlock()
+
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if rf.limit > 0 && rf.size > 0 && rf.size+int64(len(b)) > rf.limit {
+		if err := rf.rotate(); err != nil && rf.file == nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(b)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate renames the file, opens a new one and removes the oldest backups, if the rename or the new
+// file fails the original file is reopened so statements are still appended to it - expects the lock to be held
+func (rf *rotatingFile) rotate() error {
+	err := rf.file.Close()
+	rf.file = nil
+
+	backup := rf.name + "." + time.Now().Format(backupTimeFormat)
+	if err == nil {
+		err = os.Rename(rf.name, backup)
+
+		if err == nil {
+			if err = rf.open(); err != nil {
+				os.Rename(backup, rf.name) // put the original back, ignore the error
+			}
+		}
+	}
+
+	if err != nil {
+		if rf.file == nil {
+			if openErr := rf.open(); openErr != nil {
+				return openErr
+			}
+		}
+		return err
+	}
+
+	return rf.removeBackups()
+}
+
+// removeBackups removes the oldest rotated files, leaving the configured number - expects the lock to be held
+func (rf *rotatingFile) removeBackups() error {
+	if rf.backups == 0 {
+		return nil
+	}
+
+	backups, err := rf.listBackups()
+	if err != nil {
+		return err
+	}
+
+	for len(backups) > rf.backups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// listBackups returns the rotated files, oldest first
+func (rf *rotatingFile) listBackups() ([]string, error) {
+	dir := filepath.Dir(rf.name)
+	prefix := filepath.Base(rf.name) + "."
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []string{}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, strings.TrimPrefix(name, prefix)); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(dir, name))
+	}
+
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// Close closes the file
+func (rf *rotatingFile) Close() error {
+	rf.Lock()
+	defer rf.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "bridge.log")
+	rf, err := openRotatingFile(name, 100, 2)
+	require.NoError(t, err)
+
+	line := []byte(strings.Repeat("x", 39) + "\n")
+	for i := 0; i < 10; i++ {
+		_, err = rf.Write(line)
+		require.NoError(t, err)
+	}
+	require.NoError(t, rf.Close())
+
+	backups, err := rf.listBackups()
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+
+	for _, backup := range backups {
+		data, err := ioutil.ReadFile(backup)
+		require.NoError(t, err)
+		require.Len(t, data, 80)
+	}
+
+	data, err := ioutil.ReadFile(name)
+	require.NoError(t, err)
+	require.Len(t, data, 80)
+
+	_, err = rf.Write(line)
+	require.Error(t, err)
+}
+
+func TestRotationKeepsAllBackups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "bridge.log")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "bridge.log.old"), []byte("not a backup"), 0660))
+
+	rf, err := openRotatingFile(name, 10, 0)
+	require.NoError(t, err)
+	defer rf.Close()
+
+	for i := 0; i < 5; i++ {
+		_, err = rf.Write([]byte("0123456789"))
+		require.NoError(t, err)
+	}
+
+	backups, err := rf.listBackups()
+	require.NoError(t, err)
+	require.Len(t, backups, 4)
+}
+
+func TestNewLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logger, err := NewLogger(Config{})
+	require.NoError(t, err)
+	require.IsType(t, &NATSLogger{}, logger)
+
+	logger, err = NewLogger(Config{JSON: true})
+	require.NoError(t, err)
+	require.IsType(t, &JSONLogger{}, logger)
+	require.NoError(t, logger.Close())
+
+	name := filepath.Join(dir, "bridge.log")
+	logger, err = NewLogger(Config{File: name, JSON: true, MaxSize: 1, MaxBackups: 3})
+	require.NoError(t, err)
+	logger.WithFields(Fields{"connector_id": "abc"}).Noticef("started")
+	require.NoError(t, logger.Close())
+
+	data, err := ioutil.ReadFile(name)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"connector_id":"abc"`)
+
+	logger, err = NewLogger(Config{File: name})
+	require.NoError(t, err)
+	logger.Noticef("text")
+	logger.Debugf("debug is off")
+	require.NoError(t, logger.Close())
+
+	data, err = ioutil.ReadFile(name)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "[INF] text\n")
+	require.NotContains(t, string(data), "debug is off")
+
+	invalid := []Config{
+		{Syslog: true, RemoteSyslog: "udp://localhost:514"},
+		{Syslog: true, File: name},
+		{RemoteSyslog: "udp://localhost:514", JSON: true},
+		{File: name, MaxSize: -1},
+		{File: name, MaxBackups: -1},
+		{MaxSize: 10},
+		{File: filepath.Join(dir, "missing", "bridge.log")},
+	}
+
+	for _, conf := range invalid {
+		_, err = NewLogger(conf)
+		require.Error(t, err)
+	}
+}
+
+func TestFailedRotationKeepsWriting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "bridge.log")
+	rf, err := openRotatingFile(name, 10, 0)
+	require.NoError(t, err)
+	defer rf.Close()
+
+	_, err = rf.Write([]byte("0123456789"))
+	require.NoError(t, err)
+
+	// the rename fails since the file is gone
+	require.NoError(t, os.Remove(name))
+
+	_, err = rf.Write([]byte("abcdefghij"))
+	require.NoError(t, err)
+
+	backups, err := rf.listBackups()
+	require.NoError(t, err)
+	require.Empty(t, backups)
+
+	data, err := ioutil.ReadFile(name)
+	require.NoError(t, err)
+	require.Equal(t, "abcdefghij", string(data))
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// Text log labels, the same as the nats logger's plain labels
+const (
+	labelDebug  = "[DBG] "
+	labelTrace  = "[TRC] "
+	labelNotice = "[INF] "
+	labelWarn   = "[WRN] "
+	labelError  = "[ERR] "
+	labelFatal  = "[FTL] "
+)
+
+// NewTextLogger creates a logger that writes lines in the nats logger's format, without colors, the writer
+// is closed with the logger if it is an io.Closer
+func NewTextLogger(conf Config, out io.Writer) Logger {
+	flags := 0
+	if conf.Time {
+		flags = log.LstdFlags | log.Lmicroseconds
+	}
+
+	prefix := ""
+	if conf.PID {
+		prefix = fmt.Sprintf("[%d] ", os.Getpid())
+	}
+
+	return &TextLogger{
+		out:    out,
+		logger: log.New(out, prefix, flags),
+		debug:  conf.Debug,
+		trace:  conf.Trace,
+	}
+}
+
+// TextLogger writes log statements as text, it is used for log files
+type TextLogger struct {
+	out    io.Writer
+	logger *log.Logger
+	debug  bool
+	trace  bool
+}
+
+// WithFields returns the logger, the text logger doesn't write fields
+func (logger *TextLogger) WithFields(fields Fields) Logger {
+	return logger
+}
+
+// Close closes the writer if it is an io.Closer
+func (logger *TextLogger) Close() error {
+	if closer, ok := logger.out.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Debugf writes a debug statement if debug is on
+func (logger *TextLogger) Debugf(format string, v ...interface{}) {
+	if logger.debug {
+		logger.logger.Printf(labelDebug+format, v...)
+	}
+}
+
+// Errorf writes an error statement
+func (logger *TextLogger) Errorf(format string, v ...interface{}) {
+	logger.logger.Printf(labelError+format, v...)
+}
+
+// Fatalf writes a fatal statement and exits
+func (logger *TextLogger) Fatalf(format string, v ...interface{}) {
+	logger.logger.Fatalf(labelFatal+format, v...)
+}
+
+// Noticef writes an info statement
+func (logger *TextLogger) Noticef(format string, v ...interface{}) {
+	logger.logger.Printf(labelNotice+format, v...)
+}
+
+// Tracef writes a trace statement if trace is on
+func (logger *TextLogger) Tracef(format string, v ...interface{}) {
+	if logger.trace {
+		logger.logger.Printf(labelTrace+format, v...)
+	}
+}
+
+// Warnf writes a warning statement
+func (logger *TextLogger) Warnf(format string, v ...interface{}) {
+	logger.logger.Printf(labelWarn+format, v...)
+}
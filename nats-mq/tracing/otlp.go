@@ -0,0 +1,289 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats-mq/nats-mq/logging"
+)
+
+// TracesPath is the OTLP/HTTP path for traces, it is added to endpoints that don't have a path
+const TracesPath = "/v1/traces"
+
+const (
+	defaultServiceName    = "nats-mq"
+	defaultExportInterval = 5000
+	defaultMaxQueueSize   = 2048
+	exportTimeout         = 10 * time.Second
+	scopeName             = "github.com/nats-io/nats-mq"
+)
+
+// OTLP status codes
+const (
+	statusCodeUnset = 0
+	statusCodeError = 2
+)
+
+// exporter batches spans and posts them to an OTLP/HTTP endpoint as JSON
+type exporter struct {
+	endpoint     string
+	serviceName  string
+	maxQueueSize int
+	client       *http.Client
+	logger       logging.Logger
+
+	lock    sync.Mutex
+	spans   []*Span
+	dropped int
+
+	done    chan bool
+	stopped sync.WaitGroup
+}
+
+func newExporter(config Config, logger logging.Logger) (*exporter, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("tracing endpoint %q must be an http or https URL", config.Endpoint)
+	}
+
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = TracesPath
+	}
+
+	e := &exporter{
+		endpoint:     endpoint.String(),
+		serviceName:  config.ServiceName,
+		maxQueueSize: config.MaxQueueSize,
+		client:       &http.Client{Timeout: exportTimeout},
+		logger:       logger,
+		done:         make(chan bool),
+	}
+
+	if e.serviceName == "" {
+		e.serviceName = defaultServiceName
+	}
+
+	if e.maxQueueSize <= 0 {
+		e.maxQueueSize = defaultMaxQueueSize
+	}
+
+	interval := config.ExportInterval
+	if interval <= 0 {
+		interval = defaultExportInterval
+	}
+
+	e.stopped.Add(1)
+	go e.run(time.Duration(interval) * time.Millisecond)
+
+	return e, nil
+}
+
+func (e *exporter) run(interval time.Duration) {
+	defer e.stopped.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			e.export()
+			return
+		case <-ticker.C:
+			e.export()
+		}
+	}
+}
+
+// close stops the exporter after a last export
+func (e *exporter) close() {
+	close(e.done)
+	e.stopped.Wait()
+}
+
+// add queues a span, or drops it if the queue is full
+func (e *exporter) add(span *Span) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if len(e.spans) >= e.maxQueueSize {
+		e.dropped++
+		return
+	}
+	e.spans = append(e.spans, span)
+}
+
+// export posts the queued spans, spans that fail to export are dropped
+func (e *exporter) export() {
+	e.lock.Lock()
+	spans := e.spans
+	dropped := e.dropped
+	e.spans = nil
+	e.dropped = 0
+	e.lock.Unlock()
+
+	if dropped > 0 {
+		e.logger.Noticef("dropped %d spans, the tracing queue was full", dropped)
+	}
+
+	if len(spans) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		e.logger.Noticef("failed to encode %d spans, %s", len(spans), err.Error())
+		return
+	}
+
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		e.logger.Noticef("failed to export %d spans to %s, %s", len(spans), e.endpoint, err.Error())
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		e.logger.Noticef("failed to export %d spans to %s, status %d", len(spans), e.endpoint, resp.StatusCode)
+	}
+}
+
+// The OTLP JSON encoding, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+// IDs are hex encoded and 64 bit integers are strings
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	TraceState        string          `json:"traceState,omitempty"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// request builds the OTLP request for the spans
+func (e *exporter) request(spans []*Span) otlpRequest {
+	encoded := make([]otlpSpan, 0, len(spans))
+
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           hex.EncodeToString(span.context.TraceID[:]),
+			SpanID:            hex.EncodeToString(span.context.SpanID[:]),
+			TraceState:        span.context.State,
+			Name:              span.name,
+			Kind:              span.kind,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Attributes:        attributes(span.attributes),
+			Status:            otlpStatus{Code: statusCodeUnset},
+		}
+
+		if span.parentID != [8]byte{} {
+			s.ParentSpanID = hex.EncodeToString(span.parentID[:])
+		}
+
+		if span.err != "" {
+			s.Status = otlpStatus{Code: statusCodeError, Message: span.err}
+		}
+
+		encoded = append(encoded, s)
+	}
+
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: attributes(map[string]string{"service.name": e.serviceName}),
+				},
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{Name: scopeName},
+						Spans: encoded,
+					},
+				},
+			},
+		},
+	}
+}
+
+// attributes converts a map to OTLP attributes, sorted by key
+func attributes(values map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]otlpAttribute, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, otlpAttribute{Key: k, Value: otlpValue{StringValue: values[k]}})
+	}
+	return attrs
+}
@@ -0,0 +1,237 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats-mq/nats-mq/logging"
+)
+
+// TraceParent is the W3C trace context header, and MQ property, that carries the trace and parent span
+const TraceParent = "traceparent"
+
+// TraceState is the W3C trace context header, and MQ property, that carries vendor specific trace data
+const TraceState = "tracestate"
+
+// sampledFlag is the trace flag for traces that are recorded
+const sampledFlag = 0x01
+
+// SpanKind is the OpenTelemetry kind of a span
+type SpanKind int
+
+// Span kinds, with the values used by OTLP
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+	SpanKindProducer SpanKind = 4
+	SpanKindConsumer SpanKind = 5
+)
+
+// Config holds the tracing configuration, tracing is off if there isn't an endpoint
+type Config struct {
+	Endpoint       string // the OTLP/HTTP endpoint, spans are posted as JSON to its /v1/traces path
+	ServiceName    string // the service.name resource attribute, defaults to nats-mq
+	ExportInterval int    // milliseconds between exports, defaults to 5000
+	MaxQueueSize   int    // spans waiting to be exported, defaults to 2048, spans are dropped when it is full
+}
+
+// SpanContext identifies a span, it is carried between services in the traceparent and tracestate headers
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+	State   string
+}
+
+// ParseTraceParent parses W3C traceparent and tracestate values, ok is false if the traceparent isn't valid
+func ParseTraceParent(traceparent string, tracestate string) (SpanContext, bool) {
+	sc := SpanContext{}
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+
+	// version 00 has exactly four parts, later versions may add more
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+
+	if !decodeHex(parts[1], sc.TraceID[:]) || !decodeHex(parts[2], sc.SpanID[:]) {
+		return sc, false
+	}
+
+	var flags [1]byte
+	if !decodeHex(parts[3], flags[:]) {
+		return sc, false
+	}
+	sc.Flags = flags[0]
+	sc.State = strings.TrimSpace(tracestate)
+
+	return sc, sc.IsValid()
+}
+
+func decodeHex(s string, dst []byte) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// IsValid returns true if the trace and span IDs are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// IsSampled returns true if the trace is being recorded
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&sampledFlag != 0
+}
+
+// TraceParent returns the W3C traceparent value for the span context
+func (sc SpanContext) TraceParent() string {
+	return fmt.Sprintf("00-%x-%x-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// Tracer creates spans and exports them with OTLP, a nil tracer creates spans that aren't recorded
+// but still carry the context of their parent
+type Tracer struct {
+	exporter *exporter
+}
+
+// NewTracer creates a tracer that exports to the configured endpoint, or returns nil if there isn't one
+func NewTracer(config Config, logger logging.Logger) (*Tracer, error) {
+	if config.Endpoint == "" {
+		return nil, nil
+	}
+
+	exporter, err := newExporter(config, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tracer{
+		exporter: exporter,
+	}, nil
+}
+
+// Close exports the spans that are waiting and stops the exporter
+func (t *Tracer) Close() {
+	if t == nil {
+		return
+	}
+	t.exporter.close()
+}
+
+// Span is a timed operation, spans are only recorded if they have a tracer and their trace is sampled
+type Span struct {
+	tracer     *Tracer
+	name       string
+	kind       SpanKind
+	context    SpanContext
+	parentID   [8]byte
+	start      time.Time
+	end        time.Time
+	attributes map[string]string
+	err        string
+	ended      sync.Once
+}
+
+// Start starts a span at the time, as a child of the parent if it is valid, or in a new trace if it isn't
+// A parent that isn't sampled, or a nil tracer, gives a span that isn't recorded and carries the parent's context
+func (t *Tracer) Start(name string, kind SpanKind, parent SpanContext, start time.Time) *Span {
+	if t == nil || (parent.IsValid() && !parent.IsSampled()) {
+		return &Span{context: parent}
+	}
+
+	span := &Span{
+		tracer:     t,
+		name:       name,
+		kind:       kind,
+		start:      start,
+		attributes: map[string]string{},
+	}
+
+	if parent.IsValid() {
+		span.context = parent
+		span.parentID = parent.SpanID
+	} else {
+		rand.Read(span.context.TraceID[:])
+		span.context.Flags = sampledFlag
+	}
+	rand.Read(span.context.SpanID[:])
+
+	return span
+}
+
+// Context returns the span's context, which is the parent's for a span that isn't recorded
+func (s *Span) Context() SpanContext {
+	return s.context
+}
+
+// IsRecording returns true if the span will be exported
+func (s *Span) IsRecording() bool {
+	return s.tracer != nil
+}
+
+// SetAttribute sets a string attribute on the span
+func (s *Span) SetAttribute(key string, value string) {
+	if !s.IsRecording() {
+		return
+	}
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed, if the error isn't nil
+func (s *Span) SetError(err error) {
+	if !s.IsRecording() || err == nil {
+		return
+	}
+	s.err = err.Error()
+}
+
+// Step records a finished child span that started at the time and ends now, the error, if any, fails the
+// child and the span
+func (s *Span) Step(name string, start time.Time, err error) {
+	if !s.IsRecording() {
+		return
+	}
+
+	child := s.tracer.Start(name, SpanKindInternal, s.context, start)
+	child.SetError(err)
+	child.End()
+	s.SetError(err)
+}
+
+// End ends the span and queues it for export, only the first call has an effect
+func (s *Span) End() {
+	if !s.IsRecording() {
+		return
+	}
+	s.ended.Do(func() {
+		s.end = time.Now()
+		s.tracer.exporter.add(s)
+	})
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright 2012-2019 The NATS Authors
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-mq/nats-mq/logging"
+	"github.com/stretchr/testify/require"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceParent(t *testing.T) {
+	sc, ok := ParseTraceParent(testTraceParent, "congo=t61rcWkgMzE")
+	require.True(t, ok)
+	require.True(t, sc.IsSampled())
+	require.Equal(t, "congo=t61rcWkgMzE", sc.State)
+	require.Equal(t, testTraceParent, sc.TraceParent())
+
+	sc, ok = ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", "")
+	require.True(t, ok)
+	require.False(t, sc.IsSampled())
+
+	// later versions can add fields
+	_, ok = ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", "")
+	require.True(t, ok)
+
+	invalid := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+	}
+
+	for _, traceparent := range invalid {
+		_, ok = ParseTraceParent(traceparent, "")
+		require.False(t, ok, traceparent)
+	}
+}
+
+func TestSpansWithoutATracer(t *testing.T) {
+	var tracer *Tracer
+	parent, _ := ParseTraceParent(testTraceParent, "")
+
+	span := tracer.Start("test", SpanKindConsumer, parent, time.Now())
+	require.False(t, span.IsRecording())
+	require.Equal(t, parent, span.Context())
+
+	span.SetAttribute("key", "value")
+	span.Step("step", time.Now(), fmt.Errorf("failed"))
+	span.End()
+	tracer.Close()
+
+	span = tracer.Start("test", SpanKindConsumer, SpanContext{}, time.Now())
+	require.False(t, span.Context().IsValid())
+}
+
+type collector struct {
+	sync.Mutex
+	server   *httptest.Server
+	requests []otlpRequest
+	paths    []string
+}
+
+func newCollector() *collector {
+	c := &collector{}
+	c.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		request := otlpRequest{}
+		if err := json.Unmarshal(body, &request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		c.Lock()
+		c.requests = append(c.requests, request)
+		c.paths = append(c.paths, r.URL.Path)
+		c.Unlock()
+	}))
+	return c
+}
+
+func (c *collector) spans() []otlpSpan {
+	c.Lock()
+	defer c.Unlock()
+	spans := []otlpSpan{}
+	for _, r := range c.requests {
+		for _, rs := range r.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}
+	return spans
+}
+
+func TestExportToCollector(t *testing.T) {
+	c := newCollector()
+	defer c.server.Close()
+
+	tracer, err := NewTracer(Config{Endpoint: c.server.URL, ServiceName: "bridge", ExportInterval: 50}, logging.NewNATSLogger(logging.Config{}))
+	require.NoError(t, err)
+
+	parent, _ := ParseTraceParent(testTraceParent, "congo=t61rcWkgMzE")
+	start := time.Now()
+
+	span := tracer.Start("receive", SpanKindConsumer, parent, start)
+	require.True(t, span.IsRecording())
+	require.Equal(t, parent.TraceID, span.Context().TraceID)
+	require.NotEqual(t, parent.SpanID, span.Context().SpanID)
+
+	span.SetAttribute("connector", "test")
+	span.Step("convert", start, nil)
+	span.Step("put", start, fmt.Errorf("put failed"))
+	span.End()
+
+	require.Eventually(t, func() bool {
+		return len(c.spans()) == 3
+	}, 5*time.Second, 50*time.Millisecond)
+
+	tracer.Close()
+
+	c.Lock()
+	require.Equal(t, TracesPath, c.paths[0])
+	require.Equal(t, "service.name", c.requests[0].ResourceSpans[0].Resource.Attributes[0].Key)
+	require.Equal(t, "bridge", c.requests[0].ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+	c.Unlock()
+
+	spans := c.spans()
+	byName := map[string]otlpSpan{}
+	for _, s := range spans {
+		require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", s.TraceID)
+		byName[s.Name] = s
+	}
+
+	receive := byName["receive"]
+	require.Equal(t, "00f067aa0ba902b7", receive.ParentSpanID)
+	require.Equal(t, SpanKindConsumer, receive.Kind)
+	require.Equal(t, "congo=t61rcWkgMzE", receive.TraceState)
+	require.Equal(t, statusCodeError, receive.Status.Code)
+	require.Equal(t, "connector", receive.Attributes[0].Key)
+
+	require.Equal(t, receive.SpanID, byName["convert"].ParentSpanID)
+	require.Equal(t, statusCodeUnset, byName["convert"].Status.Code)
+	require.Equal(t, receive.SpanID, byName["put"].ParentSpanID)
+	require.Equal(t, "put failed", byName["put"].Status.Message)
+}
+
+func TestUnsampledParentIsNotRecorded(t *testing.T) {
+	c := newCollector()
+	defer c.server.Close()
+
+	tracer, err := NewTracer(Config{Endpoint: c.server.URL}, logging.NewNATSLogger(logging.Config{}))
+	require.NoError(t, err)
+
+	parent, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", "")
+	span := tracer.Start("receive", SpanKindConsumer, parent, time.Now())
+	require.False(t, span.IsRecording())
+	require.Equal(t, parent, span.Context())
+	span.End()
+
+	span = tracer.Start("receive", SpanKindConsumer, SpanContext{}, time.Now())
+	require.True(t, span.IsRecording())
+	require.True(t, span.Context().IsValid())
+	require.True(t, span.Context().IsSampled())
+	span.End()
+
+	tracer.Close() // exports the last span
+	require.Len(t, c.spans(), 1)
+}
+
+func TestTracerConfig(t *testing.T) {
+	tracer, err := NewTracer(Config{}, nil)
+	require.NoError(t, err)
+	require.Nil(t, tracer)
+
+	_, err = NewTracer(Config{Endpoint: "localhost:4318"}, nil)
+	require.Error(t, err)
+
+	tracer, err = NewTracer(Config{Endpoint: "http://localhost:4318/custom/traces"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:4318/custom/traces", tracer.exporter.endpoint)
+	tracer.Close()
+}
+
+func TestFullQueueDropsSpans(t *testing.T) {
+	c := newCollector()
+	defer c.server.Close()
+
+	tracer, err := NewTracer(Config{Endpoint: c.server.URL, MaxQueueSize: 2, ExportInterval: 60000}, logging.NewNATSLogger(logging.Config{}))
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		tracer.Start("receive", SpanKindConsumer, SpanContext{}, time.Now()).End()
+	}
+
+	tracer.Close()
+	require.Len(t, c.spans(), 2)
+}